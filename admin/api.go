@@ -0,0 +1,393 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SessionInfo
+// @Description: 会话信息
+type SessionInfo struct {
+	SessionId  uint32  `json:"sessionId"`  // 会话ID
+	RemoteAddr string  `json:"remoteAddr"` // 客户端地址
+	UserId     string  `json:"userId"`     // 用户ID
+	TraceId    string  `json:"traceId"`    // 追踪ID
+	Recording  bool    `json:"recording"`  // 是否正在录制流量
+	CreatedAt  string  `json:"createdAt"`  // 创建时间
+	Age        float64 `json:"age"`        // 在线时长(秒)
+	BytesIn    uint64  `json:"bytesIn"`    // 已接收字节数
+	BytesOut   uint64  `json:"bytesOut"`   // 已发送字节数
+}
+
+// API
+// @Description: 会话管理接口, 所有请求需携带 Authorization: Bearer <token>
+type API struct {
+	token   string                           // 访问令牌, 为空时拒绝全部请求
+	service iface.IService                   // 网关服务
+	notice  func(text string) iface.IMessage // 系统公告消息构造
+	Reload  func() error                     // 重新加载配置
+	Errors  *zlog.RingSink                   // 最近的错误日志
+}
+
+// LogInfo
+// @Description: 日志信息
+type LogInfo struct {
+	Time    string                 `json:"time"`             // 时间
+	Level   string                 `json:"level"`            // 日志级别
+	Caller  string                 `json:"caller,omitempty"` // 来源代码位置
+	Message string                 `json:"msg"`              // 日志内容
+	Fields  map[string]interface{} `json:"fields,omitempty"` // 附加字段
+}
+
+func NewAPI(token string, service iface.IService, notice func(text string) iface.IMessage) *API {
+	if token == "" {
+		zlog.Warn("admin api token is empty, all api requests will be rejected")
+	}
+	return &API{
+		token:   token,
+		service: service,
+		notice:  notice,
+	}
+}
+
+// Register
+//
+//	@Description: 注册接口到管理服务
+//	@receiver a
+//	@param s 管理服务
+func (a *API) Register(s *Server) {
+	s.Handle("/api/sessions", a.auth(a.handleSessions))
+	s.Handle("/api/sessions/", a.auth(a.handleSession))
+	s.Handle("/api/broadcast", a.auth(a.handleBroadcast))
+	s.Handle("/api/maxsession", a.auth(a.handleMaxSession))
+	s.Handle("/api/config/reload", a.auth(a.handleReload))
+	s.Handle("/api/logs/errors", a.auth(a.handleErrors))
+	s.Handle("/api/record", a.auth(a.handleRecord))
+	s.Handle("/api/queue", a.auth(a.handleQueue))
+	s.Handle("/api/queue/flush", a.auth(a.handleQueueFlush))
+}
+
+// auth
+//
+//	@Description: 校验访问令牌
+//	@receiver a
+//	@param handler 处理
+//	@return http.Handler
+func (a *API) auth(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			writeError(writer, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		handler(writer, request)
+	})
+}
+
+// handleSessions
+//
+//	@Description: GET /api/sessions 列出全部会话
+func (a *API) handleSessions(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodGet) {
+		return
+	}
+	sessionMgr := a.service.GetSessionMgr()
+	infos := make([]SessionInfo, 0, sessionMgr.GetSessionCount())
+	sessionMgr.Range(func(session iface.ISession) bool {
+		infos = append(infos, newSessionInfo(session))
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].SessionId < infos[j].SessionId
+	})
+	writeJSON(writer, http.StatusOK, map[string]interface{}{
+		"count":    len(infos),
+		"sessions": infos,
+	})
+}
+
+// handleSession
+//
+//	@Description: GET /api/sessions/{id} 查询会话, POST /api/sessions/{id}/kick 踢下线
+func (a *API) handleSession(writer http.ResponseWriter, request *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(request.URL.Path, "/api/sessions/"), "/")
+	parts := strings.Split(path, "/")
+	sessionId, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "kick") {
+		writeError(writer, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	session := a.service.GetSessionMgr().GetSession(uint32(sessionId))
+	if session == nil {
+		writeError(writer, http.StatusNotFound, errors.New("session not found"))
+		return
+	}
+	if len(parts) == 1 {
+		if allowMethod(writer, request, http.MethodGet) {
+			writeJSON(writer, http.StatusOK, newSessionInfo(session))
+		}
+		return
+	}
+
+	if !allowMethod(writer, request, http.MethodPost) {
+		return
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if !readJSON(writer, request, &body) {
+		return
+	}
+	if body.Reason == "" {
+		body.Reason = "admin"
+	}
+	zlog.Warnf("admin kick session, session id: %d, reason: %s", sessionId, body.Reason)
+	session.Kick(body.Reason)
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"kicked": sessionId})
+}
+
+// handleBroadcast
+//
+//	@Description: POST /api/broadcast 发送系统公告
+func (a *API) handleBroadcast(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodPost) {
+		return
+	}
+	var body struct {
+		Notice string `json:"notice"`
+	}
+	if !readJSON(writer, request, &body) {
+		return
+	}
+	if body.Notice == "" {
+		writeError(writer, http.StatusBadRequest, errors.New("notice is empty"))
+		return
+	}
+	a.service.Broadcast(a.notice(body.Notice))
+	zlog.Infof("admin broadcast notice: %s", body.Notice)
+	writeJSON(writer, http.StatusOK, map[string]interface{}{
+		"sessions": a.service.GetSessionMgr().GetSessionCount(),
+	})
+}
+
+// handleMaxSession
+//
+//	@Description: GET 查询 / POST 修改最大会话数量
+func (a *API) handleMaxSession(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			MaxSession int `json:"maxSession"`
+		}
+		if !readJSON(writer, request, &body) {
+			return
+		}
+		if body.MaxSession <= 0 {
+			writeError(writer, http.StatusBadRequest, errors.New("maxSession must be positive"))
+			return
+		}
+		zlog.Warnf("admin change max session: %d -> %d", a.service.GetMaxSession(), body.MaxSession)
+		a.service.SetMaxSession(body.MaxSession)
+	default:
+		allowMethod(writer, request, http.MethodGet, http.MethodPost)
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"maxSession": a.service.GetMaxSession()})
+}
+
+// handleReload
+//
+//	@Description: POST /api/config/reload 重新加载配置
+func (a *API) handleReload(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodPost) {
+		return
+	}
+	if a.Reload == nil {
+		writeError(writer, http.StatusNotImplemented, errors.New("reload is not supported"))
+		return
+	}
+	if err := a.Reload(); err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"reloaded": true})
+}
+
+// handleRecord
+//
+//	@Description: GET 查询录制目标 / POST 按会话ID或用户ID开始(enabled=true)或停止录制
+func (a *API) handleRecord(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			SessionId uint32 `json:"sessionId"`
+			UserId    string `json:"userId"`
+			Enabled   bool   `json:"enabled"`
+		}
+		if !readJSON(writer, request, &body) {
+			return
+		}
+		switch {
+		case body.SessionId != 0:
+			if err := a.service.RecordSession(body.SessionId, body.Enabled); err != nil {
+				writeError(writer, http.StatusNotFound, err)
+				return
+			}
+		case body.UserId != "":
+			a.service.RecordUser(body.UserId, body.Enabled)
+		default:
+			writeError(writer, http.StatusBadRequest, errors.New("sessionId or userId is required"))
+			return
+		}
+		zlog.Warnf("admin record, session id: %d, user id: %s, enabled: %v", body.SessionId, body.UserId, body.Enabled)
+	default:
+		allowMethod(writer, request, http.MethodGet, http.MethodPost)
+		return
+	}
+	sessions, users := a.service.RecordTargets()
+	writeJSON(writer, http.StatusOK, map[string]interface{}{
+		"sessions": sessions,
+		"users":    users,
+	})
+}
+
+// handleQueue
+//
+//	@Description: GET 查询登录排队 / POST 开始(drain=true)或停止排空, 排空期间不再接收新的排队连接
+func (a *API) handleQueue(writer http.ResponseWriter, request *http.Request) {
+	queue := a.service.GetLoginQueue()
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Drain bool `json:"drain"`
+		}
+		if !readJSON(writer, request, &body) {
+			return
+		}
+		zlog.Warnf("admin login queue drain: %v", body.Drain)
+		queue.Drain(body.Drain)
+	default:
+		allowMethod(writer, request, http.MethodGet, http.MethodPost)
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{
+		"open":     queue.IsOpen(),
+		"draining": queue.IsDraining(),
+		"length":   queue.Len(),
+		"lanes":    queue.Lanes(),
+		"rate":     queue.Rate(),
+	})
+}
+
+// handleQueueFlush
+//
+//	@Description: POST /api/queue/flush 清空登录排队, 排队的连接收到会话已满后关闭
+func (a *API) handleQueueFlush(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodPost) {
+		return
+	}
+	flushed := a.service.GetLoginQueue().Flush()
+	zlog.Warnf("admin login queue flush, count: %d", flushed)
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"flushed": flushed})
+}
+
+// handleErrors
+//
+//	@Description: GET /api/logs/errors 查看最近的错误日志, 从新到旧
+func (a *API) handleErrors(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodGet) {
+		return
+	}
+	if a.Errors == nil {
+		writeError(writer, http.StatusNotImplemented, errors.New("recent errors are not recorded"))
+		return
+	}
+	entries := a.Errors.Entries()
+	infos := make([]LogInfo, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		infos = append(infos, newLogInfo(&entries[i]))
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{
+		"total":   a.Errors.Total(),
+		"entries": infos,
+	})
+}
+
+func newLogInfo(e *zlog.Entry) LogInfo {
+	info := LogInfo{
+		Time:    e.Time.Format(time.RFC3339Nano),
+		Level:   zlog.LevelName(e.Level),
+		Message: strings.TrimRight(e.Message, "\n"),
+	}
+	if e.File != "" {
+		info.Caller = e.File + ":" + strconv.Itoa(e.Line)
+	}
+	if len(e.Fields) > 0 {
+		info.Fields = make(map[string]interface{}, len(e.Fields))
+		for _, field := range e.Fields {
+			value := field.Value
+			if err, ok := value.(error); ok {
+				value = err.Error()
+			}
+			info.Fields[field.Key] = value
+		}
+	}
+	return info
+}
+
+func newSessionInfo(session iface.ISession) SessionInfo {
+	return SessionInfo{
+		SessionId:  session.GetSessionId(),
+		RemoteAddr: session.GetRemoteAddr(),
+		UserId:     session.GetUserId(),
+		TraceId:    session.GetTraceId(),
+		Recording:  session.IsRecording(),
+		CreatedAt:  session.GetCreatedAt().Format(time.RFC3339),
+		Age:        time.Since(session.GetCreatedAt()).Seconds(),
+		BytesIn:    session.GetBytesIn(),
+		BytesOut:   session.GetBytesOut(),
+	}
+}
+
+func allowMethod(writer http.ResponseWriter, request *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if request.Method == method {
+			return true
+		}
+	}
+	writer.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(writer, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+func readJSON(writer http.ResponseWriter, request *http.Request, v interface{}) bool {
+	if request.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<20)).Decode(v); err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func writeJSON(writer http.ResponseWriter, code int, v interface{}) {
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(code)
+	_ = json.NewEncoder(writer).Encode(v)
+}
+
+func writeError(writer http.ResponseWriter, code int, err error) {
+	writeJSON(writer, code, map[string]string{"error": err.Error()})
+}
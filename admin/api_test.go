@@ -0,0 +1,284 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/admin"
+	"github.com/liaoyudong2/GateServer/client"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/gatetest"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain 测试日志不写文件, 需要检查日志的用例自行调用zlog.StartCapture
+func TestMain(m *testing.M) {
+	zlog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+const testToken = "secret"
+
+// newAdmin 启动测试网关并注册管理接口
+func newAdmin(t *testing.T) (*gatetest.Gate, *admin.API, *admin.Server) {
+	t.Helper()
+	gate := gatetest.Start(t)
+	api := admin.NewAPI(testToken, gate.Service, func(text string) iface.IMessage {
+		return codec.NewMessage(codec.MsgIdSystemNotice, 0, []byte(text))
+	})
+	server := admin.NewServer()
+	api.Register(server)
+	return gate, api, server
+}
+
+// call 以指定令牌请求接口, 返回状态码和解析后的响应
+func call(t *testing.T, server *admin.Server, token, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	var result map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%s %s: invalid response %q", method, path, recorder.Body.String())
+	}
+	if recorder.Code == http.StatusMethodNotAllowed && recorder.Header().Get("Allow") == "" {
+		t.Fatalf("%s %s: 405 without Allow header", method, path)
+	}
+	return recorder.Code, result
+}
+
+// expectCall 请求接口, 状态码和错误信息与期望一致
+func expectCall(t *testing.T, server *admin.Server, method, path, body string, code int, errText string) map[string]interface{} {
+	t.Helper()
+	got, result := call(t, server, testToken, method, path, body)
+	if got != code || fmt.Sprint(result["error"]) != errText && errText != "" {
+		t.Fatalf("%s %s: got %d %v, want %d %q", method, path, got, result, code, errText)
+	}
+	return result
+}
+
+// sessionIds 列出全部会话ID
+func sessionIds(t *testing.T, server *admin.Server) []uint32 {
+	t.Helper()
+	result := expectCall(t, server, http.MethodGet, "/api/sessions", "", http.StatusOK, "")
+	sessions, _ := result["sessions"].([]interface{})
+	if count := result["count"].(float64); int(count) != len(sessions) {
+		t.Fatalf("count %v, sessions %d", count, len(sessions))
+	}
+	ids := make([]uint32, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, uint32(session.(map[string]interface{})["sessionId"].(float64)))
+	}
+	return ids
+}
+
+func TestAPIAuth(t *testing.T) {
+	gate, _, server := newAdmin(t)
+	for _, token := range []string{"", "wrong", testToken + "x"} {
+		if code, result := call(t, server, token, http.MethodGet, "/api/sessions", ""); code != http.StatusUnauthorized || result["error"] != "unauthorized" {
+			t.Fatalf("token %q: got %d %v", token, code, result)
+		}
+	}
+	// 不带Bearer前缀的令牌同样可用
+	request := httptest.NewRequest(http.MethodGet, "/api/maxsession", nil)
+	request.Header.Set("Authorization", testToken)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("raw token: got %d", recorder.Code)
+	}
+
+	// 未配置令牌时拒绝全部请求
+	empty := admin.NewServer()
+	admin.NewAPI("", gate.Service, nil).Register(empty)
+	if code, _ := call(t, empty, "", http.MethodGet, "/api/sessions", ""); code != http.StatusUnauthorized {
+		t.Fatalf("empty token: got %d", code)
+	}
+	if code, _ := call(t, empty, " ", http.MethodGet, "/api/sessions", ""); code != http.StatusUnauthorized {
+		t.Fatalf("empty token with header: got %d", code)
+	}
+}
+
+func TestAPISessions(t *testing.T) {
+	gate, _, server := newAdmin(t)
+	if ids := sessionIds(t, server); len(ids) != 0 {
+		t.Fatalf("sessions before dial: %v", ids)
+	}
+	gate.Dial(client.Config{})
+	c := gate.Dial(client.Config{Addr: gate.TCPURL()})
+	gate.WaitSessions(2)
+
+	// 按会话ID排序
+	ids := sessionIds(t, server)
+	if len(ids) != 2 || ids[0] >= ids[1] {
+		t.Fatalf("sessions %v", ids)
+	}
+	path := fmt.Sprintf("/api/sessions/%d", ids[1])
+	info := expectCall(t, server, http.MethodGet, path, "", http.StatusOK, "")
+	if uint32(info["sessionId"].(float64)) != ids[1] || info["remoteAddr"] == "" || info["createdAt"] == "" {
+		t.Fatalf("session info %v", info)
+	}
+	expectCall(t, server, http.MethodGet, path+"/", "", http.StatusOK, "")
+
+	expectCall(t, server, http.MethodPost, "/api/sessions", "", http.StatusMethodNotAllowed, "method not allowed")
+	expectCall(t, server, http.MethodPost, path, "", http.StatusMethodNotAllowed, "method not allowed")
+	expectCall(t, server, http.MethodGet, path+"/kick", "", http.StatusMethodNotAllowed, "method not allowed")
+	for _, bad := range []string{"/api/sessions/abc", "/api/sessions/-1", "/api/sessions/4294967296", path + "/ban", path + "/kick/now"} {
+		expectCall(t, server, http.MethodGet, bad, "", http.StatusNotFound, "not found")
+	}
+	expectCall(t, server, http.MethodGet, fmt.Sprintf("/api/sessions/%d", ids[1]+1), "", http.StatusNotFound, "session not found")
+
+	// 踢下线, 客户端收到原因
+	closed := make(chan error, 1)
+	c.OnState(func(state client.State, err error) {
+		if state == client.StateClosed {
+			closed <- err
+		}
+	})
+	expectCall(t, server, http.MethodPost, path+"/kick", `{"reason": "maintenance"`, http.StatusBadRequest, "unexpected EOF")
+	result := expectCall(t, server, http.MethodPost, path+"/kick", `{"reason": "maintenance"}`, http.StatusOK, "")
+	if uint32(result["kicked"].(float64)) != ids[1] {
+		t.Fatalf("kick result %v", result)
+	}
+	select {
+	case err := <-closed:
+		var disconnect *client.DisconnectError
+		if !errors.As(err, &disconnect) || disconnect.Code != codec.CloseKicked || disconnect.Reason != "maintenance" {
+			t.Fatalf("closed with %v", err)
+		}
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("kicked client not closed")
+	}
+	gate.WaitSessions(1)
+
+	// 没有原因时默认为admin
+	path = fmt.Sprintf("/api/sessions/%d/kick", ids[0])
+	expectCall(t, server, http.MethodPost, path, "", http.StatusOK, "")
+	gate.WaitSessions(0)
+}
+
+func TestAPIBroadcast(t *testing.T) {
+	gate, _, server := newAdmin(t)
+	c := gate.Dial(client.Config{})
+	notices := make(chan string, 1)
+	c.Handle(codec.MsgIdSystemNotice, func(msg iface.IMessage) {
+		notices <- string(msg.GetMsgData())
+	})
+	gate.WaitSessions(1)
+
+	expectCall(t, server, http.MethodGet, "/api/broadcast", "", http.StatusMethodNotAllowed, "method not allowed")
+	expectCall(t, server, http.MethodPost, "/api/broadcast", "", http.StatusBadRequest, "notice is empty")
+	expectCall(t, server, http.MethodPost, "/api/broadcast", `{"notice": ""}`, http.StatusBadRequest, "notice is empty")
+	expectCall(t, server, http.MethodPost, "/api/broadcast", `notice`, http.StatusBadRequest, "")
+	result := expectCall(t, server, http.MethodPost, "/api/broadcast", `{"notice": "server restarts soon"}`, http.StatusOK, "")
+	if result["sessions"] != float64(1) {
+		t.Fatalf("broadcast result %v", result)
+	}
+	select {
+	case notice := <-notices:
+		if notice != "server restarts soon" {
+			t.Fatalf("notice %q", notice)
+		}
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("notice not received")
+	}
+}
+
+func TestAPIMaxSession(t *testing.T) {
+	gate, _, server := newAdmin(t)
+	current := gate.Service.GetMaxSession()
+	result := expectCall(t, server, http.MethodGet, "/api/maxsession", "", http.StatusOK, "")
+	if result["maxSession"] != float64(current) {
+		t.Fatalf("maxsession %v, want %d", result, current)
+	}
+
+	for _, body := range []string{`{"maxSession": 0}`, `{"maxSession": -3}`, ""} {
+		expectCall(t, server, http.MethodPost, "/api/maxsession", body, http.StatusBadRequest, "maxSession must be positive")
+	}
+	expectCall(t, server, http.MethodPost, "/api/maxsession", `{"maxSession": "5"}`, http.StatusBadRequest, "")
+	expectCall(t, server, http.MethodPut, "/api/maxsession", "", http.StatusMethodNotAllowed, "method not allowed")
+	if gate.Service.GetMaxSession() != current {
+		t.Fatal("rejected request changed max session")
+	}
+
+	result = expectCall(t, server, http.MethodPost, "/api/maxsession", `{"maxSession": 5}`, http.StatusOK, "")
+	if result["maxSession"] != float64(5) || gate.Service.GetMaxSession() != 5 {
+		t.Fatalf("maxsession %v, service %d", result, gate.Service.GetMaxSession())
+	}
+}
+
+func TestAPIReload(t *testing.T) {
+	_, api, server := newAdmin(t)
+	expectCall(t, server, http.MethodPost, "/api/config/reload", "", http.StatusNotImplemented, "reload is not supported")
+
+	var reloadErr error
+	api.Reload = func() error { return reloadErr }
+	expectCall(t, server, http.MethodGet, "/api/config/reload", "", http.StatusMethodNotAllowed, "method not allowed")
+	expectCall(t, server, http.MethodPost, "/api/config/reload", "", http.StatusOK, "")
+	reloadErr = errors.New("invalid config")
+	expectCall(t, server, http.MethodPost, "/api/config/reload", "", http.StatusInternalServerError, "invalid config")
+}
+
+func TestAPIErrors(t *testing.T) {
+	_, api, server := newAdmin(t)
+	expectCall(t, server, http.MethodGet, "/api/logs/errors", "", http.StatusNotImplemented, "recent errors are not recorded")
+
+	log := zlog.NewZLog(zlog.BitLongFile)
+	log.SetOutput(io.Discard)
+	api.Errors = zlog.NewRingSink(2, zlog.LogError, zlog.EncoderText)
+	log.AddSink(api.Errors)
+	log.Error("first")
+	log.Warn("ignored")
+	log.With("err", errors.New("boom")).Errorf("second %d", 2)
+	log.Error("third")
+
+	// 从新到旧, 只保留最近的条数
+	result := expectCall(t, server, http.MethodGet, "/api/logs/errors", "", http.StatusOK, "")
+	entries := result["entries"].([]interface{})
+	if result["total"] != float64(3) || len(entries) != 2 {
+		t.Fatalf("errors %v", result)
+	}
+	newest, older := entries[0].(map[string]interface{}), entries[1].(map[string]interface{})
+	if newest["msg"] != "third" || newest["level"] != "error" || !strings.Contains(fmt.Sprint(newest["caller"]), "api_test.go:") {
+		t.Fatalf("newest entry %v", newest)
+	}
+	if older["msg"] != "second 2" || fmt.Sprint(older["fields"]) != "map[err:boom]" {
+		t.Fatalf("older entry %v", older)
+	}
+	expectCall(t, server, http.MethodDelete, "/api/logs/errors", "", http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func TestAPIRecordAndQueue(t *testing.T) {
+	_, _, server := newAdmin(t)
+	result := expectCall(t, server, http.MethodGet, "/api/record", "", http.StatusOK, "")
+	if _, ok := result["sessions"]; !ok {
+		t.Fatalf("record targets %v", result)
+	}
+	expectCall(t, server, http.MethodPost, "/api/record", `{"enabled": true}`, http.StatusBadRequest, "sessionId or userId is required")
+	expectCall(t, server, http.MethodPost, "/api/record", `{"sessionId": 1, "enabled": true}`, http.StatusNotFound, "session undefined, session id: 1")
+
+	result = expectCall(t, server, http.MethodGet, "/api/queue", "", http.StatusOK, "")
+	if result["draining"] != false || result["length"] != float64(0) {
+		t.Fatalf("queue %v", result)
+	}
+	result = expectCall(t, server, http.MethodPost, "/api/queue", `{"drain": true}`, http.StatusOK, "")
+	if result["draining"] != true {
+		t.Fatalf("queue after drain %v", result)
+	}
+	expectCall(t, server, http.MethodGet, "/api/queue/flush", "", http.StatusMethodNotAllowed, "method not allowed")
+	result = expectCall(t, server, http.MethodPost, "/api/queue/flush", "", http.StatusOK, "")
+	if result["flushed"] != float64(0) {
+		t.Fatalf("queue flush %v", result)
+	}
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Server
+// @Description: 管理端口HTTP服务, 与客户端端口分离
+type Server struct {
+	mux    *http.ServeMux // 路由
+	server *http.Server   // http服务
+}
+
+func NewServer() *Server {
+	return &Server{
+		mux: http.NewServeMux(),
+	}
+}
+
+// Handle
+//
+//	@Description: 注册接口
+//	@receiver s
+//	@param pattern 路径
+//	@param handler 处理
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP
+//
+//	@Description: 按注册的接口处理请求, 测试时可直接交给httptest
+//	@receiver s
+//	@param writer 响应
+//	@param request 请求
+func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s.mux.ServeHTTP(writer, request)
+}
+
+// Start
+//
+//	@Description: 启动管理服务
+//	@receiver s
+//	@param port 端口
+//	@return error
+func (s *Server) Start(port int) error {
+	if s.server != nil {
+		return errors.New("admin server is already startup")
+	}
+	addr := fmt.Sprintf("0.0.0.0:%d", port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.server = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	zlog.Infof("AdminServer startup, listen at %v", addr)
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zlog.Errorf("admin server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Stop() {
+	if s.server != nil {
+		_ = s.server.Close()
+	}
+}
@@ -0,0 +1,823 @@
+// Package client 网关协议的Go客户端, 供机器人、测试和工具使用, 编解码与网关共用codec包
+//
+//	c := client.New(client.Config{Addr: "ws://127.0.0.1:9010/", Heartbeat: 10 * time.Second, Reconnect: true})
+//	c.Handle(1001, func(msg iface.IMessage) { ... })
+//	if err := c.Connect(); err != nil { ... }
+//	_ = c.Send(1000, data)
+package client
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultDialTimeout  = 5 * time.Second        // 默认连接超时
+	DefaultAuthTimeout  = 5 * time.Second        // 默认登录超时
+	DefaultReconnectMin = 500 * time.Millisecond // 默认首次重连间隔
+	DefaultReconnectMax = 30 * time.Second       // 默认最大重连间隔
+)
+
+var (
+	ErrClosed       = errors.New("client: closed")
+	ErrNotConnected = errors.New("client: not connected")
+	ErrQueueFull    = errors.New("client: send queue full")
+	ErrTimeout      = errors.New("client: timeout")
+	ErrOverflow     = errors.New("client: gate overflow")
+)
+
+// OverflowError
+// @Description: 网关会话已满, 可以用errors.Is(err, ErrOverflow)判断, 自动重连时至少等待RetryAfter
+type OverflowError struct {
+	RetryAfter time.Duration // 网关建议的重试间隔, 未提供时为0
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrOverflow, e.RetryAfter)
+}
+
+func (e *OverflowError) Unwrap() error {
+	return ErrOverflow
+}
+
+// overflowError
+//
+//	@Description: 从网关的溢出消息创建错误
+//	@param msg codec.MsgIdOverflow消息
+//	@return *OverflowError
+func overflowError(msg iface.IMessage) *OverflowError {
+	err := &OverflowError{}
+	if msg.GetMsgLen() >= 4 {
+		err.RetryAfter = time.Duration(binary.BigEndian.Uint32(msg.GetMsgData())) * time.Second
+	}
+	return err
+}
+
+// DisconnectError
+// @Description: 网关关闭连接时通知的原因, websocket来自关闭帧, tcp来自codec.MsgIdDisconnect, 可以用errors.As取出
+type DisconnectError struct {
+	Code   uint16 // 关闭码, 见codec.CloseKicked等
+	Reason string // 原因
+}
+
+func (e *DisconnectError) Error() string {
+	return fmt.Sprintf("client: disconnected by gate, code %d: %s", e.Code, e.Reason)
+}
+
+// disconnectError
+//
+//	@Description: 从网关的关闭通知消息创建错误
+//	@param msg codec.MsgIdDisconnect消息
+//	@return *DisconnectError
+func disconnectError(msg iface.IMessage) *DisconnectError {
+	code, reason := codec.ParseDisconnect(msg.GetMsgData())
+	return &DisconnectError{Code: code, Reason: reason}
+}
+
+// closeError
+//
+//	@Description: 收到websocket关闭帧时转换为DisconnectError, 其他错误原样返回
+//	@param err 读取错误
+//	@return error
+func closeError(err error) error {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseNoStatusReceived && closeErr.Code != websocket.CloseAbnormalClosure {
+		return &DisconnectError{Code: uint16(closeErr.Code), Reason: closeErr.Text}
+	}
+	return err
+}
+
+// QueuePosition
+//
+//	@Description: 解析网关的排队消息, 可在codec.MsgIdQueue的处理中调用
+//	@param msg codec.MsgIdQueue消息
+//	@return position 排名, 从1开始
+//	@return eta 预计等待时间, 为0时网关还无法估算
+func QueuePosition(msg iface.IMessage) (position int, eta time.Duration) {
+	if msg.GetMsgLen() < 8 {
+		return 0, 0
+	}
+	data := msg.GetMsgData()
+	return int(binary.BigEndian.Uint32(data)), time.Duration(binary.BigEndian.Uint32(data[4:])) * time.Second
+}
+
+// State 连接状态
+type State int32
+
+const (
+	StateIdle         State = iota // 未连接
+	StateConnecting                // 正在连接和登录
+	StateConnected                 // 已连接
+	StateReconnecting              // 断线后等待重连
+	StateClosed                    // 已关闭, 不再重连
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("state(%d)", int32(s))
+}
+
+// Auth
+// @Description: 登录设置, 每次连接成功后发送登录消息并等待回包, 重连时同样执行, 用于恢复会话
+type Auth struct {
+	MsgId   uint16                           // 登录消息ID
+	Payload func(resume bool) []byte         // 生成登录内容, 重连时resume为true, 可携带上次登录回包中的令牌
+	ReplyId uint16                           // 登录回包消息ID, 为0时不等待
+	Verify  func(reply iface.IMessage) error // 检查登录回包, 返回错误时本次连接失败, 可以为空
+	Timeout time.Duration                    // 等待回包的超时时间, 为0时使用DefaultAuthTimeout, 登录排队期间每收到排名重新计时
+}
+
+// Config
+// @Description: 客户端设置
+type Config struct {
+	Addr             string        // 网关地址: ws://host:port/path, wss://host:port/path 或 tcp://host:port, ws可携带参数queue_token优先排队
+	TLSConfig        *tls.Config   // wss的TLS设置, 可以为空
+	DialTimeout      time.Duration // 连接超时, 为0时使用DefaultDialTimeout
+	Auth             *Auth         // 登录设置, 为空时不登录
+	Heartbeat        time.Duration // 心跳间隔, 为0时不发送心跳
+	HeartbeatTimeout time.Duration // 超过此时间没有收到任何消息时断开, 为0时为3倍心跳间隔
+	Reconnect        bool          // 断线后是否自动重连
+	ReconnectMin     time.Duration // 首次重连间隔, 之后每次加倍, 为0时使用DefaultReconnectMin
+	ReconnectMax     time.Duration // 最大重连间隔, 为0时使用DefaultReconnectMax
+	ReconnectLimit   int           // 每次断线后的最大重连次数, 为0时不限制
+	QueueSize        int           // 重连期间缓存的待发送消息数, 为0时重连期间发送返回ErrNotConnected
+	MaxMsgSize       uint32        // 最大消息长度, 为0时使用codec默认值
+}
+
+// Handler 消息处理, 在读协程中按收到的顺序调用, 不应阻塞
+type Handler func(msg iface.IMessage)
+
+// StateHandler 状态变化处理, err为断线或连接失败的原因
+type StateHandler func(state State, err error)
+
+// Client
+// @Description: 网关客户端, 并发安全
+type Client struct {
+	cfg Config // 设置
+
+	lock      sync.Mutex   // 保护连接、待发送队列和关闭状态, 同时串行化写入
+	conn      iface.IConn  // 当前连接, 断线期间为空
+	queue     [][]byte     // 重连期间待发送的消息帧
+	closed    bool         // 是否已关闭
+	exitChan  chan bool    // 关闭信号
+	done      chan bool    // 连接协程结束信号
+	connected atomic.Bool  // 是否成功连接过, 之后的连接为恢复
+	state     atomic.Int32 // 连接状态
+
+	handlerLock sync.RWMutex                     // 保护以下字段
+	handlers    map[uint16]Handler               // 按msgId的处理
+	fallback    Handler                          // 没有处理时的默认处理
+	onState     StateHandler                     // 状态变化处理
+	waiters     map[uint16][]chan iface.IMessage // 等待回包的请求
+
+	rtt      atomic.Int64 // 最近一次心跳往返时间(纳秒)
+	lastRecv atomic.Int64 // 最近一次收到消息的时间(unix纳秒)
+}
+
+// New
+//
+//	@Description: 创建客户端, 注册处理后调用Connect连接
+//	@param cfg 设置
+//	@return *Client
+func New(cfg Config) *Client {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultDialTimeout
+	}
+	if cfg.HeartbeatTimeout <= 0 {
+		cfg.HeartbeatTimeout = 3 * cfg.Heartbeat
+	}
+	if cfg.ReconnectMin <= 0 {
+		cfg.ReconnectMin = DefaultReconnectMin
+	}
+	if cfg.ReconnectMax < cfg.ReconnectMin {
+		cfg.ReconnectMax = DefaultReconnectMax
+		if cfg.ReconnectMax < cfg.ReconnectMin {
+			cfg.ReconnectMax = cfg.ReconnectMin
+		}
+	}
+	if cfg.Auth != nil {
+		auth := *cfg.Auth
+		if auth.Timeout <= 0 {
+			auth.Timeout = DefaultAuthTimeout
+		}
+		cfg.Auth = &auth
+	}
+	return &Client{
+		cfg:      cfg,
+		exitChan: make(chan bool),
+		handlers: make(map[uint16]Handler),
+		waiters:  make(map[uint16][]chan iface.IMessage),
+	}
+}
+
+// Handle
+//
+//	@Description: 设置msgId的处理, 为空时删除
+//	@receiver c
+//	@param msgId 消息ID
+//	@param handler 处理
+func (c *Client) Handle(msgId uint16, handler Handler) {
+	c.handlerLock.Lock()
+	defer c.handlerLock.Unlock()
+
+	if handler == nil {
+		delete(c.handlers, msgId)
+	} else {
+		c.handlers[msgId] = handler
+	}
+}
+
+// HandleDefault
+//
+//	@Description: 设置没有单独处理的消息的默认处理
+//	@receiver c
+//	@param handler 处理
+func (c *Client) HandleDefault(handler Handler) {
+	c.handlerLock.Lock()
+	defer c.handlerLock.Unlock()
+
+	c.fallback = handler
+}
+
+// OnState
+//
+//	@Description: 设置状态变化处理
+//	@receiver c
+//	@param handler 处理
+func (c *Client) OnState(handler StateHandler) {
+	c.handlerLock.Lock()
+	defer c.handlerLock.Unlock()
+
+	c.onState = handler
+}
+
+func (c *Client) State() State {
+	return State(c.state.Load())
+}
+
+// RTT
+//
+//	@Description: 最近一次心跳的往返时间, 没有心跳时为0
+//	@receiver c
+//	@return time.Duration
+func (c *Client) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// Connect
+//
+//	@Description: 连接网关并登录, 失败时返回错误且不重连, 成功后断线按设置自动重连
+//	@receiver c
+//	@return error
+func (c *Client) Connect() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return ErrClosed
+	}
+	if c.conn != nil || c.done != nil {
+		c.lock.Unlock()
+		return errors.New("client: already connected")
+	}
+	c.lock.Unlock()
+
+	c.setState(StateConnecting, nil)
+	conn, stream, pending, err := c.open()
+	if err != nil {
+		c.setState(StateIdle, err)
+		return err
+	}
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		_ = conn.Close()
+		return ErrClosed
+	}
+	c.conn = conn
+	c.done = make(chan bool)
+	c.lock.Unlock()
+
+	c.setState(StateConnected, nil)
+	go c.run(conn, stream, pending)
+	return nil
+}
+
+// Send
+//
+//	@Description: 发送消息, 重连期间按设置缓存, 连接恢复后按顺序发送
+//	@receiver c
+//	@param msgId 消息ID
+//	@param data 消息内容
+//	@return error
+func (c *Client) Send(msgId uint16, data []byte) error {
+	frame := codec.NewStream().Marshal(codec.NewMessage(msgId, 0, data))
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if c.conn == nil {
+		if c.cfg.QueueSize <= 0 || c.done == nil {
+			return ErrNotConnected
+		}
+		if len(c.queue) >= c.cfg.QueueSize {
+			return ErrQueueFull
+		}
+		c.queue = append(c.queue, frame)
+		return nil
+	}
+	if err := c.conn.WriteData(frame); err != nil {
+		// 关闭连接, 由读协程处理断线
+		_ = c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// Request
+//
+//	@Description: 发送消息并等待指定msgId的回包, 回包只交给等待者, 不调用处理
+//	@receiver c
+//	@param msgId 消息ID
+//	@param data 消息内容
+//	@param replyId 回包消息ID
+//	@param timeout 超时时间
+//	@return iface.IMessage
+//	@return error
+func (c *Client) Request(msgId uint16, data []byte, replyId uint16, timeout time.Duration) (iface.IMessage, error) {
+	wait := make(chan iface.IMessage, 1)
+	c.handlerLock.Lock()
+	c.waiters[replyId] = append(c.waiters[replyId], wait)
+	c.handlerLock.Unlock()
+	defer c.removeWaiter(replyId, wait)
+
+	if err := c.Send(msgId, data); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-wait:
+		return msg, nil
+	case <-c.exitChan:
+		return nil, ErrClosed
+	case <-time.After(timeout):
+		return nil, ErrTimeout
+	}
+}
+
+func (c *Client) removeWaiter(msgId uint16, wait chan iface.IMessage) {
+	c.handlerLock.Lock()
+	defer c.handlerLock.Unlock()
+
+	waiters := c.waiters[msgId]
+	for i, w := range waiters {
+		if w == wait {
+			c.waiters[msgId] = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(c.waiters[msgId]) == 0 {
+		delete(c.waiters, msgId)
+	}
+}
+
+// Close
+//
+//	@Description: 关闭连接并停止重连
+//	@receiver c
+//	@return error
+func (c *Client) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.exitChan)
+	var err error
+	if c.conn != nil {
+		err = c.conn.Close()
+	}
+	done := c.done
+	c.lock.Unlock()
+
+	if done != nil {
+		<-done
+	} else {
+		c.setState(StateClosed, nil)
+	}
+	return err
+}
+
+func (c *Client) setState(state State, err error) {
+	c.state.Store(int32(state))
+	c.handlerLock.RLock()
+	onState := c.onState
+	c.handlerLock.RUnlock()
+	if onState != nil {
+		onState(state, err)
+	}
+}
+
+// run
+//
+//	@Description: 连接协程, 读取消息直到断线, 之后按设置重连
+//	@receiver c
+//	@param conn 已登录的连接
+//	@param stream 连接的解析器
+//	@param pending 登录期间收到的消息
+func (c *Client) run(conn iface.IConn, stream iface.IStream, pending []iface.IMessage) {
+	defer close(c.done)
+	for {
+		for _, msg := range pending {
+			c.dispatch(msg)
+		}
+		err := c.serve(conn, stream)
+
+		c.lock.Lock()
+		c.conn = nil
+		closed := c.closed
+		c.lock.Unlock()
+		_ = conn.Close()
+		if closed {
+			c.setState(StateClosed, nil)
+			return
+		}
+		if !c.cfg.Reconnect {
+			c.close()
+			c.setState(StateClosed, err)
+			return
+		}
+		c.setState(StateReconnecting, err)
+		if conn, stream, pending, err = c.reconnect(err); err != nil {
+			c.close()
+			c.setState(StateClosed, err)
+			return
+		}
+		c.setState(StateConnected, nil)
+	}
+}
+
+// close
+//
+//	@Description: 不再重连时标记关闭, 丢弃待发送的消息
+//	@receiver c
+func (c *Client) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.exitChan)
+	}
+	c.queue = nil
+}
+
+// reconnect
+//
+//	@Description: 按退避间隔重连, 网关会话已满时至少等待其建议的间隔, 成功后发送缓存的消息
+//	@receiver c
+//	@param cause 断线原因
+//	@return iface.IConn
+//	@return iface.IStream
+//	@return []iface.IMessage 登录期间收到的消息
+//	@return error 关闭或达到重连次数时返回
+func (c *Client) reconnect(cause error) (iface.IConn, iface.IStream, []iface.IMessage, error) {
+	delay := c.cfg.ReconnectMin
+	err := cause
+	for attempt := 1; ; attempt++ {
+		// 加入随机抖动, 避免大量客户端同时重连
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		var overflow *OverflowError
+		if errors.As(err, &overflow) && wait < overflow.RetryAfter {
+			wait = overflow.RetryAfter
+		}
+		select {
+		case <-c.exitChan:
+			return nil, nil, nil, ErrClosed
+		case <-time.After(wait):
+		}
+		var conn iface.IConn
+		var stream iface.IStream
+		var pending []iface.IMessage
+		conn, stream, pending, err = c.open()
+		if err == nil {
+			c.lock.Lock()
+			if c.closed {
+				c.lock.Unlock()
+				_ = conn.Close()
+				return nil, nil, nil, ErrClosed
+			}
+			for i, frame := range c.queue {
+				if err = conn.WriteData(frame); err != nil {
+					c.queue = c.queue[i:]
+					break
+				}
+			}
+			if err == nil {
+				c.queue = nil
+				c.conn = conn
+				c.lock.Unlock()
+				return conn, stream, pending, nil
+			}
+			c.lock.Unlock()
+			_ = conn.Close()
+		}
+		if c.cfg.ReconnectLimit > 0 && attempt >= c.cfg.ReconnectLimit {
+			return nil, nil, nil, fmt.Errorf("client: reconnect failed after %d attempts: %w", attempt, err)
+		}
+		if delay *= 2; delay > c.cfg.ReconnectMax {
+			delay = c.cfg.ReconnectMax
+		}
+	}
+}
+
+// open
+//
+//	@Description: 建立连接并登录
+//	@receiver c
+//	@return iface.IConn
+//	@return iface.IStream
+//	@return []iface.IMessage 登录期间收到的其他消息
+//	@return error
+func (c *Client) open() (iface.IConn, iface.IStream, []iface.IMessage, error) {
+	conn, err := dial(c.cfg.Addr, c.cfg.TLSConfig, c.cfg.DialTimeout)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stream := codec.NewStream()
+	if c.cfg.MaxMsgSize > 0 {
+		stream.SetMaxSize(c.cfg.MaxMsgSize)
+	}
+	c.lastRecv.Store(time.Now().UnixNano())
+	pending, err := c.auth(conn, stream)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+	c.connected.Store(true)
+	return conn, stream, pending, nil
+}
+
+// auth
+//
+//	@Description: 发送登录消息并等待回包
+//	@receiver c
+//	@param conn 连接
+//	@param stream 解析器
+//	@return []iface.IMessage 回包之前收到的其他消息
+//	@return error
+func (c *Client) auth(conn iface.IConn, stream iface.IStream) ([]iface.IMessage, error) {
+	auth := c.cfg.Auth
+	if auth == nil {
+		return nil, nil
+	}
+	var payload []byte
+	if auth.Payload != nil {
+		payload = auth.Payload(c.connected.Load())
+	}
+	if err := conn.WriteData(stream.Marshal(codec.NewMessage(auth.MsgId, 0, payload))); err != nil {
+		return nil, err
+	}
+	if auth.ReplyId == 0 {
+		return nil, nil
+	}
+	deadline, ok := conn.(interface{ SetReadDeadline(t time.Time) error })
+	if ok {
+		_ = deadline.SetReadDeadline(time.Now().Add(auth.Timeout))
+		defer func() {
+			_ = deadline.SetReadDeadline(time.Time{})
+		}()
+	}
+	var pending []iface.IMessage
+	for {
+		data, err := conn.ReadData()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, fmt.Errorf("client: auth reply %d timeout: %w", auth.ReplyId, ErrTimeout)
+			}
+			return nil, closeError(err)
+		}
+		msgs, err := unmarshal(stream, data)
+		for i, msg := range msgs {
+			if msg.GetMsgId() == codec.MsgIdOverflow {
+				return nil, overflowError(msg)
+			}
+			if msg.GetMsgId() == codec.MsgIdDisconnect {
+				return nil, disconnectError(msg)
+			}
+			if msg.GetMsgId() == codec.MsgIdQueue {
+				// 网关排队期间不读取登录消息, 晋升后才会回包
+				if ok {
+					_ = deadline.SetReadDeadline(time.Now().Add(auth.Timeout))
+				}
+				c.dispatch(msg)
+				continue
+			}
+			if msg.GetMsgId() != auth.ReplyId {
+				pending = append(pending, msg)
+				continue
+			}
+			if auth.Verify != nil {
+				if err := auth.Verify(msg); err != nil {
+					return nil, fmt.Errorf("client: auth rejected: %w", err)
+				}
+			}
+			c.dispatch(msg)
+			return append(pending, msgs[i+1:]...), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// serve
+//
+//	@Description: 读取消息并分发, 同时发送心跳, 连接出错或心跳超时时返回
+//	@receiver c
+//	@param conn 连接
+//	@param stream 解析器
+//	@return error 断线原因
+func (c *Client) serve(conn iface.IConn, stream iface.IStream) error {
+	stop := make(chan bool)
+	defer close(stop)
+	var timeout atomic.Bool
+	if c.cfg.Heartbeat > 0 {
+		go c.heartbeat(conn, stop, &timeout)
+	}
+	for {
+		data, err := conn.ReadData()
+		if err != nil {
+			if timeout.Load() {
+				return fmt.Errorf("client: no message within %s: %w", c.cfg.HeartbeatTimeout, ErrTimeout)
+			}
+			return closeError(err)
+		}
+		c.lastRecv.Store(time.Now().UnixNano())
+		msgs, err := unmarshal(stream, data)
+		for _, msg := range msgs {
+			if msg.GetMsgId() == codec.MsgIdOverflow {
+				return overflowError(msg)
+			}
+			if msg.GetMsgId() == codec.MsgIdDisconnect {
+				return disconnectError(msg)
+			}
+			c.dispatch(msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// heartbeat
+//
+//	@Description: 定时发送心跳, 内容为发送时间, 超时没有收到任何消息时关闭连接
+//	@receiver c
+//	@param conn 连接
+//	@param stop 结束信号
+//	@param timeout 心跳超时时设置
+func (c *Client) heartbeat(conn iface.IConn, stop chan bool, timeout *atomic.Bool) {
+	ticker := time.NewTicker(c.cfg.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if now.Sub(time.Unix(0, c.lastRecv.Load())) > c.cfg.HeartbeatTimeout {
+				timeout.Store(true)
+				_ = conn.Close()
+				return
+			}
+			data := make([]byte, 8)
+			binary.BigEndian.PutUint64(data, uint64(now.UnixNano()))
+			frame := codec.NewStream().Marshal(codec.NewMessage(codec.MsgIdHeartbeat, 0, data))
+			c.lock.Lock()
+			if c.conn == conn {
+				_ = conn.WriteData(frame)
+			}
+			c.lock.Unlock()
+		}
+	}
+}
+
+// dispatch
+//
+//	@Description: 分发消息: 心跳回包计算往返时间, 等待者优先, 其次按msgId的处理, 最后默认处理
+//	@receiver c
+//	@param msg 消息
+func (c *Client) dispatch(msg iface.IMessage) {
+	if msg.GetMsgId() == codec.MsgIdHeartbeat {
+		if msg.GetMsgLen() == 8 {
+			sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(msg.GetMsgData())))
+			c.rtt.Store(int64(time.Since(sentAt)))
+		}
+		return
+	}
+	c.handlerLock.Lock()
+	if waiters := c.waiters[msg.GetMsgId()]; len(waiters) > 0 {
+		wait := waiters[0]
+		c.waiters[msg.GetMsgId()] = waiters[1:]
+		c.handlerLock.Unlock()
+		wait <- msg
+		return
+	}
+	handler, ok := c.handlers[msg.GetMsgId()]
+	if !ok {
+		handler = c.fallback
+	}
+	c.handlerLock.Unlock()
+	if handler != nil {
+		handler(msg)
+	}
+}
+
+// unmarshal
+//
+//	@Description: 解出数据中的全部完整消息, 出错时返回出错前的消息
+//	@param stream 解析器
+//	@param data 数据
+//	@return []iface.IMessage
+//	@return error
+func unmarshal(stream iface.IStream, data []byte) ([]iface.IMessage, error) {
+	var msgs []iface.IMessage
+	for readLen := 0; readLen < len(data); {
+		n, msg, err := stream.Unmarshal(data[readLen:])
+		if err != nil {
+			return msgs, err
+		}
+		readLen += n
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+// dial
+//
+//	@Description: 按地址的协议建立连接
+//	@param addr 地址
+//	@param tlsConfig wss的TLS设置
+//	@param timeout 超时时间
+//	@return iface.IConn
+//	@return error
+func dial(addr string, tlsConfig *tls.Config, timeout time.Duration) (iface.IConn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("client: bad address %q: %w", addr, err)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+		dialer := websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: timeout,
+			TLSClientConfig:  tlsConfig,
+		}
+		conn, resp, err := dialer.Dial(addr, nil)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
+				// 网关会话已满, 握手前返回503
+				seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+				return nil, &OverflowError{RetryAfter: time.Duration(seconds) * time.Second}
+			}
+			return nil, err
+		}
+		return codec.NewWebSocketConn(conn), nil
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", u.Host, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return codec.NewTCPConn(conn), nil
+	}
+	return nil, fmt.Errorf("client: unsupported address scheme %q, want ws, wss or tcp", u.Scheme)
+}
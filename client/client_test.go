@@ -0,0 +1,261 @@
+package client_test
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/liaoyudong2/GateServer/client"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain 测试日志不写文件, 需要检查日志的用例自行调用zlog.StartCapture
+func TestMain(m *testing.M) {
+	zlog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+const (
+	msgAuth  = 1  // 登录, 回包内容为 resume 或 login
+	msgPing  = 10 // 回包 msgPong, 内容不变
+	msgPong  = 11
+	msgClose = 99 // 服务端断开连接
+)
+
+// gate 模拟网关: 处理登录、心跳和回包, silent时不回复心跳
+type gate struct {
+	silent bool
+	lock   sync.Mutex
+	auths  []string
+}
+
+func (g *gate) serve(conn iface.IConn) {
+	defer conn.Close()
+	stream := codec.NewStream()
+	for {
+		data, err := conn.ReadData()
+		if err != nil {
+			return
+		}
+		for readLen := 0; readLen < len(data); {
+			n, msg, err := stream.Unmarshal(data[readLen:])
+			if err != nil {
+				return
+			}
+			readLen += n
+			if msg == nil {
+				continue
+			}
+			var reply iface.IMessage
+			switch msg.GetMsgId() {
+			case msgAuth:
+				g.lock.Lock()
+				g.auths = append(g.auths, string(msg.GetMsgData()))
+				g.lock.Unlock()
+				reply = codec.NewMessage(msgAuth, 0, msg.GetMsgData())
+			case codec.MsgIdHeartbeat:
+				if !g.silent {
+					reply = msg
+				}
+			case msgPing:
+				reply = codec.NewMessage(msgPong, 0, msg.GetMsgData())
+			case msgClose:
+				return
+			}
+			if reply != nil {
+				_ = conn.WriteData(codec.NewStream().Marshal(reply))
+			}
+		}
+	}
+}
+
+func (g *gate) authPayloads() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return append([]string(nil), g.auths...)
+}
+
+func startTCP(t *testing.T, g *gate) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go g.serve(codec.NewTCPConn(conn))
+		}
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+func startWebSocket(t *testing.T, g *gate) string {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			return
+		}
+		g.serve(codec.NewWebSocketConn(conn))
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/"
+}
+
+func auth() *client.Auth {
+	return &client.Auth{
+		MsgId: msgAuth,
+		Payload: func(resume bool) []byte {
+			if resume {
+				return []byte("resume")
+			}
+			return []byte("login")
+		},
+		ReplyId: msgAuth,
+	}
+}
+
+func TestClient(t *testing.T) {
+	g := &gate{}
+	for _, addr := range []string{startTCP(t, g), startWebSocket(t, g)} {
+		c := client.New(client.Config{Addr: addr, Auth: auth(), Heartbeat: 20 * time.Millisecond})
+		pongs := make(chan string, 1)
+		c.Handle(msgPong, func(msg iface.IMessage) {
+			pongs <- string(msg.GetMsgData())
+		})
+		if err := c.Connect(); err != nil {
+			t.Fatalf("%s: %v", addr, err)
+		}
+		if err := c.Send(msgPing, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case data := <-pongs:
+			if data != "hello" {
+				t.Fatalf("%s: pong %q, want hello", addr, data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: no pong", addr)
+		}
+		reply, err := c.Request(msgPing, []byte("req"), msgPong, time.Second)
+		if err != nil || string(reply.GetMsgData()) != "req" {
+			t.Fatalf("%s: request reply %v, err %v", addr, reply, err)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if c.RTT() <= 0 {
+			t.Fatalf("%s: no heartbeat rtt", addr)
+		}
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if c.State() != client.StateClosed {
+			t.Fatalf("%s: state %s after close", addr, c.State())
+		}
+		if err = c.Send(msgPing, nil); !errors.Is(err, client.ErrClosed) {
+			t.Fatalf("%s: send after close: %v", addr, err)
+		}
+	}
+	if auths := g.authPayloads(); len(auths) != 2 || auths[0] != "login" || auths[1] != "login" {
+		t.Fatalf("unexpected auth payloads: %v", auths)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	g := &gate{}
+	c := client.New(client.Config{
+		Addr:         startTCP(t, g),
+		Auth:         auth(),
+		Reconnect:    true,
+		ReconnectMin: 10 * time.Millisecond,
+		QueueSize:    4,
+	})
+	defer c.Close()
+	var lock sync.Mutex
+	var states []client.State
+	reconnected := make(chan bool, 1)
+	c.OnState(func(state client.State, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		states = append(states, state)
+		if state == client.StateConnected && len(states) > 2 {
+			reconnected <- true
+		}
+	})
+	pongs := make(chan string, 4)
+	c.Handle(msgPong, func(msg iface.IMessage) {
+		pongs <- string(msg.GetMsgData())
+	})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Send(msgClose, nil)
+	// 断线期间发送的消息在重连后发出
+	for c.State() == client.StateConnected {
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Send(msgPing, []byte("queued")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not reconnected")
+	}
+	select {
+	case data := <-pongs:
+		if data != "queued" {
+			t.Fatalf("pong %q, want queued", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued message not sent after reconnect")
+	}
+	if auths := g.authPayloads(); auths[1] != "resume" {
+		t.Fatalf("unexpected auth payloads: %v", auths)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	want := []client.State{client.StateConnecting, client.StateConnected, client.StateReconnecting, client.StateConnected}
+	if len(states) != len(want) {
+		t.Fatalf("states %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("states %v, want %v", states, want)
+		}
+	}
+}
+
+func TestClientHeartbeatTimeout(t *testing.T) {
+	c := client.New(client.Config{Addr: startTCP(t, &gate{silent: true}), Heartbeat: 10 * time.Millisecond})
+	closed := make(chan error, 1)
+	c.OnState(func(state client.State, err error) {
+		if state == client.StateClosed {
+			closed <- err
+		}
+	})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-closed:
+		if !errors.Is(err, client.ErrTimeout) {
+			t.Fatalf("closed with %v, want timeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat timeout not detected")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/fakebackend"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const usage = `commands:
+  send <sessionId> <msgId> <text>   send a message to a session
+  broadcast <msgId> <text>          broadcast a message to all sessions
+  kick <sessionId> [reason]         kick a session
+  close <sessionId> <code> [reason] close a session with a close code, e.g. 4002 for auth failure
+  bind <sessionId> <userId>         bind a user id to a session
+  latency <ms>                      set the default latency
+  disconnect                        drop all gate connections
+  conns                             list gate connections
+  help                              show this help`
+
+// fakebackend 模拟后端, 本地开发和集成测试时代替游戏服:
+//
+//	fakebackend -listen 127.0.0.1:7010                   回显全部消息
+//	fakebackend -listen 127.0.0.1:7010 -script bench.json 按脚本处理
+//
+// 运行中从标准输入读取命令, 用于发送消息、广播、踢下线或断开连接
+func main() {
+	listen := flag.String("listen", "127.0.0.1:7010", "listen address, the gate's backend address")
+	scriptFile := flag.String("script", "", "json script file, see fakebackend.Script")
+	latency := flag.Duration("latency", 0, "default latency before replying, overrides the script")
+	quiet := flag.Bool("quiet", false, "do not print received messages")
+	payload := flag.Int("payload", 32, "payload bytes printed per message, -1 prints all")
+	flag.Parse()
+
+	server := fakebackend.New()
+	if *scriptFile != "" {
+		script, err := fakebackend.LoadScript(*scriptFile)
+		if err != nil {
+			fatal(err)
+		}
+		if err = script.Apply(server); err != nil {
+			fatal(err)
+		}
+	}
+	if *latency > 0 {
+		server.SetLatency(*latency)
+	}
+	if !*quiet {
+		server.SetObserver(func(req *fakebackend.Request) {
+			data := req.Data
+			if *payload >= 0 && len(data) > *payload {
+				data = data[:*payload]
+			}
+			fmt.Printf("%s recv session=%d gate=%d trace=%s msgId=%d len=%d %q\n", req.Time.Format("15:04:05.000"), req.SessionId,
+				codec.SessionServerId(req.SessionId), gatenet.FormatTraceId(req.TraceId), req.MsgId, len(req.Data), data)
+		})
+	}
+	if err := server.Start(*listen); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("fakebackend listen at %s, type help for commands\n", server.Addr())
+
+	go commands(server)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	<-c
+	_ = server.Close()
+}
+
+func fatal(err error) {
+	_, _ = fmt.Fprintln(os.Stderr, "fakebackend:", err)
+	os.Exit(1)
+}
+
+// commands
+//
+//	@Description: 执行标准输入的命令
+//	@param server 模拟后端
+func commands(server *fakebackend.Server) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 4)
+		if fields[0] == "" {
+			continue
+		}
+		if err := command(server, fields); err != nil {
+			fmt.Println("error:", err)
+		}
+	}
+}
+
+func command(server *fakebackend.Server, fields []string) error {
+	arg := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	// 最后一个参数包含剩余全部文本
+	rest := func(i int) string {
+		return strings.Join(fields[i:], " ")
+	}
+	switch fields[0] {
+	case "send":
+		sessionId, err := strconv.ParseUint(arg(1), 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad session id %q", arg(1))
+		}
+		msgId, err := strconv.ParseUint(arg(2), 0, 16)
+		if err != nil {
+			return fmt.Errorf("bad msgId %q", arg(2))
+		}
+		return server.Send(uint32(sessionId), uint16(msgId), []byte(arg(3)))
+	case "broadcast":
+		fields = strings.SplitN(rest(0), " ", 3)
+		msgId, err := strconv.ParseUint(arg(1), 0, 16)
+		if err != nil {
+			return fmt.Errorf("bad msgId %q", arg(1))
+		}
+		return server.Broadcast(uint16(msgId), []byte(arg(2)))
+	case "kick":
+		fields = strings.SplitN(rest(0), " ", 3)
+		sessionId, err := strconv.ParseUint(arg(1), 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad session id %q", arg(1))
+		}
+		return server.Kick(uint32(sessionId), arg(2))
+	case "close":
+		fields = strings.SplitN(rest(0), " ", 4)
+		sessionId, err := strconv.ParseUint(arg(1), 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad session id %q", arg(1))
+		}
+		code, err := strconv.ParseUint(arg(2), 10, 16)
+		if err != nil {
+			return fmt.Errorf("bad close code %q", arg(2))
+		}
+		return server.CloseSession(uint32(sessionId), uint16(code), arg(3))
+	case "bind":
+		sessionId, err := strconv.ParseUint(arg(1), 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad session id %q", arg(1))
+		}
+		return server.BindUser(uint32(sessionId), arg(2))
+	case "latency":
+		ms, err := strconv.Atoi(arg(1))
+		if err != nil {
+			return fmt.Errorf("bad latency %q", arg(1))
+		}
+		server.SetLatency(time.Duration(ms) * time.Millisecond)
+	case "disconnect":
+		fmt.Printf("disconnected %d gate connections\n", server.Disconnect())
+	case "conns":
+		for _, conn := range server.Conns() {
+			fmt.Println(conn.RemoteAddr())
+		}
+	case "help":
+		fmt.Println(usage)
+	default:
+		return fmt.Errorf("unknown command %q, type help for commands", fields[0])
+	}
+	return nil
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// gatebench 网关压测工具, 模拟大量客户端通过websocket或tcp连接网关:
+//
+//	gatebench -url ws://127.0.0.1:9010/ -clients 100 -rate 10 -duration 30s
+//	gatebench -tcp 127.0.0.1:9020 -mix 65284:64-256:3,1001:32:1 -churn 5s
+//
+// 默认发送MsgIdEcho消息, 需要网关开启GateSrv.Echo; 消息内容前8字节为发送时间,
+// 收到相同msgId且带回发送时间的回包时统计延迟, 转发到后端的消息需要后端原样回包才有延迟数据
+func main() {
+	url := flag.String("url", "", "gate websocket url, e.g. ws://127.0.0.1:9010/")
+	tcpAddr := flag.String("tcp", "", "gate tcp address, e.g. 127.0.0.1:9020")
+	clients := flag.Int("clients", 10, "concurrent clients")
+	duration := flag.Duration("duration", 10*time.Second, "test duration")
+	rate := flag.Float64("rate", 10, "messages per second per client, 0 sends without limit")
+	mixText := flag.String("mix", fmt.Sprintf("%d:64-256", codec.MsgIdEcho), "message mix: msgId:size[-maxSize][:weight],...")
+	authMsgId := flag.Uint("auth-msgid", 0, "msgId of the auth message sent after connecting, 0 disables auth")
+	authPayload := flag.String("auth-payload", "", "auth message payload, %d is replaced by the client index")
+	authReply := flag.Uint("auth-reply", 0, "msgId of the auth reply to wait for, 0 does not wait")
+	authTimeout := flag.Duration("auth-timeout", 5*time.Second, "time to wait for the auth reply")
+	churn := flag.Duration("churn", 0, "reconnect each client after this long, 0 keeps connections open")
+	ramp := flag.Duration("ramp", 0, "spread client connects over this long")
+	drain := flag.Duration("drain", time.Second, "time to wait for replies after the test ends")
+	interval := flag.Duration("interval", time.Second, "progress report interval, 0 disables")
+	flag.Parse()
+
+	if (*url == "") == (*tcpAddr == "") || *clients <= 0 || *duration <= 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "gatebench: exactly one of -url or -tcp is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	mix, err := parseMix(*mixText)
+	if err != nil {
+		fatal(err)
+	}
+
+	b := &bench{
+		dial:        dialer(*url, *tcpAddr),
+		mix:         mix,
+		rate:        *rate,
+		authMsgId:   uint16(*authMsgId),
+		authPayload: *authPayload,
+		authReply:   uint16(*authReply),
+		authTimeout: *authTimeout,
+		churn:       *churn,
+		drain:       *drain,
+		stop:        make(chan bool),
+		errs:        make(map[string]uint64),
+	}
+	elapsed := b.execute(*clients, *ramp, *duration, *interval)
+	b.report(os.Stdout, elapsed)
+}
+
+func fatal(err error) {
+	_, _ = fmt.Fprintln(os.Stderr, "gatebench:", err)
+	os.Exit(1)
+}
+
+// dialer
+//
+//	@Description: 按地址创建连接函数, url不为空时使用websocket, 否则使用tcp
+//	@param url websocket地址
+//	@param tcpAddr tcp地址
+//	@return func() (iface.IConn, error)
+func dialer(url, tcpAddr string) func() (iface.IConn, error) {
+	return func() (iface.IConn, error) {
+		if url != "" {
+			conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+			if err != nil {
+				return nil, err
+			}
+			return codec.NewWebSocketConn(conn), nil
+		}
+		conn, err := net.DialTimeout("tcp", tcpAddr, 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return codec.NewTCPConn(conn), nil
+	}
+}
+
+// mixItem
+// @Description: 消息组成中的一项
+type mixItem struct {
+	msgId   uint16 // 消息ID
+	minSize int    // 最小长度
+	maxSize int    // 最大长度
+	weight  int    // 权重
+}
+
+// parseMix
+//
+//	@Description: 解析消息组成, 格式为 msgId:size[-maxSize][:weight],...
+//	@param text 文本
+//	@return []mixItem
+//	@return error
+func parseMix(text string) ([]mixItem, error) {
+	var items []mixItem
+	for _, part := range strings.Split(text, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("bad mix item %q, want msgId:size[-maxSize][:weight]", part)
+		}
+		msgId, err := strconv.ParseUint(fields[0], 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("bad mix msgId %q: %v", fields[0], err)
+		}
+		item := mixItem{msgId: uint16(msgId), weight: 1}
+		sizes := strings.SplitN(fields[1], "-", 2)
+		if item.minSize, err = strconv.Atoi(sizes[0]); err != nil || item.minSize < 0 {
+			return nil, fmt.Errorf("bad mix size %q", fields[1])
+		}
+		item.maxSize = item.minSize
+		if len(sizes) == 2 {
+			if item.maxSize, err = strconv.Atoi(sizes[1]); err != nil || item.maxSize < item.minSize {
+				return nil, fmt.Errorf("bad mix size %q", fields[1])
+			}
+		}
+		if len(fields) == 3 {
+			if item.weight, err = strconv.Atoi(fields[2]); err != nil || item.weight <= 0 {
+				return nil, fmt.Errorf("bad mix weight %q", fields[2])
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// pick
+//
+//	@Description: 按权重随机选择一项并生成消息内容, 长度不小于8时前8字节为发送时间
+//	@param items 消息组成
+//	@param rnd 随机数
+//	@return uint16 消息ID
+//	@return []byte 消息内容
+func pick(items []mixItem, rnd *rand.Rand) (uint16, []byte) {
+	total := 0
+	for _, item := range items {
+		total += item.weight
+	}
+	n := rnd.Intn(total)
+	item := items[0]
+	for _, it := range items {
+		if n < it.weight {
+			item = it
+			break
+		}
+		n -= it.weight
+	}
+	size := item.minSize
+	if item.maxSize > item.minSize {
+		size += rnd.Intn(item.maxSize - item.minSize + 1)
+	}
+	data := make([]byte, size)
+	rnd.Read(data)
+	if size >= 8 {
+		binary.BigEndian.PutUint64(data, uint64(time.Now().UnixNano()))
+	}
+	return item.msgId, data
+}
+
+// bench
+// @Description: 压测状态和统计
+type bench struct {
+	dial        func() (iface.IConn, error) // 建立连接
+	mix         []mixItem                   // 消息组成
+	rate        float64                     // 单客户端每秒消息数
+	authMsgId   uint16                      // 登录消息ID
+	authPayload string                      // 登录消息内容
+	authReply   uint16                      // 登录回包消息ID
+	authTimeout time.Duration               // 登录超时
+	churn       time.Duration               // 重连间隔
+	drain       time.Duration               // 结束后等待回包的时间
+	start       time.Time                   // 开始时间
+	stop        chan bool                   // 结束信号
+
+	connects   atomic.Uint64 // 连接成功次数
+	connFails  atomic.Uint64 // 连接失败次数
+	reconnects atomic.Uint64 // 主动重连次数
+	sent       atomic.Uint64 // 发送消息数
+	sentBytes  atomic.Uint64 // 发送字节数(含头部)
+	recv       atomic.Uint64 // 收到消息数
+	recvBytes  atomic.Uint64 // 收到字节数(含头部)
+
+	lock      sync.Mutex        // 保护以下字段
+	errs      map[string]uint64 // 错误计数
+	latencies []time.Duration   // 延迟样本
+}
+
+// execute
+//
+//	@Description: 启动全部客户端, 到达压测时长后通知结束, 等待客户端收完回包退出
+//	@receiver b
+//	@param clients 客户端数量
+//	@param ramp 客户端分散连接的时长
+//	@param duration 压测时长
+//	@param interval 进度输出间隔, 0为不输出
+//	@return time.Duration 压测时长, 不含结束后等待回包的时间
+func (b *bench) execute(clients int, ramp, duration, interval time.Duration) time.Duration {
+	b.start = time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		delay := time.Duration(0)
+		if ramp > 0 {
+			delay = ramp * time.Duration(i) / time.Duration(clients)
+		}
+		go func(index int, delay time.Duration) {
+			defer wg.Done()
+			b.client(index, delay)
+		}(i, delay)
+	}
+	if interval > 0 {
+		go b.progress(interval)
+	}
+	time.Sleep(duration)
+	close(b.stop)
+	elapsed := time.Since(b.start)
+	wg.Wait()
+	return elapsed
+}
+
+func (b *bench) fail(kind string, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.errs[kind]++
+	if b.errs[kind] == 1 {
+		_, _ = fmt.Fprintf(os.Stderr, "gatebench: first %s error: %v\n", kind, err)
+	}
+}
+
+func (b *bench) stopped() bool {
+	select {
+	case <-b.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// client
+//
+//	@Description: 单个客户端, 断线或到达重连间隔后重新连接, 直到压测结束
+//	@receiver b
+//	@param index 客户端序号
+//	@param delay 开始前等待时间
+func (b *bench) client(index int, delay time.Duration) {
+	select {
+	case <-b.stop:
+		return
+	case <-time.After(delay):
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(index)))
+	for first := true; !b.stopped(); first = false {
+		conn, err := b.dial()
+		if err != nil {
+			b.connFails.Add(1)
+			b.fail("dial", err)
+			select {
+			case <-b.stop:
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+		b.connects.Add(1)
+		if !first {
+			b.reconnects.Add(1)
+		}
+		b.run(index, conn, rnd)
+	}
+}
+
+// run
+//
+//	@Description: 在一个连接上登录并按频率发送消息, 连接出错、到达重连间隔或压测结束时返回
+//	@receiver b
+//	@param index 客户端序号
+//	@param conn 连接
+//	@param rnd 随机数
+func (b *bench) run(index int, conn iface.IConn, rnd *rand.Rand) {
+	authed := make(chan bool)
+	closed := make(chan bool)
+	go b.read(conn, authed, closed)
+	defer func() {
+		_ = conn.Close()
+		<-closed
+	}()
+
+	stream := codec.NewStream()
+	send := func(msgId uint16, data []byte) bool {
+		frame := stream.Marshal(codec.NewMessage(msgId, 0, data))
+		if err := conn.WriteData(frame); err != nil {
+			b.fail("write", err)
+			return false
+		}
+		b.sent.Add(1)
+		b.sentBytes.Add(uint64(len(frame)))
+		return true
+	}
+
+	if b.authMsgId != 0 {
+		payload := strings.ReplaceAll(b.authPayload, "%d", strconv.Itoa(index))
+		if !send(b.authMsgId, []byte(payload)) {
+			return
+		}
+		if b.authReply != 0 {
+			select {
+			case <-authed:
+			case <-closed:
+				return
+			case <-b.stop:
+				return
+			case <-time.After(b.authTimeout):
+				b.fail("auth", fmt.Errorf("no reply %d within %s", b.authReply, b.authTimeout))
+				return
+			}
+		}
+	}
+
+	var churn <-chan time.Time
+	if b.churn > 0 {
+		churn = time.After(b.churn)
+	}
+	var tick <-chan time.Time
+	if b.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / b.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-churn:
+				return
+			case <-closed:
+				return
+			case <-b.stop:
+				b.wait(closed)
+				return
+			}
+		} else {
+			select {
+			case <-churn:
+				return
+			case <-closed:
+				return
+			case <-b.stop:
+				b.wait(closed)
+				return
+			default:
+			}
+		}
+		if !send(pick(b.mix, rnd)) {
+			return
+		}
+	}
+}
+
+// wait
+//
+//	@Description: 压测结束后等待在途回包
+//	@receiver b
+//	@param closed 连接关闭信号
+func (b *bench) wait(closed chan bool) {
+	select {
+	case <-closed:
+	case <-time.After(b.drain):
+	}
+}
+
+// read
+//
+//	@Description: 读取回包, 统计数量和延迟
+//	@receiver b
+//	@param conn 连接
+//	@param authed 收到登录回包时关闭
+//	@param closed 读取结束时关闭
+func (b *bench) read(conn iface.IConn, authed, closed chan bool) {
+	defer close(closed)
+	stream := codec.NewStream()
+	authDone := false
+	var samples []time.Duration
+	defer func() {
+		b.lock.Lock()
+		b.latencies = append(b.latencies, samples...)
+		b.lock.Unlock()
+	}()
+	for {
+		data, err := conn.ReadData()
+		if err != nil {
+			if !b.stopped() && !errors.Is(err, net.ErrClosed) {
+				b.fail("read", err)
+			}
+			return
+		}
+		for readLen := 0; readLen < len(data); {
+			n, msg, err := stream.Unmarshal(data[readLen:])
+			if err != nil {
+				b.fail("decode", err)
+				return
+			}
+			readLen += n
+			if msg == nil {
+				continue
+			}
+			b.recv.Add(1)
+			b.recvBytes.Add(uint64(codec.HeaderSize + msg.GetMsgLen()))
+			if !authDone && b.authReply != 0 && msg.GetMsgId() == b.authReply {
+				authDone = true
+				close(authed)
+				continue
+			}
+			if latency, ok := b.latency(msg); ok {
+				samples = append(samples, latency)
+			}
+		}
+	}
+}
+
+// latency
+//
+//	@Description: 回包为压测消息且带回发送时间时计算延迟
+//	@receiver b
+//	@param msg 回包
+//	@return time.Duration
+//	@return bool
+func (b *bench) latency(msg iface.IMessage) (time.Duration, bool) {
+	if msg.GetMsgLen() < 8 {
+		return 0, false
+	}
+	for _, item := range b.mix {
+		if item.msgId != msg.GetMsgId() {
+			continue
+		}
+		sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(msg.GetMsgData())))
+		if sentAt.Before(b.start) || sentAt.After(time.Now()) {
+			return 0, false
+		}
+		return time.Since(sentAt), true
+	}
+	return 0, false
+}
+
+// progress
+//
+//	@Description: 定时输出进度
+//	@receiver b
+//	@param interval 间隔
+func (b *bench) progress(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastSent, lastRecv uint64
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			sent, recv := b.sent.Load(), b.recv.Load()
+			fmt.Printf("%8.1fs conns %d fails %d sent %d/s recv %d/s\n", time.Since(b.start).Seconds(), b.connects.Load(), b.connFails.Load(),
+				uint64(float64(sent-lastSent)/interval.Seconds()), uint64(float64(recv-lastRecv)/interval.Seconds()))
+			lastSent, lastRecv = sent, recv
+		}
+	}
+}
+
+// report
+//
+//	@Description: 输出汇总结果
+//	@receiver b
+//	@param w 输出
+//	@param elapsed 压测时长, 不含结束后等待回包的时间
+func (b *bench) report(w io.Writer, elapsed time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	seconds := elapsed.Seconds()
+	_, _ = fmt.Fprintf(w, "\nduration:   %s\n", elapsed.Round(time.Millisecond))
+	_, _ = fmt.Fprintf(w, "connects:   ok %d, failed %d, reconnects %d\n", b.connects.Load(), b.connFails.Load(), b.reconnects.Load())
+	_, _ = fmt.Fprintf(w, "sent:       %d msgs (%.1f/s), %d bytes (%.1f KB/s)\n", b.sent.Load(), float64(b.sent.Load())/seconds,
+		b.sentBytes.Load(), float64(b.sentBytes.Load())/seconds/1024)
+	_, _ = fmt.Fprintf(w, "recv:       %d msgs (%.1f/s), %d bytes (%.1f KB/s)\n", b.recv.Load(), float64(b.recv.Load())/seconds,
+		b.recvBytes.Load(), float64(b.recvBytes.Load())/seconds/1024)
+	if n := len(b.latencies); n > 0 {
+		sort.Slice(b.latencies, func(i, j int) bool {
+			return b.latencies[i] < b.latencies[j]
+		})
+		at := func(p float64) time.Duration {
+			return b.latencies[int(p*float64(n-1))]
+		}
+		_, _ = fmt.Fprintf(w, "latency:    samples %d, p50 %s, p90 %s, p99 %s, max %s\n", n, at(0.5), at(0.9), at(0.99), b.latencies[n-1])
+	} else {
+		_, _ = fmt.Fprintln(w, "latency:    no samples")
+	}
+	kinds := make([]string, 0, len(b.errs))
+	for kind := range b.errs {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	_, _ = fmt.Fprint(w, "errors:    ")
+	if len(kinds) == 0 {
+		_, _ = fmt.Fprint(w, " none")
+	}
+	for _, kind := range kinds {
+		_, _ = fmt.Fprintf(w, " %s %d", kind, b.errs[kind])
+	}
+	_, _ = fmt.Fprintln(w)
+}
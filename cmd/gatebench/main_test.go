@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/fakebackend"
+	"github.com/liaoyudong2/GateServer/gatetest"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain 测试日志不写文件, 需要检查日志的用例自行调用zlog.StartCapture
+func TestMain(m *testing.M) {
+	zlog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestParseMix(t *testing.T) {
+	items, err := parseMix(fmt.Sprintf("%d:64-256:3, 0x3e9:32:1,1002:0", codec.MsgIdEcho))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mixItem{
+		{msgId: codec.MsgIdEcho, minSize: 64, maxSize: 256, weight: 3},
+		{msgId: 1001, minSize: 32, maxSize: 32, weight: 1},
+		{msgId: 1002, minSize: 0, maxSize: 0, weight: 1},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("parsed %+v, want %+v", items, want)
+	}
+
+	for text, want := range map[string]string{
+		"":           "bad mix item",
+		"1001":       "bad mix item",
+		"1001:1:1:1": "bad mix item",
+		"x:1":        "bad mix msgId",
+		"70000:1":    "bad mix msgId",
+		"1001:-1":    "bad mix size",
+		"1001:a":     "bad mix size",
+		"1001:8-4":   "bad mix size",
+		"1001:8-x":   "bad mix size",
+		"1001:8:0":   "bad mix weight",
+		"1001:8:a":   "bad mix weight",
+		"1001:8,":    "bad mix item",
+	} {
+		if _, err = parseMix(text); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseMix(%q): got %v, want %q", text, err, want)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	items := []mixItem{{msgId: 1, minSize: 8, maxSize: 16, weight: 3}, {msgId: 2, minSize: 4, maxSize: 4, weight: 1}}
+	rnd := rand.New(rand.NewSource(1))
+	counts := map[uint16]int{}
+	before := time.Now()
+	for i := 0; i < 4000; i++ {
+		msgId, data := pick(items, rnd)
+		counts[msgId]++
+		switch msgId {
+		case 1:
+			// 长度不小于8时前8字节为发送时间
+			if len(data) < 8 || len(data) > 16 {
+				t.Fatalf("msgId 1 size %d", len(data))
+			}
+			sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+			if sentAt.Before(before) || sentAt.After(time.Now()) {
+				t.Fatalf("send time %s not stamped", sentAt)
+			}
+		case 2:
+			if len(data) != 4 {
+				t.Fatalf("msgId 2 size %d", len(data))
+			}
+		}
+	}
+	// 按权重3:1分配
+	if counts[1] < 2700 || counts[1] > 3300 || counts[1]+counts[2] != 4000 {
+		t.Fatalf("picked %v, want about 3000/1000", counts)
+	}
+}
+
+// newBench 创建压测, 默认发送回显消息
+func newBench(dial func() (iface.IConn, error), rate float64) *bench {
+	mix, _ := parseMix(fmt.Sprintf("%d:16-64", codec.MsgIdEcho))
+	return &bench{
+		dial:        dial,
+		mix:         mix,
+		rate:        rate,
+		authTimeout: time.Second,
+		drain:       time.Second,
+		stop:        make(chan bool),
+		errs:        make(map[string]uint64),
+	}
+}
+
+func TestBenchEcho(t *testing.T) {
+	gate := gatetest.Start(t)
+	gate.Service.SetEcho(true)
+	for name, dial := range map[string]func() (iface.IConn, error){
+		"ws":  dialer(gate.URL(), ""),
+		"tcp": dialer("", gate.Service.TCPAddr()),
+	} {
+		b := newBench(dial, 50)
+		elapsed := b.execute(3, 20*time.Millisecond, 200*time.Millisecond, 50*time.Millisecond)
+
+		// 网关回显全部消息, 每条回包都有延迟数据
+		if b.connects.Load() != 3 || b.sent.Load() == 0 || b.recv.Load() != b.sent.Load() || len(b.errs) != 0 {
+			t.Fatalf("%s: connects %d sent %d recv %d errors %v", name, b.connects.Load(), b.sent.Load(), b.recv.Load(), b.errs)
+		}
+		if uint64(len(b.latencies)) != b.recv.Load() || b.recvBytes.Load() != b.sentBytes.Load() {
+			t.Fatalf("%s: %d latency samples, recv %d bytes, sent %d bytes", name, len(b.latencies), b.recvBytes.Load(), b.sentBytes.Load())
+		}
+		var out bytes.Buffer
+		b.report(&out, elapsed)
+		for _, want := range []string{"connects:   ok 3, failed 0, reconnects 0", fmt.Sprintf("latency:    samples %d, p50 ", len(b.latencies)), "errors:     none"} {
+			if !strings.Contains(out.String(), want) {
+				t.Fatalf("%s: report missing %q:\n%s", name, want, out.String())
+			}
+		}
+		gate.WaitSessions(0)
+	}
+}
+
+func TestBenchChurn(t *testing.T) {
+	gate := gatetest.Start(t)
+	gate.Service.SetEcho(true)
+
+	// 到达重连间隔后重新连接, 不限速发送会写满网关写队列而被关闭, 这里限速
+	b := newBench(dialer("", gate.Service.TCPAddr()), 200)
+	b.churn = 50 * time.Millisecond
+	b.execute(2, 0, 300*time.Millisecond, 0)
+	if b.reconnects.Load() == 0 || b.connects.Load() != b.reconnects.Load()+2 || len(b.errs) != 0 {
+		t.Fatalf("connects %d reconnects %d errors %v", b.connects.Load(), b.reconnects.Load(), b.errs)
+	}
+	if b.recv.Load() == 0 {
+		t.Fatal("no replies")
+	}
+	gate.WaitSessions(0)
+}
+
+func TestBenchAuth(t *testing.T) {
+	gate := gatetest.Start(t)
+	gate.Service.SetEcho(true)
+	gate.Backend.On(1001, fakebackend.Rule{Replies: []fakebackend.Reply{{MsgId: 1002, Data: []byte("ok")}}})
+
+	// 连接后先发送登录消息, 收到回包后开始压测
+	b := newBench(dialer(gate.URL(), ""), 50)
+	b.authMsgId, b.authPayload, b.authReply = 1001, "user-%d", 1002
+	b.execute(2, 0, 100*time.Millisecond, 0)
+	if len(b.errs) != 0 || b.recv.Load() <= 2 {
+		t.Fatalf("recv %d errors %v", b.recv.Load(), b.errs)
+	}
+	payloads := map[string]bool{}
+	for _, req := range gate.Backend.Received() {
+		if req.MsgId == 1001 {
+			payloads[string(req.Data)] = true
+		}
+	}
+	if !reflect.DeepEqual(payloads, map[string]bool{"user-0": true, "user-1": true}) {
+		t.Fatalf("auth payloads %v", payloads)
+	}
+
+	// 等不到登录回包时计为登录错误
+	b = newBench(dialer(gate.URL(), ""), 50)
+	b.authMsgId, b.authReply, b.authTimeout = 1001, 1003, 20*time.Millisecond
+	b.execute(1, 0, 100*time.Millisecond, 0)
+	if b.errs["auth"] == 0 {
+		t.Fatalf("errors %v, want auth errors", b.errs)
+	}
+}
+
+func TestBenchDialFail(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	b := newBench(dialer("", addr), 10)
+	elapsed := b.execute(1, 0, 150*time.Millisecond, 0)
+	if b.connects.Load() != 0 || b.connFails.Load() == 0 || b.errs["dial"] != b.connFails.Load() {
+		t.Fatalf("connects %d fails %d errors %v", b.connects.Load(), b.connFails.Load(), b.errs)
+	}
+	var out bytes.Buffer
+	b.report(&out, elapsed)
+	if !strings.Contains(out.String(), "latency:    no samples") || !strings.Contains(out.String(), fmt.Sprintf("errors:     dial %d", b.connFails.Load())) {
+		t.Fatalf("report:\n%s", out.String())
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/liaoyudong2/GateServer/codec"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/record"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// gatereplay 读取网关录制的流量文件(.grec):
+//
+//	gatereplay -file x.grec                           打印全部帧
+//	gatereplay -file x.grec -gate ws://127.0.0.1:9010/ 作为客户端重放上行帧到网关
+//	gatereplay -file x.grec -backend 127.0.0.1:7010   作为网关重放上行帧到后端(保留字段为会话ID)
+func main() {
+	file := flag.String("file", "", "record file (.grec)")
+	gate := flag.String("gate", "", "replay inbound frames to a gate websocket url, e.g. ws://127.0.0.1:9010/")
+	backend := flag.String("backend", "", "replay inbound frames to a backend tcp address, e.g. 127.0.0.1:7010")
+	sessionId := flag.Uint("session", 0, "session id used as reserve when replaying to a backend, default the recorded one")
+	speed := flag.Float64("speed", 1, "replay speed factor, 0 sends without delay")
+	wait := flag.Duration("wait", time.Second, "time to wait for replies after the last frame")
+	payload := flag.Int("payload", 32, "payload bytes printed per frame, -1 prints all")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	in, err := os.Open(*file)
+	if err != nil {
+		fatal(err)
+	}
+	defer in.Close()
+	reader, err := record.NewReader(in)
+	if err != nil {
+		fatal(err)
+	}
+	header := reader.Header()
+	fmt.Printf("session: %d trace: %s start: %s\n", header.SessionId, gatenet.FormatTraceId(header.TraceId), header.StartTime.Format(time.RFC3339Nano))
+
+	printer := &framePrinter{out: os.Stdout, start: header.StartTime, payload: *payload}
+	switch {
+	case *gate != "":
+		err = replayGate(reader, *gate, *speed, *wait, printer)
+	case *backend != "":
+		reserve := header.SessionId
+		if *sessionId != 0 {
+			reserve = uint32(*sessionId)
+		}
+		err = replayBackend(reader, *backend, reserve, *speed, *wait, printer)
+	default:
+		err = dump(reader, printer)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	_, _ = fmt.Fprintln(os.Stderr, "gatereplay:", err)
+	os.Exit(1)
+}
+
+// framePrinter
+// @Description: 帧输出格式: 相对时间 方向 msgId 长度 内容
+type framePrinter struct {
+	lock    sync.Mutex // 收发协程并发输出
+	out     io.Writer  // 输出
+	start   time.Time  // 录制开始时间
+	payload int        // 打印的内容字节数
+}
+
+func (p *framePrinter) print(at time.Time, dir string, msgId uint16, data []byte) {
+	shown := data
+	if p.payload >= 0 && len(shown) > p.payload {
+		shown = shown[:p.payload]
+	}
+	p.printf("%12.6f %-4s msgId=%-5d len=%-6d %s\n", at.Sub(p.start).Seconds(), dir, msgId, len(data), hex.EncodeToString(shown))
+}
+
+func (p *framePrinter) printf(format string, a ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, _ = fmt.Fprintf(p.out, format, a...)
+}
+
+// dump
+//
+//	@Description: 打印全部帧
+//	@param reader 录制读取
+//	@param printer 输出
+//	@return error
+func dump(reader *record.Reader, printer *framePrinter) error {
+	counts := map[uint8]int{}
+	for {
+		frame, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			printer.printf("frames: in %d, out %d\n", counts[record.DirIn], counts[record.DirOut])
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		counts[frame.Dir]++
+		printer.print(frame.Time, record.DirName(frame.Dir), frame.MsgId, frame.Data)
+	}
+}
+
+// replay
+//
+//	@Description: 按录制时的间隔发送上行帧, 下行帧只用于对照
+//	@param reader 录制读取
+//	@param speed 速度倍数, 0为不等待
+//	@param send 发送
+//	@return int 发送的帧数
+//	@return error
+func replay(reader *record.Reader, speed float64, send func(frame *record.Frame) error) (int, error) {
+	begin := time.Now()
+	start := reader.Header().StartTime
+	sent := 0
+	for {
+		frame, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return sent, nil
+		}
+		if err != nil {
+			return sent, err
+		}
+		if frame.Dir != record.DirIn {
+			continue
+		}
+		if speed > 0 {
+			due := begin.Add(time.Duration(float64(frame.Time.Sub(start)) / speed))
+			time.Sleep(time.Until(due))
+		}
+		if err = send(frame); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+}
+
+// replayGate
+//
+//	@Description: 作为客户端连接网关, 重放上行帧并打印收到的下行帧
+//	@param reader 录制读取
+//	@param url 网关地址
+//	@param speed 速度倍数
+//	@param wait 发送完成后等待回包的时间
+//	@param printer 输出
+//	@return error
+func replayGate(reader *record.Reader, url string, speed float64, wait time.Duration, printer *framePrinter) error {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	begin := time.Now()
+	printer.start = begin
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		stream := codec.NewStream()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			readMessages(stream, data, func(msg iface.IMessage) {
+				printer.print(time.Now(), "recv", msg.GetMsgId(), msg.GetMsgData())
+			})
+		}
+	}()
+
+	stream := codec.NewStream()
+	sent, err := replay(reader, speed, func(frame *record.Frame) error {
+		printer.print(time.Now(), "send", frame.MsgId, frame.Data)
+		return conn.WriteMessage(websocket.BinaryMessage, stream.Marshal(codec.NewMessage(frame.MsgId, 0, frame.Data)))
+	})
+	printer.printf("sent %d frames in %s\n", sent, time.Since(begin))
+	if err != nil {
+		return err
+	}
+	select {
+	case <-done:
+	case <-time.After(wait):
+	}
+	return nil
+}
+
+// replayBackend
+//
+//	@Description: 作为网关连接后端, 以会话ID为保留字段重放上行帧并打印后端回包
+//	@param reader 录制读取
+//	@param addr 后端地址
+//	@param sessionId 会话ID
+//	@param speed 速度倍数
+//	@param wait 发送完成后等待回包的时间
+//	@param printer 输出
+//	@return error
+func replayBackend(reader *record.Reader, addr string, sessionId uint32, speed float64, wait time.Duration, printer *framePrinter) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	begin := time.Now()
+	printer.start = begin
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		stream := codec.NewStream()
+		buf := make([]byte, 64<<10)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			readMessages(stream, buf[:n], func(msg iface.IMessage) {
+				printer.print(time.Now(), "recv", msg.GetMsgId(), msg.GetMsgData())
+			})
+		}
+	}()
+
+	stream := codec.NewStream()
+	sent, err := replay(reader, speed, func(frame *record.Frame) error {
+		printer.print(time.Now(), "send", frame.MsgId, frame.Data)
+		_, err := conn.Write(stream.Marshal(codec.NewMessage(frame.MsgId, sessionId, frame.Data)))
+		return err
+	})
+	printer.printf("sent %d frames in %s\n", sent, time.Since(begin))
+	if err != nil {
+		return err
+	}
+	select {
+	case <-done:
+	case <-time.After(wait):
+	}
+	return nil
+}
+
+// readMessages
+//
+//	@Description: 解出数据中的全部完整消息
+//	@param stream 解析
+//	@param data 数据
+//	@param handle 处理
+func readMessages(stream iface.IStream, data []byte, handle func(msg iface.IMessage)) {
+	for readLen := 0; readLen < len(data); {
+		n, msg, err := stream.Unmarshal(data[readLen:])
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "gatereplay: unmarshal error:", err)
+			return
+		}
+		readLen += n
+		if msg != nil {
+			handle(msg)
+		}
+	}
+}
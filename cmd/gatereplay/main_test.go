@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/liaoyudong2/GateServer/fakebackend"
+	"github.com/liaoyudong2/GateServer/gatetest"
+	"github.com/liaoyudong2/GateServer/record"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain 测试日志不写文件, 需要检查日志的用例自行调用zlog.StartCapture
+func TestMain(m *testing.M) {
+	zlog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// replayGap 录制中两条上行帧之间的间隔
+const replayGap = 100 * time.Millisecond
+
+// newRecord 录制 in 101, out 101, 间隔replayGap后 in 102, 返回录制内容
+func newRecord(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := record.NewWriter(&buf, record.Header{SessionId: 7, TraceId: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Write(record.DirIn, 101, []byte("first"))
+	_ = w.Write(record.DirOut, 101, []byte("reply"))
+	time.Sleep(replayGap)
+	_ = w.Write(record.DirIn, 102, []byte("second"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newReader(t *testing.T, data []byte) *record.Reader {
+	t.Helper()
+	reader, err := record.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func TestReplay(t *testing.T) {
+	data := newRecord(t)
+	// 最后一帧在录制中的时间
+	reader := newReader(t, data)
+	var last time.Duration
+	for {
+		frame, err := reader.Next()
+		if err != nil {
+			break
+		}
+		last = frame.Time.Sub(reader.Header().StartTime)
+	}
+
+	for _, c := range []struct {
+		speed    float64
+		min, max time.Duration
+	}{{1, last, 0}, {2, last / 2, last}, {0, 0, last / 2}} {
+		var sent []string
+		begin := time.Now()
+		var elapsed time.Duration
+		n, err := replay(newReader(t, data), c.speed, func(frame *record.Frame) error {
+			sent = append(sent, string(frame.Data))
+			elapsed = time.Since(begin)
+			return nil
+		})
+		// 只重放上行帧
+		if err != nil || n != 2 || !reflect.DeepEqual(sent, []string{"first", "second"}) {
+			t.Fatalf("speed %v: sent %d %q, %v", c.speed, n, sent, err)
+		}
+		if elapsed < c.min || (c.max > 0 && elapsed >= c.max) {
+			t.Errorf("speed %v: last frame at %s, want [%s, %s)", c.speed, elapsed, c.min, c.max)
+		}
+	}
+
+	// 发送失败时停止
+	boom := errors.New("boom")
+	n, err := replay(newReader(t, data), 0, func(frame *record.Frame) error {
+		return boom
+	})
+	if n != 0 || !errors.Is(err, boom) {
+		t.Fatalf("sent %d, %v", n, err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	var out bytes.Buffer
+	reader := newReader(t, newRecord(t))
+	if err := dump(reader, &framePrinter{out: &out, start: reader.Header().StartTime, payload: 2}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || lines[3] != "frames: in 2, out 1" {
+		t.Fatalf("dump output %q", out.String())
+	}
+	// 内容按payload截断
+	if !strings.Contains(lines[0], "in   msgId=101   len=5      6669") || strings.Contains(lines[0], "666972") {
+		t.Fatalf("frame line %q", lines[0])
+	}
+}
+
+func TestReplayBackend(t *testing.T) {
+	backend := fakebackend.New()
+	if err := backend.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	var out bytes.Buffer
+	printer := &framePrinter{out: &out, payload: -1}
+	if err := replayBackend(newReader(t, newRecord(t)), backend.Addr(), 42, 0, 200*time.Millisecond, printer); err != nil {
+		t.Fatal(err)
+	}
+	// 保留字段为指定的会话ID
+	for _, msgId := range []uint16{101, 102} {
+		req, err := backend.WaitMsg(msgId, gatetest.DefaultTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.SessionId != 42 {
+			t.Fatalf("msgId %d replayed with session %d", msgId, req.SessionId)
+		}
+	}
+	if !strings.Contains(out.String(), "sent 2 frames") || !strings.Contains(out.String(), "recv msgId=102") {
+		t.Fatalf("output %q", out.String())
+	}
+}
+
+func TestReplayGate(t *testing.T) {
+	gate := gatetest.Start(t)
+	var out bytes.Buffer
+	printer := &framePrinter{out: &out, payload: -1}
+	if err := replayGate(newReader(t, newRecord(t)), gate.URL(), 0, 200*time.Millisecond, printer); err != nil {
+		t.Fatal(err)
+	}
+	for _, msgId := range []uint16{101, 102} {
+		if _, err := gate.Backend.WaitMsg(msgId, gatetest.DefaultTimeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 后端回显的下行帧
+	printer.lock.Lock()
+	defer printer.lock.Unlock()
+	for _, want := range []string{"sent 2 frames", "recv msgId=101   len=5      6669727374", "recv msgId=102"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("output %q, want %q", out.String(), want)
+		}
+	}
+}
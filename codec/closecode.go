@@ -0,0 +1,101 @@
+package codec
+
+import (
+	"encoding/binary"
+	"unicode/utf8"
+)
+
+// 会话关闭码, websocket连接作为关闭帧的状态码发送, tcp连接随MsgIdDisconnect发送.
+// 1000-2999沿用RFC 6455的定义, 4000起为网关自定义
+const (
+	CloseNormal        uint16 = 1000 // 正常关闭
+	CloseShutdown      uint16 = 1001 // 网关停止(Going Away)
+	CloseProtocolError uint16 = 1002 // 协议错误, 消息无法解析
+	CloseInternalError uint16 = 1011 // 网关内部错误
+	CloseOverflow      uint16 = 1013 // 会话已满(Try Again Later)
+	CloseIdle          uint16 = 4000 // 长时间没有操作
+	CloseKicked        uint16 = 4001 // 被踢下线
+	CloseAuthFailed    uint16 = 4002 // 登录验证失败
+	CloseTooSlow       uint16 = 4003 // 客户端接收过慢, 写队列已满
+)
+
+// MaxCloseReason 关闭原因的最大字节数, websocket控制帧最长125字节, 去掉2字节关闭码
+const MaxCloseReason = 123
+
+// closeTexts 关闭码的默认原因
+var closeTexts = map[uint16]string{
+	CloseNormal:        "normal",
+	CloseShutdown:      "shutdown",
+	CloseProtocolError: "protocol error",
+	CloseInternalError: "internal error",
+	CloseOverflow:      "overflow",
+	CloseIdle:          "idle",
+	CloseKicked:        "kicked",
+	CloseAuthFailed:    "auth failed",
+	CloseTooSlow:       "too slow",
+}
+
+// CloseText
+//
+//	@Description: 关闭码的默认原因, 未定义的关闭码返回空
+//	@param code 关闭码
+//	@return string
+func CloseText(code uint16) string {
+	return closeTexts[code]
+}
+
+// IsValidCloseCode
+//
+//	@Description: 是否可以在websocket关闭帧中发送, 1004-1006和1015为保留值
+//	@param code 关闭码
+//	@return bool
+func IsValidCloseCode(code uint16) bool {
+	return (code >= 1000 && code <= 1003) || (code >= 1007 && code <= 1014) || (code >= 3000 && code <= 4999)
+}
+
+// CloseReason
+//
+//	@Description: 截断到MaxCloseReason字节, 不截断UTF-8字符, 为空时使用关闭码的默认原因
+//	@param code 关闭码
+//	@param reason 原因
+//	@return string
+func CloseReason(code uint16, reason string) string {
+	if reason == "" {
+		return CloseText(code)
+	}
+	if len(reason) <= MaxCloseReason {
+		return reason
+	}
+	n := MaxCloseReason
+	for n > 0 && !utf8.RuneStart(reason[n]) {
+		n--
+	}
+	return reason[:n]
+}
+
+// DisconnectData
+//
+//	@Description: MsgIdDisconnect的内容
+//	@param code 关闭码
+//	@param reason 原因, 按CloseReason截断
+//	@return []byte
+func DisconnectData(code uint16, reason string) []byte {
+	reason = CloseReason(code, reason)
+	data := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(data, code)
+	copy(data[2:], reason)
+	return data
+}
+
+// ParseDisconnect
+//
+//	@Description: 解析MsgIdDisconnect的内容
+//	@param data 消息内容
+//	@return code 关闭码, 内容不足2字节时为0
+//	@return reason 原因
+func ParseDisconnect(data []byte) (code uint16, reason string) {
+	if len(data) < 2 {
+		return 0, ""
+	}
+	return binary.BigEndian.Uint16(data), string(data[2:])
+}
@@ -0,0 +1,155 @@
+// Package codec 网关协议的消息帧编解码, 网关、后端和客户端共用, 避免各自实现后格式不一致
+//
+// 消息帧(大端): size(4) + msgId(2) + reserve(4) + data(size), 客户端与网关之间reserve为0,
+// 网关与后端之间reserve为会话ID
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/net/iface"
+)
+
+// HeaderSize 头部固定大小
+const HeaderSize = 10
+
+type Message struct {
+	msgSize uint32 // 消息长度
+	msgId   uint16 // 消息id
+	reserve uint32 // 保留字段(SessionID)
+	msgData []byte // 消息内容
+}
+
+func (m Message) GetMsgId() uint16 {
+	return m.msgId
+}
+
+func (m Message) GetMsgLen() int {
+	if m.msgData != nil {
+		return len(m.msgData)
+	}
+	return 0
+}
+
+func (m Message) GetMsgData() []byte {
+	return m.msgData
+}
+
+func (m Message) GetReserve() uint32 {
+	return m.reserve
+}
+
+// NewMessage
+//
+//	@Description: 创建消息
+//	@param msgId 消息id
+//	@param reserve 保留字段(与后端通信时为SessionID)
+//	@param data 消息内容
+//	@return iface.IMessage
+func NewMessage(msgId uint16, reserve uint32, data []byte) iface.IMessage {
+	return &Message{
+		msgSize: uint32(len(data)),
+		msgId:   msgId,
+		reserve: reserve,
+		msgData: data,
+	}
+}
+
+// Stream
+// @Description: 流式解码器, 接收不完整的数据时缓存到下次调用
+type Stream struct {
+	header  []byte // 不足信息时的头部缓冲区
+	frame   *Frame // 正在接收的消息帧
+	fill    int    // 消息帧已接收的长度
+	maxSize uint32 // 最大消息长度限制
+}
+
+// NewStream
+//
+//	@Description: 创建解码器, 默认最大消息长度64K
+//	@return *Stream
+func NewStream() *Stream {
+	return &Stream{
+		header:  make([]byte, 0, HeaderSize),
+		maxSize: 0x10000,
+	}
+}
+
+// UnmarshalFrame
+//
+//	@Description: 解包到池中分配的帧, 不复制内容, 调用者持有返回帧的引用
+//	@receiver s
+//	@param data 流数据
+//	@return int 已读取长度
+//	@return *Frame 完整的消息帧, 数据不足时为nil
+//	@return error
+func (s *Stream) UnmarshalFrame(data []byte) (int, *Frame, error) {
+	readLen := 0
+	if s.frame == nil {
+		// 缺多少头部
+		lessLen := HeaderSize - len(s.header)
+		if len(data) < lessLen {
+			s.header = append(s.header, data...)
+			// 头部长度不足, 下一次继续
+			return len(data), nil, nil
+		}
+		s.header = append(s.header, data[:lessLen]...)
+		readLen += lessLen
+		msgSize := binary.BigEndian.Uint32(s.header)
+		if msgSize > s.maxSize {
+			s.header = s.header[:0]
+			return readLen, nil, errors.New(fmt.Sprintf("message size overflow, limit size is %d", s.maxSize))
+		}
+		s.frame = newFrame(HeaderSize + int(msgSize))
+		s.fill = copy(s.frame.buf, s.header)
+		s.header = s.header[:0]
+	}
+	// 解析body, 不足时下一次继续
+	n := copy(s.frame.buf[s.fill:], data[readLen:])
+	readLen += n
+	s.fill += n
+	if s.fill < len(s.frame.buf) {
+		return readLen, nil, nil
+	}
+	frame := s.frame
+	s.frame = nil
+	return readLen, frame, nil
+}
+
+// Unmarshal
+//
+//	@Description: 解包消息, 返回的消息复制了内容, 可以长期持有
+//	@receiver s
+//	@param data 流数据
+//	@return int 已读取长度
+//	@return iface.IMessage 完整的消息, 数据不足时为nil
+//	@return error
+func (s *Stream) Unmarshal(data []byte) (int, iface.IMessage, error) {
+	readLen, frame, err := s.UnmarshalFrame(data)
+	if frame == nil {
+		return readLen, nil, err
+	}
+	message := &Message{
+		msgSize: uint32(frame.GetMsgLen()),
+		msgId:   frame.GetMsgId(),
+		reserve: frame.GetReserve(),
+		msgData: bytes.Clone(frame.GetMsgData()),
+	}
+	frame.Release()
+	return readLen, message, nil
+}
+
+func (s *Stream) Marshal(msg iface.IMessage) []byte {
+	buffer := make([]byte, HeaderSize+msg.GetMsgLen())
+	binary.BigEndian.PutUint32(buffer, uint32(msg.GetMsgLen()))
+	binary.BigEndian.PutUint16(buffer[4:], msg.GetMsgId())
+	binary.BigEndian.PutUint32(buffer[6:], msg.GetReserve())
+	copy(buffer[HeaderSize:], msg.GetMsgData())
+	return buffer
+}
+
+func (s *Stream) SetMaxSize(size uint32) {
+	s.maxSize = size
+}
@@ -0,0 +1,162 @@
+package codec_test
+
+import (
+	"bytes"
+	"github.com/liaoyudong2/GateServer/codec"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestStreamUnmarshal(t *testing.T) {
+	stream := codec.NewStream()
+	var data []byte
+	for i, body := range []string{"hello", "", string(bytes.Repeat([]byte("x"), 5000))} {
+		data = append(data, stream.Marshal(codec.NewMessage(uint16(100+i), uint32(i), []byte(body)))...)
+	}
+	// 每次只送入一个字节, 覆盖头部和内容不完整的情况
+	var bodies []string
+	for readLen := 0; readLen < len(data); {
+		n, msg, err := stream.Unmarshal(data[readLen : readLen+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		readLen += n
+		if msg != nil {
+			if msg.GetMsgId() != uint16(100+len(bodies)) || msg.GetReserve() != uint32(len(bodies)) {
+				t.Fatalf("unexpected message %d: msgId %d reserve %d", len(bodies), msg.GetMsgId(), msg.GetReserve())
+			}
+			bodies = append(bodies, string(msg.GetMsgData()))
+		}
+	}
+	if len(bodies) != 3 || bodies[0] != "hello" || bodies[1] != "" || len(bodies[2]) != 5000 {
+		t.Fatalf("unexpected bodies: %d", len(bodies))
+	}
+
+	stream.SetMaxSize(4)
+	if _, _, err := stream.Unmarshal(data); err == nil {
+		t.Fatal("oversize message accepted")
+	}
+}
+
+func TestFrame(t *testing.T) {
+	frame := codec.NewFrame(100, 7, []byte("hello"))
+	if !bytes.Equal(frame.Bytes(), codec.NewStream().Marshal(codec.NewMessage(100, 7, []byte("hello")))) {
+		t.Fatalf("frame %x differs from marshal", frame.Bytes())
+	}
+
+	// 解码的帧就是原始数据, 修改保留字段后直接转发
+	_, decoded, err := codec.NewStream().UnmarshalFrame(frame.Bytes())
+	if err != nil || decoded == nil {
+		t.Fatalf("unmarshal frame: %v", err)
+	}
+	decoded.SetReserve(9)
+	if decoded.GetMsgId() != 100 || decoded.GetReserve() != 9 || string(decoded.GetMsgData()) != "hello" {
+		t.Fatalf("unexpected frame: msgId %d reserve %d data %q", decoded.GetMsgId(), decoded.GetReserve(), decoded.GetMsgData())
+	}
+	if codec.FrameOf(decoded) != decoded {
+		t.Fatal("FrameOf re-encoded a frame")
+	}
+
+	frame.Retain()
+	frame.Release()
+	frame.Release()
+	decoded.Release()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("double release not detected")
+		}
+	}()
+	frame.Release()
+}
+
+// payload 典型的业务消息大小
+var payload = bytes.Repeat([]byte("x"), 256)
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data := codec.NewStream().Marshal(codec.NewMessage(100, 1, payload))
+	stream := codec.NewStream()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, _ = stream.Unmarshal(data)
+	}
+}
+
+func BenchmarkUnmarshalFrame(b *testing.B) {
+	data := codec.NewStream().Marshal(codec.NewMessage(100, 1, payload))
+	stream := codec.NewStream()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, frame, _ := stream.UnmarshalFrame(data)
+		frame.Release()
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	msg := codec.NewMessage(100, 1, payload)
+	stream := codec.NewStream()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = stream.Marshal(msg)
+	}
+}
+
+func BenchmarkFrame(b *testing.B) {
+	msg := codec.NewMessage(100, 1, payload)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		codec.FrameOf(msg).Release()
+	}
+}
+
+// broadcastSessions 广播基准的会话数, 每个会话的写协程各发送一次
+const broadcastSessions = 100
+
+func BenchmarkBroadcastMarshal(b *testing.B) {
+	msg := codec.NewMessage(100, 0, payload)
+	stream := codec.NewStream()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < broadcastSessions; j++ {
+			_ = stream.Marshal(msg)
+		}
+	}
+}
+
+func BenchmarkBroadcastFrame(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame := codec.NewFrame(100, 0, payload)
+		for j := 0; j < broadcastSessions; j++ {
+			frame.Retain()
+		}
+		frame.Release()
+		for j := 0; j < broadcastSessions; j++ {
+			frame.Release()
+		}
+	}
+}
+
+func TestDisconnectData(t *testing.T) {
+	code, reason := codec.ParseDisconnect(codec.DisconnectData(codec.CloseKicked, "duplicate login"))
+	if code != codec.CloseKicked || reason != "duplicate login" {
+		t.Fatalf("parsed %d %q", code, reason)
+	}
+	if _, reason = codec.ParseDisconnect(codec.DisconnectData(codec.CloseShutdown, "")); reason != "shutdown" {
+		t.Fatalf("default reason %q, want shutdown", reason)
+	}
+	// 超长原因按字符截断, 不超过websocket控制帧的限制
+	long := strings.Repeat("踢", 50)
+	if reason = codec.CloseReason(codec.CloseKicked, long); len(reason) > codec.MaxCloseReason || !utf8.ValidString(reason) ||
+		!strings.HasPrefix(long, reason) {
+		t.Fatalf("truncated reason %q, %d bytes", reason, len(reason))
+	}
+	if code, _ = codec.ParseDisconnect([]byte{1}); code != 0 {
+		t.Fatalf("short payload parsed code %d", code)
+	}
+	for _, code := range []uint16{1004, 1005, 1006, 1015, 2000, 5000} {
+		if codec.IsValidCloseCode(code) {
+			t.Fatalf("close code %d accepted", code)
+		}
+	}
+}
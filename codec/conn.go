@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"net"
+	"sync"
+	"time"
+)
+
+// tcpReadBuffer tcp连接单次读取的缓冲大小
+const tcpReadBuffer = 0x4000
+
+// CloseTimeout 关闭前发送原因的超时时间, 超时后直接关闭
+const CloseTimeout = time.Second
+
+// ErrMsgType websocket收到非二进制消息
+var ErrMsgType = errors.New("websocket msg type error")
+
+// wsConn
+// @Description: websocket连接, 只接受二进制消息
+type wsConn struct {
+	*websocket.Conn
+}
+
+// NewWebSocketConn
+//
+//	@Description: 包装websocket连接
+//	@param conn websocket连接
+//	@return iface.IConn
+func NewWebSocketConn(conn *websocket.Conn) iface.IConn {
+	return wsConn{Conn: conn}
+}
+
+func (c wsConn) ReadData() ([]byte, error) {
+	msgType, data, err := c.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if msgType != websocket.BinaryMessage {
+		return nil, fmt.Errorf("%w, [%d]", ErrMsgType, msgType)
+	}
+	return data, nil
+}
+
+func (c wsConn) WriteData(data []byte) error {
+	return c.WriteMessage(websocket.BinaryMessage, data)
+}
+
+// CloseWith
+//
+//	@Description: 发送关闭帧后关闭, 可以与WriteData并发调用
+//	@receiver c
+//	@param code 关闭码
+//	@param reason 原因
+//	@return error
+func (c wsConn) CloseWith(code uint16, reason string) error {
+	_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(int(code), CloseReason(code, reason)),
+		time.Now().Add(CloseTimeout))
+	return c.Close()
+}
+
+// tcpConn
+// @Description: tcp连接, 消息帧可能跨越多次读取, 由会话的解析器拼接
+type tcpConn struct {
+	net.Conn
+	buf  []byte     // 读取缓冲, 每次读取复用
+	lock sync.Mutex // 写锁, 关闭通知不能插入到正在写入的消息帧中
+}
+
+// NewTCPConn
+//
+//	@Description: 包装tcp连接
+//	@param conn tcp连接
+//	@return iface.IConn
+func NewTCPConn(conn net.Conn) iface.IConn {
+	return &tcpConn{Conn: conn, buf: make([]byte, tcpReadBuffer)}
+}
+
+func (c *tcpConn) ReadData() ([]byte, error) {
+	n, err := c.Read(c.buf)
+	if n > 0 {
+		return c.buf[:n], nil
+	}
+	return nil, err
+}
+
+func (c *tcpConn) WriteData(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, err := c.Write(data)
+	return err
+}
+
+// CloseWith
+//
+//	@Description: 发送MsgIdDisconnect后关闭, 可以与WriteData并发调用, 正在进行的写入最多等待CloseTimeout
+//	@receiver c
+//	@param code 关闭码
+//	@param reason 原因
+//	@return error
+func (c *tcpConn) CloseWith(code uint16, reason string) error {
+	_ = c.SetWriteDeadline(time.Now().Add(CloseTimeout))
+	frame := NewFrame(MsgIdDisconnect, 0, DisconnectData(code, reason))
+	_ = c.WriteData(frame.Bytes())
+	frame.Release()
+	return c.Close()
+}
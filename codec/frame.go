@@ -0,0 +1,162 @@
+package codec
+
+import (
+	"encoding/binary"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	minFrameShift = 6  // 最小尺寸等级 64 字节
+	frameClasses  = 12 // 尺寸等级数, 最大 64 << 11 = 128K, 超过的帧不回收
+)
+
+// framePools 按尺寸等级缓存帧, 等级i的缓冲区容量为 64 << i
+var framePools [frameClasses]sync.Pool
+
+// Frame
+// @Description: 引用计数的消息帧, 缓冲区为完整的编码结果(头部+内容), 从池中分配.
+// 解码后的帧可以直接转发, 编码一次的帧可以由多个会话共享发送, 最后一个持有者Release后缓冲区回到池中.
+// 把帧交给SendMessage或Forward即转移一个引用, 之后不能再访问; 未Release的帧由GC回收
+type Frame struct {
+	buf   []byte       // 头部 + 内容
+	refs  atomic.Int32 // 引用计数
+	class int          // 尺寸等级, -1 表示不回收
+}
+
+// frameClass
+//
+//	@Description: 容纳size字节的最小尺寸等级
+//	@param size 帧长度
+//	@return int 尺寸等级, 超过最大等级时为-1
+func frameClass(size int) int {
+	class := 0
+	if size > 1<<minFrameShift {
+		class = bits.Len(uint(size-1)) - minFrameShift
+	}
+	if class >= frameClasses {
+		return -1
+	}
+	return class
+}
+
+// newFrame
+//
+//	@Description: 从池中分配size字节的帧, 引用计数为1
+//	@param size 帧长度(头部+内容)
+//	@return *Frame
+func newFrame(size int) *Frame {
+	class := frameClass(size)
+	var f *Frame
+	if class >= 0 {
+		f, _ = framePools[class].Get().(*Frame)
+		if f == nil {
+			f = &Frame{buf: make([]byte, 0, 1<<(minFrameShift+class)), class: class}
+		}
+		f.buf = f.buf[:size]
+	} else {
+		f = &Frame{buf: make([]byte, size), class: class}
+	}
+	f.refs.Store(1)
+	return f
+}
+
+// NewFrame
+//
+//	@Description: 编码消息到池中分配的帧, 引用计数为1
+//	@param msgId 消息id
+//	@param reserve 保留字段(与后端通信时为SessionID)
+//	@param data 消息内容
+//	@return *Frame
+func NewFrame(msgId uint16, reserve uint32, data []byte) *Frame {
+	f := newFrame(HeaderSize + len(data))
+	binary.BigEndian.PutUint32(f.buf, uint32(len(data)))
+	binary.BigEndian.PutUint16(f.buf[4:], msgId)
+	binary.BigEndian.PutUint32(f.buf[6:], reserve)
+	copy(f.buf[HeaderSize:], data)
+	return f
+}
+
+// FrameOf
+//
+//	@Description: 消息本身是帧时直接返回(不增加引用), 否则编码为新的帧
+//	@param msg 消息
+//	@return *Frame
+func FrameOf(msg iface.IMessage) *Frame {
+	if f, ok := msg.(*Frame); ok {
+		return f
+	}
+	return NewFrame(msg.GetMsgId(), msg.GetReserve(), msg.GetMsgData())
+}
+
+func (f *Frame) GetMsgId() uint16 {
+	return binary.BigEndian.Uint16(f.buf[4:])
+}
+
+func (f *Frame) GetMsgLen() int {
+	return len(f.buf) - HeaderSize
+}
+
+func (f *Frame) GetMsgData() []byte {
+	return f.buf[HeaderSize:]
+}
+
+func (f *Frame) GetReserve() uint32 {
+	return binary.BigEndian.Uint32(f.buf[6:])
+}
+
+// SetReserve
+//
+//	@Description: 原地修改保留字段, 只能在帧未共享时调用
+//	@receiver f
+//	@param reserve 保留字段
+func (f *Frame) SetReserve(reserve uint32) {
+	binary.BigEndian.PutUint32(f.buf[6:], reserve)
+}
+
+// Bytes
+//
+//	@Description: 编码后的完整帧, Release后不能再使用
+//	@receiver f
+//	@return []byte
+func (f *Frame) Bytes() []byte {
+	return f.buf
+}
+
+// Retain
+//
+//	@Description: 增加一个引用
+//	@receiver f
+//	@return *Frame 帧本身
+func (f *Frame) Retain() *Frame {
+	if f.refs.Add(1) <= 1 {
+		panic("codec: retain released frame")
+	}
+	return f
+}
+
+// Release
+//
+//	@Description: 释放一个引用, 最后一个引用释放时缓冲区回到池中
+//	@receiver f
+func (f *Frame) Release() {
+	refs := f.refs.Add(-1)
+	if refs < 0 {
+		panic("codec: frame released twice")
+	}
+	if refs == 0 && f.class >= 0 {
+		framePools[f.class].Put(f)
+	}
+}
+
+// Release
+//
+//	@Description: 消息是帧时释放一个引用, 其它消息忽略
+//	@param msg 消息
+func Release(msg iface.IMessage) {
+	if f, ok := msg.(*Frame); ok {
+		f.Release()
+	}
+}
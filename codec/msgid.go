@@ -0,0 +1,26 @@
+package codec
+
+// 网关保留的控制消息ID, 由网关自行处理, 不转发
+const (
+	MsgIdGateReserved uint16 = 0xFF00 // 保留段起始
+
+	MsgIdSystemNotice uint16 = 0xFF01 // 网关 -> 客户端: 系统公告, 内容为UTF-8文本
+	MsgIdBindUser     uint16 = 0xFF02 // 后端 -> 网关: 绑定会话的用户ID, 内容为用户ID
+	MsgIdTraceContext uint16 = 0xFF03 // 网关 -> 后端: 会话追踪上下文, 内容为 traceId(8字节) + requestId(4字节), 大端
+	MsgIdEcho         uint16 = 0xFF04 // 客户端 <-> 网关: 开启回显时网关原样返回, 不转发
+	MsgIdKick         uint16 = 0xFF05 // 后端 -> 网关: 踢下线保留字段指定的会话, 内容为原因
+	MsgIdBroadcast    uint16 = 0xFF06 // 后端 -> 网关: 广播到全部会话, 内容为 msgId(2字节, 大端) + 消息内容, 保留字段忽略
+	MsgIdHeartbeat    uint16 = 0xFF07 // 客户端 <-> 网关: 心跳, 网关原样返回, 不转发
+	MsgIdOverflow     uint16 = 0xFF08 // 网关 -> 客户端: 会话已满, 发送后关闭连接, 内容为建议重试的秒数(4字节, 大端)
+	MsgIdQueue        uint16 = 0xFF09 // 网关 -> 客户端: 登录排队中, 内容为 排名(4字节) + 预计等待秒数(4字节, 0为未知), 大端
+	MsgIdDisconnect   uint16 = 0xFF0A // 后端 -> 网关: 按关闭码关闭保留字段指定的会话; 网关 -> tcp客户端: 关闭前通知原因. 内容为 关闭码(2字节, 大端) + 原因
+)
+
+// IsGateMsgId
+//
+//	@Description: 是否为网关保留的消息ID
+//	@param msgId 消息ID
+//	@return bool
+func IsGateMsgId(msgId uint16) bool {
+	return msgId >= MsgIdGateReserved
+}
@@ -0,0 +1,72 @@
+package codec
+
+// 会话ID(即网关与后端之间的reserve字段)的组成, 从高位到低位:
+//
+//	serverId(8) + epoch(10) + sequence(14)
+//
+// serverId 为网关的ServerId, 后端据此判断会话所属的网关; epoch 为网关的重启纪元, 每次启动加1,
+// 避免重启后的ID与之前的会话重复; sequence 为启动后的自增序号, 用完后回绕并跳过仍在使用的ID,
+// 因此单个网关同时最多有MaxSessionSeq个会话. 序号不为0, 因此会话ID不为0
+//
+// 纪元每1024次重启回绕一次, 回绕后的ID可能与1024次重启之前的会话相同. 后端为每个ServerId记录当前纪元
+// (网关重启后新会话的纪元), 纪元与之不同的会话都已过期, 用SessionStale判断; 只比较是否相等,
+// 不比较大小, 回绕不影响判断. 纪元保存在文件中, 文件不可用时网关拒绝启动, 不退化为随机纪元
+const (
+	SessionServerBits = 8  // serverId 位数
+	SessionEpochBits  = 10 // 重启纪元位数
+	SessionSeqBits    = 14 // 序号位数
+
+	MaxSessionServerId = 1<<SessionServerBits - 1 // 最大ServerId
+	MaxSessionEpoch    = 1<<SessionEpochBits - 1  // 最大重启纪元, 超过后回绕
+	MaxSessionSeq      = 1<<SessionSeqBits - 1    // 最大序号, 超过后回绕
+)
+
+// MakeSessionId
+//
+//	@Description: 组合会话ID, 超出位数的部分被截断
+//	@param serverId 网关ServerId
+//	@param epoch 重启纪元
+//	@param seq 序号
+//	@return uint32
+func MakeSessionId(serverId uint32, epoch uint32, seq uint32) uint32 {
+	return (serverId&MaxSessionServerId)<<(SessionEpochBits+SessionSeqBits) |
+		(epoch&MaxSessionEpoch)<<SessionSeqBits |
+		seq&MaxSessionSeq
+}
+
+// SessionServerId
+//
+//	@Description: 会话所属网关的ServerId
+//	@param sessionId 会话ID
+//	@return uint32
+func SessionServerId(sessionId uint32) uint32 {
+	return sessionId >> (SessionEpochBits + SessionSeqBits)
+}
+
+// SessionEpoch
+//
+//	@Description: 创建会话时网关的重启纪元
+//	@param sessionId 会话ID
+//	@return uint32
+func SessionEpoch(sessionId uint32) uint32 {
+	return sessionId >> SessionSeqBits & MaxSessionEpoch
+}
+
+// SessionSeq
+//
+//	@Description: 会话的序号
+//	@param sessionId 会话ID
+//	@return uint32
+func SessionSeq(sessionId uint32) uint32 {
+	return sessionId & MaxSessionSeq
+}
+
+// SessionStale
+//
+//	@Description: 会话是否属于网关之前的纪元(已过期), 供后端在网关重启后清理旧会话的状态
+//	@param sessionId 会话ID
+//	@param epoch 会话所属网关的当前纪元
+//	@return bool
+func SessionStale(sessionId uint32, epoch uint32) bool {
+	return SessionEpoch(sessionId) != epoch&MaxSessionEpoch
+}
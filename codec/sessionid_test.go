@@ -0,0 +1,36 @@
+package codec_test
+
+import (
+	"github.com/liaoyudong2/GateServer/codec"
+	"testing"
+)
+
+func TestSessionId(t *testing.T) {
+	sessionId := codec.MakeSessionId(codec.MaxSessionServerId, codec.MaxSessionEpoch, codec.MaxSessionSeq)
+	if sessionId != 0xFFFFFFFF {
+		t.Fatalf("session id %#x, want all bits set", sessionId)
+	}
+	sessionId = codec.MakeSessionId(7, 1000, 300)
+	if codec.SessionServerId(sessionId) != 7 || codec.SessionEpoch(sessionId) != 1000 || codec.SessionSeq(sessionId) != 300 {
+		t.Fatalf("session id %#x: server %d epoch %d seq %d", sessionId, codec.SessionServerId(sessionId),
+			codec.SessionEpoch(sessionId), codec.SessionSeq(sessionId))
+	}
+	if codec.MaxSessionEpoch < 1000 {
+		t.Fatalf("epoch wraps after %d restarts", codec.MaxSessionEpoch+1)
+	}
+}
+
+func TestSessionStale(t *testing.T) {
+	// 纪元回绕: 最后一个纪元的会话在纪元回到0后过期, 回绕后的纪元与回绕前同值的纪元ID相同
+	last := codec.MakeSessionId(1, codec.MaxSessionEpoch, 5)
+	wrapped := codec.MakeSessionId(1, codec.MaxSessionEpoch+1, 5)
+	if codec.SessionEpoch(wrapped) != 0 || wrapped != codec.MakeSessionId(1, 0, 5) {
+		t.Fatalf("epoch %d after wraparound, want 0", codec.SessionEpoch(wrapped))
+	}
+	if !codec.SessionStale(last, codec.MaxSessionEpoch+1) || codec.SessionStale(wrapped, codec.MaxSessionEpoch+1) {
+		t.Fatal("stale check does not follow the wrapped epoch")
+	}
+	if codec.SessionStale(last, codec.MaxSessionEpoch) || !codec.SessionStale(codec.MakeSessionId(1, 3, 5), 4) {
+		t.Fatal("stale check compares epochs incorrectly")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/utils"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"os"
+	"reflect"
+	"time"
+)
+
+// DefaultMaxSession 未配置时的最大会话数量
+const DefaultMaxSession = 4096
+
+// ConfigWatchInterval 配置文件检查间隔
+const ConfigWatchInterval = 3 * time.Second
+
+// applyConfig
+//
+//	@Description: 应用可热更新的配置项
+//	@param cfg 配置
+func applyConfig(cfg *utils.ServerConfig) {
+	applyMaxSession(cfg)
+	applyOverflow(cfg)
+	applyQueue(cfg)
+	applyRequestId(cfg)
+	applyCrashDump(cfg)
+	applyEcho(cfg)
+	applyRecord(cfg)
+	applyRateLimit(cfg)
+	applyLog(cfg)
+	applyRoutes(cfg)
+}
+
+// subscribeConfig
+//
+//	@Description: 订阅配置变更, 重载后应用可热更新的部分, 其余提示重启
+func subscribeConfig() {
+	utils.Subscribe(utils.SectionGateSrv, func(old, cur *utils.ServerConfig) {
+		applyMaxSession(cur)
+		applyOverflow(cur)
+		applyQueue(cur)
+		applyRequestId(cur)
+		applyCrashDump(cur)
+		applyEcho(cur)
+		if !reflect.DeepEqual(old.GateSrv.RecordUsers, cur.GateSrv.RecordUsers) || old.GateSrv.RecordDir != cur.GateSrv.RecordDir {
+			applyRecord(cur)
+		}
+		if !reflect.DeepEqual(old.GateSrv.UseSSL, cur.GateSrv.UseSSL) {
+			if old.GateSrv.UseSSL.Open != cur.GateSrv.UseSSL.Open {
+				zlog.Warn("config GateSrv.UseSSL.Open changed, restart required")
+			} else if cur.GateSrv.UseSSL.Open {
+				if err := net.Ins().SetCertificate(cur.GateSrv.UseSSL.Cert, cur.GateSrv.UseSSL.PKey); err != nil {
+					zlog.Errorf("reload certificate failed, keep current certificate: %v", err)
+				}
+			}
+		}
+		if old.GateSrv.BindClientPort != cur.GateSrv.BindClientPort || old.GateSrv.BindTCPPort != cur.GateSrv.BindTCPPort || old.GateSrv.AdminPort != cur.GateSrv.AdminPort ||
+			old.GateSrv.AdminToken != cur.GateSrv.AdminToken {
+			zlog.Warn("config GateSrv ports or admin token changed, restart required")
+		}
+	})
+	utils.Subscribe(utils.SectionRateLimit, func(old, cur *utils.ServerConfig) {
+		applyRateLimit(cur)
+	})
+	for _, section := range []string{utils.SectionLog, utils.SectionDebugMode} {
+		utils.Subscribe(section, func(old, cur *utils.ServerConfig) {
+			applyLog(cur)
+		})
+	}
+	utils.Subscribe(utils.SectionRoutes, func(old, cur *utils.ServerConfig) {
+		applyRoutes(cur)
+	})
+	for _, section := range []string{utils.SectionServerId, utils.SectionGameSrv, utils.SectionDiscovery} {
+		name := section
+		utils.Subscribe(name, func(old, cur *utils.ServerConfig) {
+			zlog.Warnf("config %s changed, restart required", name)
+		})
+	}
+}
+
+func applyRequestId(cfg *utils.ServerConfig) {
+	net.Ins().SetRequestId(cfg.GateSrv.RequestId)
+}
+
+func applyCrashDump(cfg *utils.ServerConfig) {
+	net.Ins().SetCrashDumpDir(cfg.GateSrv.CrashDumpDir)
+}
+
+func applyEcho(cfg *utils.ServerConfig) {
+	net.Ins().SetEcho(cfg.GateSrv.Echo)
+}
+
+func applyRecord(cfg *utils.ServerConfig) {
+	net.Ins().SetRecordDir(cfg.GateSrv.RecordDir)
+	net.Ins().SetRecordUsers(cfg.GateSrv.RecordUsers)
+}
+
+func applyMaxSession(cfg *utils.ServerConfig) {
+	maxSession := cfg.GateSrv.MaxSession
+	if maxSession == 0 {
+		maxSession = DefaultMaxSession
+	}
+	net.Ins().SetMaxSession(maxSession)
+}
+
+func applyOverflow(cfg *utils.ServerConfig) {
+	net.Ins().SetOverflow(time.Duration(cfg.GateSrv.RetryAfter)*time.Second, cfg.GateSrv.OverflowClose)
+}
+
+func applyQueue(cfg *utils.ServerConfig) {
+	queue := cfg.GateSrv.Queue
+	net.Ins().SetLoginQueue(queue.Open, queue.MaxLength, time.Duration(queue.Interval)*time.Millisecond, queue.VipTokens)
+}
+
+func applyRateLimit(cfg *utils.ServerConfig) {
+	net.Ins().SetRateLimit(cfg.RateLimit.MsgPerSecond, cfg.RateLimit.Burst)
+}
+
+func applyLog(cfg *utils.ServerConfig) {
+	zlog.SetLogPath(cfg.Log.Path)
+	if cfg.Log.Async {
+		zlog.SetAsync(&zlog.AsyncConfig{Size: cfg.Log.AsyncSize, Drop: cfg.Log.AsyncDrop})
+	} else {
+		zlog.SetAsync(nil)
+	}
+	zlog.SetEncoder(logEncoder(cfg.Log.Encoder, zlog.EncoderText))
+	zlog.SetRotate(logRotate(cfg))
+	applyLogSinks(cfg)
+	applyLogSampling(cfg)
+
+	level, _ := zlog.ParseLevel(cfg.LogLevel())
+	zlog.SetLevel(level)
+	zlog.ResetModuleLevels()
+	for module, name := range cfg.Log.Modules {
+		level, _ = zlog.ParseLevel(name)
+		zlog.SetModuleLevel(module, level)
+	}
+}
+
+// logSinks 按配置创建的额外日志输出, 重载时整体替换
+var logSinks []zlog.ISink
+
+// applyLogSinks
+//
+//	@Description: 按配置重建额外日志输出, 创建失败的输出跳过
+//	@param cfg 配置
+func applyLogSinks(cfg *utils.ServerConfig) {
+	for _, sink := range logSinks {
+		zlog.RemoveSink(sink)
+		_ = sink.Close()
+	}
+	logSinks = logSinks[:0]
+
+	encoder := logEncoder(cfg.Log.Encoder, zlog.EncoderText)
+	for _, sinkCfg := range cfg.Log.Sinks {
+		level := zlog.LogDebug
+		if sinkCfg.Level != "" {
+			level, _ = zlog.ParseLevel(sinkCfg.Level)
+		}
+		sinkEncoder := logEncoder(sinkCfg.Encoder, encoder)
+		var sink zlog.ISink
+		switch sinkCfg.Type {
+		case "file":
+			sink = zlog.NewFileSink(sinkCfg.Path, logRotate(cfg), level, sinkEncoder)
+		case "stdout":
+			sink = zlog.NewWriterSink(os.Stdout, level, sinkEncoder)
+		case "stderr":
+			sink = zlog.NewWriterSink(os.Stderr, level, sinkEncoder)
+		case "syslog":
+			syslog, err := zlog.NewSyslogSink(sinkCfg.Path, sinkCfg.Tag, zlog.FacilityDaemon, level, sinkEncoder)
+			if err != nil {
+				zlog.Errorf("create syslog sink failed: %v", err)
+				continue
+			}
+			sink = syslog
+		}
+		zlog.AddSink(sink)
+		logSinks = append(logSinks, sink)
+	}
+}
+
+// applyLogSampling
+//
+//	@Description: 按配置开启或关闭日志采样
+//	@param cfg 配置
+func applyLogSampling(cfg *utils.ServerConfig) {
+	sampling := cfg.Log.Sampling
+	if sampling.First <= 0 {
+		zlog.SetSampling(nil)
+		return
+	}
+	by := zlog.SampleByCaller
+	if sampling.By == "template" {
+		by = zlog.SampleByTemplate
+	}
+	zlog.SetSampling(&zlog.SamplingConfig{
+		Interval:   time.Duration(sampling.Interval) * time.Millisecond,
+		First:      sampling.First,
+		Thereafter: sampling.Thereafter,
+		By:         by,
+		Summary:    time.Duration(sampling.Summary) * time.Millisecond,
+	})
+}
+
+func logEncoder(name string, def int) int {
+	switch name {
+	case "json":
+		return zlog.EncoderJSON
+	case "text":
+		return zlog.EncoderText
+	}
+	return def
+}
+
+func logRotate(cfg *utils.ServerConfig) zlog.RotateConfig {
+	return zlog.RotateConfig{
+		MaxSize:    int64(cfg.Log.MaxSize) << 20,
+		MaxAge:     time.Duration(cfg.Log.MaxAge) * 24 * time.Hour,
+		MaxBackups: cfg.Log.MaxBackups,
+		Compress:   cfg.Log.Compress,
+	}
+}
+
+func applyRoutes(cfg *utils.ServerConfig) {
+	routes := make([]net.BackendRoute, 0, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		routes = append(routes, net.BackendRoute{
+			MsgIdMin: route.MsgIdMin,
+			MsgIdMax: route.MsgIdMax,
+			Service:  route.Service,
+		})
+	}
+	net.Ins().SetRoutes(routes)
+}
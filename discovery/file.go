@@ -0,0 +1,171 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileProvider
+// @Description: 基于注册表文件的服务发现, 定时检查文件变化并热更新实例
+type FileProvider struct {
+	Registry
+	path     string        // 注册表路径
+	interval time.Duration // 检查间隔
+	modTime  time.Time     // 上次加载时文件修改时间
+	size     int64         // 上次加载时文件大小
+	exitChan chan bool     // 退出信号
+}
+
+const (
+	ProviderFile        = "file"
+	DefaultFileInterval = 2000 // 默认检查间隔(毫秒)
+)
+
+// NewFileProvider
+//
+//	@Description: 创建文件提供者, 注册表支持 .json/.yaml/.yml
+//	@param cfg 配置, 使用 Path/Interval 字段
+//	@return IProvider
+//	@return error
+func NewFileProvider(cfg Config) (IProvider, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("discovery file provider: registry path is empty")
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DefaultFileInterval
+	}
+	return &FileProvider{
+		path:     cfg.Path,
+		interval: time.Duration(interval) * time.Millisecond,
+		exitChan: make(chan bool, 1),
+	}, nil
+}
+
+func (p *FileProvider) Name() string {
+	return ProviderFile
+}
+
+func (p *FileProvider) Start() error {
+	if err := p.reload(); err != nil {
+		return err
+	}
+	go p.watch()
+	return nil
+}
+
+func (p *FileProvider) Stop() {
+	select {
+	case p.exitChan <- true:
+	default:
+	}
+}
+
+// watch
+//
+//	@Description: 轮询注册表文件, 修改时间或大小变化且连续两次检查一致时重新加载,
+//	避免读到正在写入的文件(截断后的空文件会让全部实例下线)
+//	@receiver p
+func (p *FileProvider) watch() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	var lastModTime time.Time // 上次检查到的修改时间
+	lastSize := int64(-1)     // 上次检查到的大小
+	for {
+		select {
+		case <-p.exitChan:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(p.path)
+			if err != nil {
+				zlog.Errorf("discovery registry stat error: %v", err)
+				continue
+			}
+			if info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+				continue
+			}
+			if !info.ModTime().Equal(lastModTime) || info.Size() != lastSize {
+				lastModTime, lastSize = info.ModTime(), info.Size()
+				continue
+			}
+			if err = p.reload(); err != nil {
+				// 保留上一份实例, 等待下次修正
+				zlog.Errorf("discovery registry reload error: %v", err)
+			}
+		}
+	}
+}
+
+// reload
+//
+//	@Description: 读取并解析注册表
+//	@receiver p
+//	@return error
+func (p *FileProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	services, err := ParseRegistry(data, filepath.Ext(p.path))
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", p.path, err)
+	}
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	p.Update(services)
+	zlog.Infof("discovery registry loaded: %s", p.path)
+	return nil
+}
+
+// ParseRegistry
+//
+//	@Description: 解析注册表内容, 格式为 服务名 -> 实例列表
+//	@param data 文件内容
+//	@param ext 扩展名(.json/.yaml/.yml)
+//	@return map[string][]Instance
+//	@return error
+func ParseRegistry(data []byte, ext string) (map[string][]Instance, error) {
+	var services map[string][]Instance
+	switch strings.ToLower(ext) {
+	case ".json":
+		if err := json.Unmarshal(data, &services); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		var err error
+		if services, err = parseYAMLRegistry(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported registry format %q", ext)
+	}
+	for name, list := range services {
+		seen := map[string]bool{}
+		for _, inst := range list {
+			if inst.Address == "" {
+				return nil, fmt.Errorf("service %s: instance %q has no address", name, inst.Id)
+			}
+			id := inst.normalize().Id
+			if seen[id] {
+				return nil, fmt.Errorf("service %s: duplicate instance id %q", name, id)
+			}
+			seen[id] = true
+		}
+	}
+	return services, nil
+}
+
+func init() {
+	RegisterProvider(ProviderFile, NewFileProvider)
+}
@@ -0,0 +1,169 @@
+package discovery_test
+
+import (
+	"github.com/liaoyudong2/GateServer/discovery"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain 测试日志不写文件, 需要检查日志的用例自行调用zlog.StartCapture
+func TestMain(m *testing.M) {
+	zlog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestParseRegistryYAML(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want map[string][]discovery.Instance
+	}{
+		{"empty", "", map[string][]discovery.Instance{}},
+		{"empty service", "game: []\nchat:\n", map[string][]discovery.Instance{"game": nil, "chat": nil}},
+		{
+			"fields",
+			"game:\n  - id: g1\n    address: 10.0.0.1:9000\n    weight: 3\n    tags: [blue, \"canary\"]\n",
+			map[string][]discovery.Instance{"game": {{Id: "g1", Address: "10.0.0.1:9000", Weight: 3, Tags: []string{"blue", "canary"}}}},
+		},
+		{
+			"block tags and bare dash",
+			"game:\n  -\n    address: a:1\n    tags:\n      - x\n      - 'y'\n  - address: b:1\n",
+			map[string][]discovery.Instance{"game": {{Address: "a:1", Tags: []string{"x", "y"}}, {Address: "b:1"}}},
+		},
+		{
+			"comments and quotes",
+			"# registry\ngame: # services\n  - address: \"a:1#2\" # port\n    id: 'g#1'\n",
+			map[string][]discovery.Instance{"game": {{Id: "g#1", Address: "a:1#2"}}},
+		},
+		{
+			"items at service indent",
+			"chat:\n- address: c:1\n  tags:\n  - x\n- address: d:1\ngame: []\n",
+			map[string][]discovery.Instance{"chat": {{Address: "c:1", Tags: []string{"x"}}, {Address: "d:1"}}, "game": nil},
+		},
+		{
+			"crlf",
+			"game:\r\n  - address: a:1\r\n",
+			map[string][]discovery.Instance{"game": {{Address: "a:1"}}},
+		},
+	}
+	for _, c := range cases {
+		for _, ext := range []string{".yaml", ".YML"} {
+			got, err := discovery.ParseRegistry([]byte(c.data), ext)
+			if err != nil {
+				t.Errorf("%s%s: %v", c.name, ext, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s%s: got %+v, want %+v", c.name, ext, got, c.want)
+			}
+		}
+	}
+}
+
+func TestParseRegistryYAMLErrors(t *testing.T) {
+	cases := []struct {
+		data string
+		want string
+	}{
+		{"game\n", `line 1: expect "service:"`},
+		{"- address: a:1\n", "line 1: instance outside of service"},
+		{"game: a:1\n", "line 1: service game must be a list"},
+		{"game:\n  - address: a:1\n      id: x\n", "line 3: unexpected indentation"},
+		{"game:\n  address: a:1\n", "line 2: unexpected indentation"},
+		{"game:\n  - address\n", `line 2: expect "key: value"`},
+		{"game:\n  - address: a:1\n    weight: high\n", `line 3: invalid weight "high"`},
+		{"game:\n  - address: a:1\n    tags: blue\n", "line 3: tags must be a list"},
+		{"game:\n  - address: a:1\n    port: 1\n", `line 3: unknown field "port"`},
+		{"game:\n  - id: g1\n", `service game: instance "g1" has no address`},
+		{"game:\n  - address: a:1\n  - id: a:1\n    address: b:1\n", `service game: duplicate instance id "a:1"`},
+	}
+	for _, c := range cases {
+		_, err := discovery.ParseRegistry([]byte(c.data), ".yaml")
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("parse %q: got %v, want %q", c.data, err, c.want)
+		}
+	}
+}
+
+func TestParseRegistryJSON(t *testing.T) {
+	data := `{"game": [{"id": "g1", "address": "a:1", "weight": 2, "tags": ["blue"]}, {"address": "b:1"}], "chat": []}`
+	got, err := discovery.ParseRegistry([]byte(data), ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]discovery.Instance{
+		"game": {{Id: "g1", Address: "a:1", Weight: 2, Tags: []string{"blue"}}, {Address: "b:1"}},
+		"chat": {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for data, want := range map[string]string{
+		`{"game": [{"id": "g1"}]}`:                           "has no address",
+		`{"game": [{"address": "a:1"}, {"address": "a:1"}]}`: "duplicate instance id",
+		`{"game": {"address": "a:1"}}`:                       "cannot unmarshal",
+		`{"game": [`:                                         "unexpected end",
+	} {
+		if _, err = discovery.ParseRegistry([]byte(data), ".json"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parse %s: got %v, want %q", data, err, want)
+		}
+	}
+	if _, err = discovery.ParseRegistry([]byte(data), ".toml"); err == nil || !strings.Contains(err.Error(), "unsupported registry format") {
+		t.Errorf("parse .toml: got %v", err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	if _, err := discovery.NewProvider(discovery.Config{Provider: discovery.ProviderFile}); err == nil {
+		t.Fatal("file provider without path created")
+	}
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	provider, err := discovery.NewProvider(discovery.Config{Provider: discovery.ProviderFile, Path: path, Interval: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 首次加载失败时启动失败
+	if err = provider.Start(); err == nil {
+		t.Fatal("start without registry file succeeded")
+	}
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("game:\n  - id: g1\n    address: a:1\n")
+	events := make(chan []discovery.Event, 8)
+	provider.Subscribe(func(evs []discovery.Event) { events <- evs })
+	if err = provider.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Stop()
+	expectEvents(t, events, "ADD game g1 a:1 1")
+
+	// 修改文件后热更新, 只通知差异
+	write("game:\n  - id: g1\n    address: a:1\n    weight: 5\n  - id: g2\n    address: b:1\n")
+	expectEvents(t, events, "UPDATE game g1 a:1 5", "ADD game g2 b:1 1")
+
+	// 解析失败时保留上一份实例
+	write("game:\n  - id: g1\n")
+	select {
+	case evs := <-events:
+		t.Fatalf("invalid registry fired %v", evs)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := len(provider.Services()["game"]); n != 2 {
+		t.Fatalf("services after invalid reload: %d instances, want 2", n)
+	}
+
+	write("game:\n  - id: g2\n    address: b:1\n")
+	expectEvents(t, events, "REMOVE game g1 a:1 5")
+}
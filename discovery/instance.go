@@ -0,0 +1,66 @@
+package discovery
+
+import "sort"
+
+// Instance
+// @Description: 后端服务实例
+type Instance struct {
+	Id      string   `json:"id"`      // 实例ID
+	Address string   `json:"address"` // 连接地址
+	Weight  int      `json:"weight"`  // 权重
+	Tags    []string `json:"tags"`    // 标签
+}
+
+// Equal
+//
+//	@Description: 判断两个实例信息是否一致
+//	@receiver i
+//	@param o 比较对象
+//	@return bool
+func (i Instance) Equal(o Instance) bool {
+	if i.Id != o.Id || i.Address != o.Address || i.Weight != o.Weight || len(i.Tags) != len(o.Tags) {
+		return false
+	}
+	for idx := range i.Tags {
+		if i.Tags[idx] != o.Tags[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// HasTag
+//
+//	@Description: 是否带有指定标签
+//	@receiver i
+//	@param tag 标签
+//	@return bool
+func (i Instance) HasTag(tag string) bool {
+	for _, t := range i.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize
+//
+//	@Description: 补全默认值并排序标签, 便于比较
+//	@receiver i
+//	@return Instance
+func (i Instance) normalize() Instance {
+	if i.Weight <= 0 {
+		i.Weight = 1
+	}
+	if i.Id == "" {
+		i.Id = i.Address
+	}
+	if len(i.Tags) > 0 {
+		tags := make([]string, len(i.Tags))
+		copy(tags, i.Tags)
+		sort.Strings(tags)
+		i.Tags = tags
+	}
+	return i
+}
@@ -0,0 +1,221 @@
+package discovery
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// EventType 实例变更类型
+type EventType int
+
+const (
+	EventAdd    EventType = iota // 新增实例
+	EventUpdate                  // 实例信息变更
+	EventRemove                  // 实例下线
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdd:
+		return "ADD"
+	case EventUpdate:
+		return "UPDATE"
+	case EventRemove:
+		return "REMOVE"
+	}
+	return "UNKNOWN"
+}
+
+// Event
+// @Description: 实例变更事件
+type Event struct {
+	Type     EventType // 变更类型
+	Service  string    // 服务名
+	Instance Instance  // 实例信息
+}
+
+// IProvider
+// @Description: 服务发现提供者, 文件/etcd/consul等实现同一接口
+type IProvider interface {
+	Name() string                         // 提供者名称
+	Start() error                         // 启动(首次加载失败时返回错误)
+	Stop()                                // 停止
+	Services() map[string][]Instance      // 当前全部服务实例快照
+	Subscribe(listener func(evs []Event)) // 订阅实例变更
+}
+
+// Config
+// @Description: 服务发现配置
+type Config struct {
+	Provider string            // 提供者名称(static/file/...)
+	Path     string            // 注册表路径(file)
+	Interval int               // 轮询间隔(毫秒)
+	Static   map[string]string // 静态服务地址(static), 服务名->地址
+}
+
+// Factory 提供者构造函数
+type Factory func(cfg Config) (IProvider, error)
+
+var (
+	factoryLock sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// RegisterProvider
+//
+//	@Description: 注册服务发现提供者, 新的实现(etcd/consul)在init中调用
+//	@param name 提供者名称
+//	@param factory 构造函数
+func RegisterProvider(name string, factory Factory) {
+	factoryLock.Lock()
+	defer factoryLock.Unlock()
+
+	factories[name] = factory
+}
+
+// NewProvider
+//
+//	@Description: 根据配置创建服务发现提供者
+//	@param cfg 配置
+//	@return IProvider
+//	@return error
+func NewProvider(cfg Config) (IProvider, error) {
+	factoryLock.RLock()
+	factory, ok := factories[cfg.Provider]
+	factoryLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("discovery provider undefined: %q", cfg.Provider)
+	}
+	return factory(cfg)
+}
+
+// Registry
+// @Description: 实例快照与变更通知, 供各提供者复用
+type Registry struct {
+	lock      sync.RWMutex          // 读写锁
+	services  map[string][]Instance // 服务实例
+	listeners []func(evs []Event)   // 订阅者
+}
+
+// Services
+//
+//	@Description: 获取服务实例快照
+//	@receiver r
+//	@return map[string][]Instance
+func (r *Registry) Services() map[string][]Instance {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	services := make(map[string][]Instance, len(r.services))
+	for name, list := range r.services {
+		services[name] = append([]Instance(nil), list...)
+	}
+	return services
+}
+
+// Subscribe
+//
+//	@Description: 订阅实例变更, 订阅时会先收到当前全部实例
+//	@receiver r
+//	@param listener 回调
+func (r *Registry) Subscribe(listener func(evs []Event)) {
+	r.lock.Lock()
+	r.listeners = append(r.listeners, listener)
+	var evs []Event
+	for _, name := range sortedKeys(r.services) {
+		for _, inst := range r.services[name] {
+			evs = append(evs, Event{Type: EventAdd, Service: name, Instance: inst})
+		}
+	}
+	r.lock.Unlock()
+
+	if len(evs) > 0 {
+		listener(evs)
+	}
+}
+
+// Update
+//
+//	@Description: 替换全部实例并通知差异
+//	@receiver r
+//	@param services 新的服务实例
+func (r *Registry) Update(services map[string][]Instance) {
+	next := make(map[string][]Instance, len(services))
+	for name, list := range services {
+		for _, inst := range list {
+			next[name] = append(next[name], inst.normalize())
+		}
+	}
+
+	r.lock.Lock()
+	evs := diffServices(r.services, next)
+	r.services = next
+	listeners := append([]func(evs []Event){}, r.listeners...)
+	r.lock.Unlock()
+
+	if len(evs) == 0 {
+		return
+	}
+	for _, listener := range listeners {
+		listener(evs)
+	}
+}
+
+// diffServices
+//
+//	@Description: 计算两份快照的差异
+//	@param prev 旧快照
+//	@param next 新快照
+//	@return []Event
+func diffServices(prev, next map[string][]Instance) []Event {
+	var evs []Event
+	names := map[string]bool{}
+	for name := range prev {
+		names[name] = true
+	}
+	for name := range next {
+		names[name] = true
+	}
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	for _, name := range keys {
+		old := indexById(prev[name])
+		cur := indexById(next[name])
+		for _, inst := range next[name] {
+			if o, ok := old[inst.Id]; !ok {
+				evs = append(evs, Event{Type: EventAdd, Service: name, Instance: inst})
+			} else if !o.Equal(inst) {
+				evs = append(evs, Event{Type: EventUpdate, Service: name, Instance: inst})
+			}
+		}
+		for _, inst := range prev[name] {
+			if _, ok := cur[inst.Id]; !ok {
+				evs = append(evs, Event{Type: EventRemove, Service: name, Instance: inst})
+			}
+		}
+	}
+	return evs
+}
+
+func indexById(list []Instance) map[string]Instance {
+	index := make(map[string]Instance, len(list))
+	for _, inst := range list {
+		index[inst.Id] = inst
+	}
+	return index
+}
+
+func sortedKeys(services map[string][]Instance) []string {
+	keys := make([]string, 0, len(services))
+	for name := range services {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+package discovery_test
+
+import (
+	"fmt"
+	"github.com/liaoyudong2/GateServer/discovery"
+	"strings"
+	"testing"
+	"time"
+)
+
+// formatEvents 事件格式化为 "类型 服务 实例ID 地址 权重", 便于比较
+func formatEvents(evs []discovery.Event) []string {
+	lines := make([]string, 0, len(evs))
+	for _, ev := range evs {
+		lines = append(lines, fmt.Sprintf("%s %s %s %s %d", ev.Type, ev.Service, ev.Instance.Id, ev.Instance.Address, ev.Instance.Weight))
+	}
+	return lines
+}
+
+// expectEvents 等待下一批变更事件, 内容和顺序与期望一致
+func expectEvents(t *testing.T, events chan []discovery.Event, want ...string) {
+	t.Helper()
+	select {
+	case evs := <-events:
+		if got := formatEvents(evs); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("events %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no events, want %q", want)
+	}
+}
+
+func TestRegistryUpdate(t *testing.T) {
+	var registry discovery.Registry
+	events := make(chan []discovery.Event, 8)
+	registry.Subscribe(func(evs []discovery.Event) { events <- evs })
+
+	// 补全默认值后按服务名排序通知
+	registry.Update(map[string][]discovery.Instance{
+		"game": {{Address: "a:1"}, {Id: "g2", Address: "b:1", Weight: 2, Tags: []string{"y", "x"}}},
+		"chat": {{Id: "c1", Address: "c:1"}},
+	})
+	expectEvents(t, events, "ADD chat c1 c:1 1", "ADD game a:1 a:1 1", "ADD game g2 b:1 2")
+	if tags := registry.Services()["game"][1].Tags; strings.Join(tags, ",") != "x,y" {
+		t.Fatalf("tags not sorted: %v", tags)
+	}
+
+	// 内容相同(包括标签顺序不同)时不通知
+	registry.Update(map[string][]discovery.Instance{
+		"game": {{Id: "a:1", Address: "a:1", Weight: 1}, {Id: "g2", Address: "b:1", Weight: 2, Tags: []string{"x", "y"}}},
+		"chat": {{Id: "c1", Address: "c:1", Weight: -1}},
+	})
+	select {
+	case evs := <-events:
+		t.Fatalf("unchanged registry fired %q", formatEvents(evs))
+	default:
+	}
+
+	// 同一ID地址、权重或标签变化为更新, 服务整体消失时实例全部下线
+	registry.Update(map[string][]discovery.Instance{
+		"game":  {{Id: "g2", Address: "b:2", Weight: 2, Tags: []string{"x", "y"}}, {Id: "g3", Address: "d:1"}},
+		"login": {{Id: "l1", Address: "e:1", Tags: []string{"z"}}},
+	})
+	expectEvents(t, events,
+		"REMOVE chat c1 c:1 1",
+		"UPDATE game g2 b:2 2", "ADD game g3 d:1 1", "REMOVE game a:1 a:1 1",
+		"ADD login l1 e:1 1")
+	registry.Update(map[string][]discovery.Instance{
+		"game":  {{Id: "g2", Address: "b:2", Weight: 2, Tags: []string{"x"}}, {Id: "g3", Address: "d:1"}},
+		"login": {{Id: "l1", Address: "e:1", Tags: []string{"z"}}},
+	})
+	expectEvents(t, events, "UPDATE game g2 b:2 2")
+
+	// 新订阅者先收到当前全部实例
+	late := make(chan []discovery.Event, 1)
+	registry.Subscribe(func(evs []discovery.Event) { late <- evs })
+	expectEvents(t, late, "ADD game g2 b:2 2", "ADD game g3 d:1 1", "ADD login l1 e:1 1")
+
+	// 快照是副本, 修改不影响注册表
+	services := registry.Services()
+	services["game"][0].Address = "changed"
+	if registry.Services()["game"][0].Address != "b:2" {
+		t.Fatal("Services returned the internal slice")
+	}
+}
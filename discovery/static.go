@@ -0,0 +1,43 @@
+package discovery
+
+// StaticProvider
+// @Description: 静态服务地址, 兼容原有配置里的固定地址
+type StaticProvider struct {
+	Registry
+	services map[string][]Instance // 静态实例
+}
+
+const ProviderStatic = "static"
+
+// NewStaticProvider
+//
+//	@Description: 创建静态提供者
+//	@param cfg 配置, 使用 Static 字段
+//	@return IProvider
+//	@return error
+func NewStaticProvider(cfg Config) (IProvider, error) {
+	services := make(map[string][]Instance, len(cfg.Static))
+	for name, addr := range cfg.Static {
+		if addr == "" {
+			continue
+		}
+		services[name] = []Instance{{Id: name + "-" + addr, Address: addr, Weight: 1}}
+	}
+	return &StaticProvider{services: services}, nil
+}
+
+func (p *StaticProvider) Name() string {
+	return ProviderStatic
+}
+
+func (p *StaticProvider) Start() error {
+	p.Update(p.services)
+	return nil
+}
+
+func (p *StaticProvider) Stop() {
+}
+
+func init() {
+	RegisterProvider(ProviderStatic, NewStaticProvider)
+}
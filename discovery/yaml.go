@@ -0,0 +1,145 @@
+package discovery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAMLRegistry
+//
+//	@Description: 解析YAML注册表, 只支持注册表需要的子集:
+//	顶层为服务名, 值为实例列表, 实例字段为标量, tags 可用 [a, b] 或块列表
+//	@param data 文件内容
+//	@return map[string][]Instance
+//	@return error
+func parseYAMLRegistry(data []byte) (map[string][]Instance, error) {
+	services := map[string][]Instance{}
+	service := ""
+	var inst *Instance
+	keyIndent := -1
+	inTags := false
+
+	flush := func() {
+		if inst != nil {
+			services[service] = append(services[service], *inst)
+			inst = nil
+		}
+	}
+
+	for no, raw := range strings.Split(string(data), "\n") {
+		line := stripComment(strings.TrimRight(raw, " \t\r"))
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		text := strings.TrimSpace(line)
+		lineNo := no + 1
+
+		// 顶层服务名, 列表项允许和服务名同一缩进
+		isItem := strings.HasPrefix(text, "- ") || text == "-"
+		if indent == 0 && !isItem {
+			flush()
+			inTags = false
+			key, value, ok := splitKeyValue(text)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expect \"service:\"", lineNo)
+			}
+			service = key
+			if value != "" && value != "[]" {
+				return nil, fmt.Errorf("line %d: service %s must be a list", lineNo, key)
+			}
+			services[service] = nil
+			continue
+		}
+		if service == "" {
+			return nil, fmt.Errorf("line %d: instance outside of service", lineNo)
+		}
+
+		// 块形式的tags
+		if inTags && strings.HasPrefix(text, "- ") && indent >= keyIndent {
+			inst.Tags = append(inst.Tags, unquote(strings.TrimSpace(text[2:])))
+			continue
+		}
+		inTags = false
+
+		if isItem {
+			flush()
+			inst = &Instance{}
+			keyIndent = indent + 2
+			text = strings.TrimSpace(strings.TrimPrefix(text, "-"))
+			if text == "" {
+				continue
+			}
+		} else if inst == nil || indent != keyIndent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+		}
+
+		key, value, ok := splitKeyValue(text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expect \"key: value\"", lineNo)
+		}
+		switch key {
+		case "id":
+			inst.Id = unquote(value)
+		case "address":
+			inst.Address = unquote(value)
+		case "weight":
+			weight, err := strconv.Atoi(unquote(value))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid weight %q", lineNo, value)
+			}
+			inst.Weight = weight
+		case "tags":
+			if value == "" {
+				inTags = true
+				continue
+			}
+			if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: tags must be a list", lineNo)
+			}
+			for _, tag := range strings.Split(value[1:len(value)-1], ",") {
+				if tag = unquote(strings.TrimSpace(tag)); tag != "" {
+					inst.Tags = append(inst.Tags, tag)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown field %q", lineNo, key)
+		}
+	}
+	flush()
+	return services, nil
+}
+
+func splitKeyValue(text string) (string, string, bool) {
+	idx := strings.Index(text, ":")
+	if idx <= 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+1:]), true
+}
+
+func stripComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
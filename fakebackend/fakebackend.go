@@ -0,0 +1,644 @@
+package fakebackend
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/codec"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readBuffer 单次读取的缓冲大小
+const readBuffer = 0x4000
+
+// ErrTimeout 等待超时
+var ErrTimeout = errors.New("fakebackend: wait timeout")
+
+// ErrNoConn 没有网关连接
+var ErrNoConn = errors.New("fakebackend: no gate connection")
+
+// Reply
+// @Description: 一条回包
+type Reply struct {
+	MsgId uint16 // 消息ID
+	Data  []byte // 消息内容
+}
+
+// Rule
+// @Description: 收到某个msgId时的脚本, 按字段顺序执行: 延迟、绑定用户、回显、回包、广播、踢下线、断开连接
+type Rule struct {
+	Latency    time.Duration // 处理前的延迟, 为0时使用服务的默认延迟
+	BindUser   string        // 绑定会话的用户ID, %d替换为会话ID, 为空时不绑定
+	Echo       bool          // 原样回包
+	Replies    []Reply       // 回给会话的消息
+	Broadcast  []Reply       // 广播到全部会话的消息
+	Kick       string        // 踢下线的原因, 为空时不踢
+	Disconnect bool          // 断开网关连接
+}
+
+// Request
+// @Description: 收到的一条客户端消息
+type Request struct {
+	Conn      *Conn     // 来源网关连接
+	SessionId uint32    // 会话ID
+	MsgId     uint16    // 消息ID
+	Data      []byte    // 消息内容
+	TraceId   uint64    // 会话最近的追踪ID, 网关未发送时为0
+	RequestId uint32    // 会话最近的请求ID, 网关未开启时为0
+	Time      time.Time // 收到时间
+}
+
+// Handler 自定义处理, 优先于Rule
+type Handler func(req *Request)
+
+// Server
+// @Description: 模拟后端服务, 接受网关连接, 使用网关与后端之间的帧格式(保留字段为会话ID), 按脚本处理消息
+type Server struct {
+	lock     sync.RWMutex       // 读写锁
+	listener net.Listener       // 监听对象
+	conns    map[*Conn]bool     // 网关连接
+	rules    map[uint16]Rule    // 按msgId的脚本
+	handlers map[uint16]Handler // 按msgId的自定义处理
+	fallback Rule               // 没有脚本时的处理
+	latency  time.Duration      // 默认延迟
+	observer Handler            // 收到消息时的回调, 在脚本之前调用
+	received []*Request         // 收到的消息
+	notify   chan bool          // 收到消息或连接变化时关闭并替换, 用于等待
+	owners   map[uint32]*Conn   // 会话最近所在的网关连接
+	wg       sync.WaitGroup     // 连接协程
+	closed   bool               // 是否已关闭
+}
+
+// New
+//
+//	@Description: 创建模拟后端, 默认对全部消息回显
+//	@return *Server
+func New() *Server {
+	return &Server{
+		conns:    make(map[*Conn]bool),
+		rules:    make(map[uint16]Rule),
+		handlers: make(map[uint16]Handler),
+		fallback: Rule{Echo: true},
+		notify:   make(chan bool),
+		owners:   make(map[uint32]*Conn),
+	}
+}
+
+// Start
+//
+//	@Description: 开始监听, 端口为0时使用随机端口, 通过Addr获取实际地址
+//	@receiver s
+//	@param addr 监听地址
+//	@return error
+func (s *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.listener = listener
+	s.lock.Unlock()
+
+	s.wg.Add(1)
+	go s.accept(listener)
+	return nil
+}
+
+func (s *Server) Addr() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Close
+//
+//	@Description: 停止监听并断开全部网关连接
+//	@receiver s
+//	@return error
+func (s *Server) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.lock.Unlock()
+
+	s.Disconnect()
+	s.wg.Wait()
+	return err
+}
+
+// On
+//
+//	@Description: 设置收到msgId时的脚本
+//	@receiver s
+//	@param msgId 消息ID
+//	@param rule 脚本
+func (s *Server) On(msgId uint16, rule Rule) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rules[msgId] = rule
+}
+
+// Handle
+//
+//	@Description: 设置收到msgId时的自定义处理, 为空时删除
+//	@receiver s
+//	@param msgId 消息ID
+//	@param handler 处理
+func (s *Server) Handle(msgId uint16, handler Handler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if handler == nil {
+		delete(s.handlers, msgId)
+	} else {
+		s.handlers[msgId] = handler
+	}
+}
+
+// SetDefault
+//
+//	@Description: 设置没有脚本的msgId的处理, 默认为回显, 设置为Rule{}时只记录不回包
+//	@receiver s
+//	@param rule 脚本
+func (s *Server) SetDefault(rule Rule) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.fallback = rule
+}
+
+// SetObserver
+//
+//	@Description: 设置收到消息时的回调, 用于打印或统计, 不影响脚本
+//	@receiver s
+//	@param observer 回调
+func (s *Server) SetObserver(observer Handler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.observer = observer
+}
+
+// SetLatency
+//
+//	@Description: 设置默认延迟, 对没有单独设置延迟的脚本生效
+//	@receiver s
+//	@param latency 延迟
+func (s *Server) SetLatency(latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.latency = latency
+}
+
+// Conns
+//
+//	@Description: 当前的网关连接
+//	@receiver s
+//	@return []*Conn
+func (s *Server) Conns() []*Conn {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	conns := make([]*Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// Disconnect
+//
+//	@Description: 断开全部网关连接, 网关会自动重连
+//	@receiver s
+//	@return int 断开的连接数
+func (s *Server) Disconnect() int {
+	conns := s.Conns()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return len(conns)
+}
+
+// Send
+//
+//	@Description: 发送消息到会话, 经由会话最近所在的网关连接, 未知会话时发往全部连接
+//	@receiver s
+//	@param sessionId 会话ID
+//	@param msgId 消息ID
+//	@param data 消息内容
+//	@return error
+func (s *Server) Send(sessionId uint32, msgId uint16, data []byte) error {
+	s.lock.RLock()
+	owner := s.owners[sessionId]
+	s.lock.RUnlock()
+	if owner != nil {
+		return owner.Send(sessionId, msgId, data)
+	}
+	return s.sendAll(sessionId, msgId, data)
+}
+
+// Broadcast
+//
+//	@Description: 通过全部网关连接广播消息到全部会话
+//	@receiver s
+//	@param msgId 消息ID
+//	@param data 消息内容
+//	@return error
+func (s *Server) Broadcast(msgId uint16, data []byte) error {
+	return s.sendAll(0, codec.MsgIdBroadcast, broadcastData(msgId, data))
+}
+
+// Kick
+//
+//	@Description: 踢会话下线
+//	@receiver s
+//	@param sessionId 会话ID
+//	@param reason 原因
+//	@return error
+func (s *Server) Kick(sessionId uint32, reason string) error {
+	return s.Send(sessionId, codec.MsgIdKick, []byte(reason))
+}
+
+// CloseSession
+//
+//	@Description: 按关闭码关闭会话, 如登录验证失败时使用codec.CloseAuthFailed
+//	@receiver s
+//	@param sessionId 会话ID
+//	@param code 关闭码
+//	@param reason 原因
+//	@return error
+func (s *Server) CloseSession(sessionId uint32, code uint16, reason string) error {
+	return s.Send(sessionId, codec.MsgIdDisconnect, codec.DisconnectData(code, reason))
+}
+
+// BindUser
+//
+//	@Description: 绑定会话的用户ID
+//	@receiver s
+//	@param sessionId 会话ID
+//	@param userId 用户ID
+//	@return error
+func (s *Server) BindUser(sessionId uint32, userId string) error {
+	return s.Send(sessionId, codec.MsgIdBindUser, []byte(userId))
+}
+
+func (s *Server) sendAll(sessionId uint32, msgId uint16, data []byte) error {
+	conns := s.Conns()
+	if len(conns) == 0 {
+		return ErrNoConn
+	}
+	var errs []error
+	for _, conn := range conns {
+		if err := conn.Send(sessionId, msgId, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Received
+//
+//	@Description: 收到的全部消息(快照)
+//	@receiver s
+//	@return []*Request
+func (s *Server) Received() []*Request {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]*Request(nil), s.received...)
+}
+
+// Reset
+//
+//	@Description: 清空收到的消息
+//	@receiver s
+func (s *Server) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.received = nil
+}
+
+// Wait
+//
+//	@Description: 等待收到满足条件的消息, 已收到的消息同样匹配
+//	@receiver s
+//	@param match 条件
+//	@param timeout 超时时间
+//	@return *Request
+//	@return error
+func (s *Server) Wait(match func(req *Request) bool, timeout time.Duration) (*Request, error) {
+	deadline := time.After(timeout)
+	for seen := 0; ; {
+		s.lock.RLock()
+		received, notify := s.received, s.notify
+		s.lock.RUnlock()
+		if seen > len(received) {
+			seen = 0
+		}
+		for ; seen < len(received); seen++ {
+			if match(received[seen]) {
+				return received[seen], nil
+			}
+		}
+		select {
+		case <-notify:
+		case <-deadline:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// WaitMsg
+//
+//	@Description: 等待收到指定msgId的消息
+//	@receiver s
+//	@param msgId 消息ID
+//	@param timeout 超时时间
+//	@return *Request
+//	@return error
+func (s *Server) WaitMsg(msgId uint16, timeout time.Duration) (*Request, error) {
+	return s.Wait(func(req *Request) bool {
+		return req.MsgId == msgId
+	}, timeout)
+}
+
+// WaitConn
+//
+//	@Description: 等待至少有count个网关连接
+//	@receiver s
+//	@param count 连接数
+//	@param timeout 超时时间
+//	@return error
+func (s *Server) WaitConn(count int, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		s.lock.RLock()
+		conns, notify := len(s.conns), s.notify
+		s.lock.RUnlock()
+		if conns >= count {
+			return nil
+		}
+		select {
+		case <-notify:
+		case <-deadline:
+			return ErrTimeout
+		}
+	}
+}
+
+// wakeLocked
+//
+//	@Description: 唤醒等待者, 调用时需持有写锁
+//	@receiver s
+func (s *Server) wakeLocked() {
+	close(s.notify)
+	s.notify = make(chan bool)
+}
+
+func (s *Server) accept(listener net.Listener) {
+	defer s.wg.Done()
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn := &Conn{server: s, conn: netConn, traces: make(map[uint32]trace)}
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			_ = netConn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.wakeLocked()
+		s.lock.Unlock()
+
+		s.wg.Add(1)
+		go conn.serve()
+	}
+}
+
+// script
+//
+//	@Description: 查找msgId的处理
+//	@receiver s
+//	@param msgId 消息ID
+//	@return Handler 自定义处理, 为空时使用脚本
+//	@return Rule 脚本
+//	@return time.Duration 默认延迟
+func (s *Server) script(msgId uint16) (Handler, Rule, time.Duration) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if handler, ok := s.handlers[msgId]; ok {
+		return handler, Rule{}, s.latency
+	}
+	if rule, ok := s.rules[msgId]; ok {
+		return nil, rule, s.latency
+	}
+	return nil, s.fallback, s.latency
+}
+
+// receive
+//
+//	@Description: 记录消息并按脚本处理
+//	@receiver s
+//	@param req 消息
+func (s *Server) receive(req *Request) {
+	s.lock.Lock()
+	s.received = append(s.received, req)
+	s.owners[req.SessionId] = req.Conn
+	s.wakeLocked()
+	observer := s.observer
+	s.lock.Unlock()
+
+	if observer != nil {
+		observer(req)
+	}
+	handler, rule, latency := s.script(req.MsgId)
+	if rule.Latency > 0 {
+		latency = rule.Latency
+	}
+	run := func() {
+		if handler != nil {
+			handler(req)
+		} else {
+			s.apply(req, rule)
+		}
+	}
+	if latency > 0 {
+		time.AfterFunc(latency, run)
+	} else {
+		run()
+	}
+}
+
+// apply
+//
+//	@Description: 执行脚本
+//	@receiver s
+//	@param req 消息
+//	@param rule 脚本
+func (s *Server) apply(req *Request, rule Rule) {
+	conn := req.Conn
+	if rule.BindUser != "" {
+		_ = conn.Send(req.SessionId, codec.MsgIdBindUser, []byte(strings.ReplaceAll(rule.BindUser, "%d", strconv.FormatUint(uint64(req.SessionId), 10))))
+	}
+	if rule.Echo {
+		_ = conn.Send(req.SessionId, req.MsgId, req.Data)
+	}
+	for _, reply := range rule.Replies {
+		_ = conn.Send(req.SessionId, reply.MsgId, reply.Data)
+	}
+	for _, reply := range rule.Broadcast {
+		_ = s.Broadcast(reply.MsgId, reply.Data)
+	}
+	if rule.Kick != "" {
+		_ = conn.Send(req.SessionId, codec.MsgIdKick, []byte(rule.Kick))
+	}
+	if rule.Disconnect {
+		conn.Close()
+	}
+}
+
+func (s *Server) remove(conn *Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.conns, conn)
+	for sessionId, owner := range s.owners {
+		if owner == conn {
+			delete(s.owners, sessionId)
+		}
+	}
+	s.wakeLocked()
+}
+
+// broadcastData
+//
+//	@Description: 广播消息内容: msgId(2字节) + 消息内容
+//	@param msgId 消息ID
+//	@param data 消息内容
+//	@return []byte
+func broadcastData(msgId uint16, data []byte) []byte {
+	buf := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(buf, msgId)
+	copy(buf[2:], data)
+	return buf
+}
+
+// trace
+// @Description: 会话最近的追踪上下文
+type trace struct {
+	traceId   uint64 // 追踪ID
+	requestId uint32 // 请求ID
+}
+
+// Conn
+// @Description: 一个网关连接
+type Conn struct {
+	server    *Server          // 所属服务
+	conn      net.Conn         // 连接
+	writeLock sync.Mutex       // 保护写入
+	traces    map[uint32]trace // 会话追踪上下文, 只在读协程访问
+	closeOnce sync.Once        // 关闭一次
+}
+
+func (c *Conn) RemoteAddr() string {
+	return c.conn.RemoteAddr().String()
+}
+
+// Send
+//
+//	@Description: 通过此连接发送消息到会话
+//	@receiver c
+//	@param sessionId 会话ID
+//	@param msgId 消息ID
+//	@param data 消息内容
+//	@return error
+func (c *Conn) Send(sessionId uint32, msgId uint16, data []byte) error {
+	frame := codec.NewStream().Marshal(codec.NewMessage(msgId, sessionId, data))
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if _, err := c.conn.Write(frame); err != nil {
+		return fmt.Errorf("fakebackend: send to %s: %w", c.RemoteAddr(), err)
+	}
+	return nil
+}
+
+// Close
+//
+//	@Description: 断开此网关连接
+//	@receiver c
+func (c *Conn) Close() {
+	c.closeOnce.Do(func() {
+		_ = c.conn.Close()
+	})
+}
+
+// serve
+//
+//	@Description: 读取网关消息, 追踪上下文只记录不作为请求
+//	@receiver c
+func (c *Conn) serve() {
+	defer c.server.wg.Done()
+	defer c.server.remove(c)
+	defer c.Close()
+
+	stream := codec.NewStream()
+	buf := make([]byte, readBuffer)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		for readLen := 0; readLen < n; {
+			nread, msg, err := stream.Unmarshal(buf[readLen:n])
+			if err != nil {
+				return
+			}
+			readLen += nread
+			if msg == nil {
+				continue
+			}
+			sessionId := msg.GetReserve()
+			if msg.GetMsgId() == codec.MsgIdTraceContext {
+				if traceId, requestId, ok := gatenet.ParseTraceContext(msg.GetMsgData()); ok {
+					c.traces[sessionId] = trace{traceId: traceId, requestId: requestId}
+				}
+				continue
+			}
+			ctx := c.traces[sessionId]
+			c.server.receive(&Request{
+				Conn:      c,
+				SessionId: sessionId,
+				MsgId:     msg.GetMsgId(),
+				Data:      msg.GetMsgData(),
+				TraceId:   ctx.traceId,
+				RequestId: ctx.requestId,
+				Time:      time.Now(),
+			})
+		}
+	}
+}
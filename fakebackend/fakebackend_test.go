@@ -0,0 +1,168 @@
+package fakebackend_test
+
+import (
+	"encoding/binary"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/fakebackend"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMain 测试日志不写文件, 需要检查日志的用例自行调用zlog.StartCapture
+func TestMain(m *testing.M) {
+	zlog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// gate 以网关身份连接模拟后端
+type gate struct {
+	t      *testing.T
+	conn   net.Conn
+	stream iface.IStream
+	queue  []iface.IMessage
+}
+
+func dialGate(t *testing.T, server *fakebackend.Server) *gate {
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if err = server.WaitConn(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return &gate{t: t, conn: conn, stream: codec.NewStream()}
+}
+
+func (g *gate) send(msg iface.IMessage) {
+	if _, err := g.conn.Write(codec.NewStream().Marshal(msg)); err != nil {
+		g.t.Fatal(err)
+	}
+}
+
+func (g *gate) recv() iface.IMessage {
+	_ = g.conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4096)
+	for len(g.queue) == 0 {
+		n, err := g.conn.Read(buf)
+		if err != nil {
+			g.t.Fatal(err)
+		}
+		for readLen := 0; readLen < n; {
+			nread, msg, err := g.stream.Unmarshal(buf[readLen:n])
+			if err != nil {
+				g.t.Fatal(err)
+			}
+			readLen += nread
+			if msg != nil {
+				g.queue = append(g.queue, msg)
+			}
+		}
+	}
+	msg := g.queue[0]
+	g.queue = g.queue[1:]
+	return msg
+}
+
+func (g *gate) expect(msgId uint16, sessionId uint32, data string) {
+	g.t.Helper()
+	msg := g.recv()
+	if msg.GetMsgId() != msgId || msg.GetReserve() != sessionId || string(msg.GetMsgData()) != data {
+		g.t.Fatalf("got msgId %d session %d data %q, want msgId %d session %d data %q",
+			msg.GetMsgId(), msg.GetReserve(), msg.GetMsgData(), msgId, sessionId, data)
+	}
+}
+
+func startServer(t *testing.T) *fakebackend.Server {
+	server := fakebackend.New()
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+	return server
+}
+
+func TestEchoAndRules(t *testing.T) {
+	server := startServer(t)
+	server.On(1000, fakebackend.Rule{BindUser: "user%d", Replies: []fakebackend.Reply{{MsgId: 1001, Data: []byte("welcome")}}})
+	server.On(1002, fakebackend.Rule{Kick: "banned"})
+	g := dialGate(t, server)
+
+	g.send(gatenet.NewTraceContext(7, 0xabc, 3))
+	g.send(codec.NewMessage(50, 7, []byte("ping")))
+	g.expect(50, 7, "ping")
+	req, err := server.WaitMsg(50, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.SessionId != 7 || req.TraceId != 0xabc || req.RequestId != 3 {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+
+	g.send(codec.NewMessage(1000, 7, []byte("login")))
+	g.expect(codec.MsgIdBindUser, 7, "user7")
+	g.expect(1001, 7, "welcome")
+	g.send(codec.NewMessage(1002, 7, nil))
+	g.expect(codec.MsgIdKick, 7, "banned")
+
+	if err = server.Broadcast(60, []byte("notice")); err != nil {
+		t.Fatal(err)
+	}
+	msg := g.recv()
+	if msg.GetMsgId() != codec.MsgIdBroadcast || binary.BigEndian.Uint16(msg.GetMsgData()) != 60 || string(msg.GetMsgData()[2:]) != "notice" {
+		t.Fatalf("unexpected broadcast: %d %q", msg.GetMsgId(), msg.GetMsgData())
+	}
+	if n := len(server.Received()); n != 3 {
+		t.Fatalf("received %d messages, want 3", n)
+	}
+}
+
+func TestLatencyAndDisconnect(t *testing.T) {
+	server := startServer(t)
+	server.SetLatency(100 * time.Millisecond)
+	server.On(2, fakebackend.Rule{Latency: time.Millisecond, Disconnect: true})
+	g := dialGate(t, server)
+
+	start := time.Now()
+	g.send(codec.NewMessage(1, 1, []byte("slow")))
+	g.expect(1, 1, "slow")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("reply after %s, want at least 100ms", elapsed)
+	}
+
+	g.send(codec.NewMessage(2, 1, nil))
+	_ = g.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := g.conn.Read(make([]byte, 16)); err == nil {
+		t.Fatal("connection still open after disconnect rule")
+	}
+}
+
+func TestScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.json")
+	script := `{"Default": {}, "Rules": {"0x10": {"Replies": [{"MsgId": 17, "Text": "a"}, {"MsgId": 18, "Hex": "6263"}]}}}`
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := fakebackend.LoadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := startServer(t)
+	if err = loaded.Apply(server); err != nil {
+		t.Fatal(err)
+	}
+	g := dialGate(t, server)
+
+	// 默认规则为空, 不回显
+	g.send(codec.NewMessage(1, 2, []byte("ignored")))
+	g.send(codec.NewMessage(16, 2, nil))
+	g.expect(17, 2, "a")
+	g.expect(18, 2, "bc")
+}
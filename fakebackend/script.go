@@ -0,0 +1,132 @@
+package fakebackend
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Script
+// @Description: json脚本, 供cmd/fakebackend和测试从文件加载, 时间单位为毫秒
+//
+//	{
+//	  "Latency": 0,
+//	  "Default": {"Echo": true},
+//	  "Rules": {
+//	    "1000": {"BindUser": "user%d", "Replies": [{"MsgId": 1000, "Text": "ok"}]},
+//	    "1001": {"Latency": 200, "Kick": "banned"}
+//	  }
+//	}
+type Script struct {
+	Latency int                   // 默认延迟(毫秒)
+	Default *ScriptRule           // 没有脚本时的处理, 为空时保持回显
+	Rules   map[string]ScriptRule // 按msgId的脚本, 键为十进制或0x开头的十六进制
+}
+
+// ScriptRule
+// @Description: json形式的Rule
+type ScriptRule struct {
+	Latency    int           // 延迟(毫秒)
+	BindUser   string        // 绑定会话的用户ID, %d替换为会话ID
+	Echo       bool          // 原样回包
+	Replies    []ScriptReply // 回给会话的消息
+	Broadcast  []ScriptReply // 广播到全部会话的消息
+	Kick       string        // 踢下线的原因
+	Disconnect bool          // 断开网关连接
+}
+
+// ScriptReply
+// @Description: json形式的Reply, 内容为文本或十六进制, 两者都有时使用十六进制
+type ScriptReply struct {
+	MsgId uint16 // 消息ID
+	Text  string // 文本内容
+	Hex   string // 十六进制内容
+}
+
+// LoadScript
+//
+//	@Description: 从文件加载脚本
+//	@param path 文件路径
+//	@return *Script
+//	@return error
+func LoadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	script := &Script{}
+	if err = json.Unmarshal(data, script); err != nil {
+		return nil, fmt.Errorf("fakebackend: parse script %s: %w", path, err)
+	}
+	return script, nil
+}
+
+// Apply
+//
+//	@Description: 将脚本应用到服务
+//	@receiver sc
+//	@param s 服务
+//	@return error
+func (sc *Script) Apply(s *Server) error {
+	rules := make(map[uint16]Rule, len(sc.Rules))
+	for key, scriptRule := range sc.Rules {
+		msgId, err := strconv.ParseUint(key, 0, 16)
+		if err != nil {
+			return fmt.Errorf("fakebackend: bad rule msgId %q: %v", key, err)
+		}
+		rule, err := scriptRule.rule()
+		if err != nil {
+			return fmt.Errorf("fakebackend: rule %s: %w", key, err)
+		}
+		rules[uint16(msgId)] = rule
+	}
+	if sc.Default != nil {
+		rule, err := sc.Default.rule()
+		if err != nil {
+			return fmt.Errorf("fakebackend: default rule: %w", err)
+		}
+		s.SetDefault(rule)
+	}
+	for msgId, rule := range rules {
+		s.On(msgId, rule)
+	}
+	s.SetLatency(time.Duration(sc.Latency) * time.Millisecond)
+	return nil
+}
+
+func (r *ScriptRule) rule() (Rule, error) {
+	rule := Rule{
+		Latency:    time.Duration(r.Latency) * time.Millisecond,
+		BindUser:   r.BindUser,
+		Echo:       r.Echo,
+		Kick:       r.Kick,
+		Disconnect: r.Disconnect,
+	}
+	var err error
+	if rule.Replies, err = replies(r.Replies); err != nil {
+		return rule, err
+	}
+	if rule.Broadcast, err = replies(r.Broadcast); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+func replies(items []ScriptReply) ([]Reply, error) {
+	var result []Reply
+	for _, item := range items {
+		reply := Reply{MsgId: item.MsgId, Data: []byte(item.Text)}
+		if item.Hex != "" {
+			data, err := hex.DecodeString(item.Hex)
+			if err != nil {
+				return nil, fmt.Errorf("bad hex reply for msgId %d: %v", item.MsgId, err)
+			}
+			reply.Data = data
+		}
+		result = append(result, reply)
+	}
+	return result, nil
+}
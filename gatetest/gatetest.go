@@ -0,0 +1,163 @@
+// Package gatetest 进程内集成测试: 在随机端口上启动独立的网关和模拟后端, 用真实客户端连接
+//
+//	gate := gatetest.Start(t)
+//	c := gate.Dial(client.Config{})
+//	gate.WaitSessions(1)
+//	_ = c.Send(1000, data)
+//	req, _ := gate.Backend.WaitMsg(1000, time.Second)
+package gatetest
+
+import (
+	"fmt"
+	"github.com/liaoyudong2/GateServer/client"
+	"github.com/liaoyudong2/GateServer/discovery"
+	"github.com/liaoyudong2/GateServer/fakebackend"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout 等待的默认超时时间
+const DefaultTimeout = 5 * time.Second
+
+// Gate
+// @Description: 测试用网关, 包含独立的桥服务和作为默认后端服务的模拟后端, 测试结束时自动停止
+type Gate struct {
+	t       testing.TB
+	Service *gatenet.BridgeService // 桥服务, 同时监听websocket和tcp
+	Backend *fakebackend.Server    // 模拟后端, 默认回显
+}
+
+// Start
+//
+//	@Description: 启动模拟后端和桥服务, 等待网关连上后端后返回
+//	@param t 测试
+//	@return *Gate
+func Start(t testing.TB) *Gate {
+	t.Helper()
+	backend := fakebackend.New()
+	if err := backend.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("gatetest: start backend: %v", err)
+	}
+	t.Cleanup(func() { _ = backend.Close() })
+
+	service := gatenet.NewBridgeService()
+	g := &Gate{t: t, Service: service, Backend: backend}
+	t.Cleanup(g.Stop)
+	provider, err := discovery.NewStaticProvider(discovery.Config{Static: map[string]string{gatenet.DefaultBackendService: backend.Addr()}})
+	if err != nil {
+		t.Fatalf("gatetest: discovery: %v", err)
+	}
+	if err = service.Discover(provider); err != nil {
+		t.Fatalf("gatetest: discovery: %v", err)
+	}
+	if err = service.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("gatetest: listen: %v", err)
+	}
+	if err = service.ListenTCP("127.0.0.1:0"); err != nil {
+		t.Fatalf("gatetest: listen tcp: %v", err)
+	}
+	if err = backend.WaitConn(1, DefaultTimeout); err != nil {
+		t.Fatalf("gatetest: gate not connected to backend: %v", err)
+	}
+	return g
+}
+
+// URL
+//
+//	@Description: websocket地址
+//	@receiver g
+//	@return string
+func (g *Gate) URL() string {
+	return fmt.Sprintf("ws://%s/", g.Service.Addr())
+}
+
+// TCPURL
+//
+//	@Description: tcp地址, 格式为客户端使用的tcp://host:port
+//	@receiver g
+//	@return string
+func (g *Gate) TCPURL() string {
+	return "tcp://" + g.Service.TCPAddr()
+}
+
+// Dial
+//
+//	@Description: 创建客户端并连接, 地址为空时使用websocket地址, 测试结束时自动关闭
+//	@receiver g
+//	@param cfg 客户端设置
+//	@return *client.Client
+func (g *Gate) Dial(cfg client.Config) *client.Client {
+	g.t.Helper()
+	if cfg.Addr == "" {
+		cfg.Addr = g.URL()
+	}
+	c := client.New(cfg)
+	if err := c.Connect(); err != nil {
+		g.t.Fatalf("gatetest: connect %s: %v", cfg.Addr, err)
+	}
+	g.t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// Sessions
+//
+//	@Description: 当前会话数
+//	@receiver g
+//	@return int
+func (g *Gate) Sessions() int {
+	return g.Service.GetSessionMgr().GetSessionCount()
+}
+
+// WaitSessions
+//
+//	@Description: 等待会话数等于count, 超时时测试失败
+//	@receiver g
+//	@param count 会话数
+func (g *Gate) WaitSessions(count int) {
+	g.t.Helper()
+	if !g.Eventually(func() bool { return g.Sessions() == count }) {
+		g.t.Fatalf("gatetest: %d sessions, want %d", g.Sessions(), count)
+	}
+}
+
+// Session
+//
+//	@Description: 按会话ID获取会话, 不存在时测试失败
+//	@receiver g
+//	@param sessionId 会话ID
+//	@return iface.ISession
+func (g *Gate) Session(sessionId uint32) iface.ISession {
+	g.t.Helper()
+	session := g.Service.GetSessionMgr().GetSession(sessionId)
+	if session == nil {
+		g.t.Fatalf("gatetest: session %d undefined", sessionId)
+	}
+	return session
+}
+
+// Eventually
+//
+//	@Description: 在DefaultTimeout内轮询条件
+//	@receiver g
+//	@param cond 条件
+//	@return bool 是否满足
+func (g *Gate) Eventually(cond func() bool) bool {
+	deadline := time.Now().Add(DefaultTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+// Stop
+//
+//	@Description: 停止桥服务, 可重复调用
+//	@receiver g
+func (g *Gate) Stop() {
+	g.Service.StopService()
+}
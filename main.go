@@ -1,7 +1,14 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/admin"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/discovery"
+	"github.com/liaoyudong2/GateServer/metrics"
 	"github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
 	"github.com/liaoyudong2/GateServer/utils"
 	"github.com/liaoyudong2/GateServer/zlog"
 	"os"
@@ -10,18 +17,104 @@ import (
 )
 
 func main() {
+	configPath := flag.String("config", utils.DefaultConfigPath, "path of the server config file")
+	flag.Parse()
+
+	if err := utils.Init(*configPath); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cfg := utils.GlobalConfig()
 	zlog.SetLogConsole()
+	recentErrors := zlog.NewRingSink(zlog.DefaultRingSize, zlog.LogError, zlog.EncoderText)
+	zlog.AddSink(recentErrors)
 
-	net.Ins().SetMaxSession(4096)
-	go net.Ins().StartService(utils.GlobalConfig.GateSrv.BindClientPort + utils.GlobalConfig.ServerId)
+	applyConfig(cfg)
+	subscribeConfig()
+	// 纪元文件不可用时无法保证会话ID不与重启前重复, 直接退出
+	epoch, err := net.NextSessionEpoch(cfg.SessionEpochFile())
+	if err != nil {
+		fatal("session epoch", err)
+	}
+	net.Ins().SetSessionIdGenerator(net.NewSessionIdGenerator(uint32(cfg.ServerId), epoch))
+	if cfg.GateSrv.UseSSL.Open {
+		if err = net.Ins().SetCertificate(cfg.GateSrv.UseSSL.Cert, cfg.GateSrv.UseSSL.PKey); err != nil {
+			fatal("certificate", err)
+		}
+	}
+	provider, err := newProvider()
+	if err != nil {
+		fatal("discovery", err)
+	}
+	if err = net.Ins().Discover(provider); err != nil {
+		fatal("discovery", err)
+	}
+	adminSrv := admin.NewServer()
+	adminSrv.Handle("/metrics", metrics.Default.Handler())
+	adminApi := admin.NewAPI(cfg.GateSrv.AdminToken, net.Ins(), func(text string) iface.IMessage {
+		return codec.NewMessage(codec.MsgIdSystemNotice, 0, []byte(text))
+	})
+	adminApi.Reload = utils.Reload
+	adminApi.Errors = recentErrors
+	adminApi.Register(adminSrv)
+	if port := cfg.GateSrv.AdminPort; port > 0 {
+		if err = adminSrv.Start(port + cfg.ServerId); err != nil {
+			fatal("admin server", err)
+		}
+	}
+	net.Ins().StartService(cfg.GateSrv.BindClientPort + cfg.ServerId)
+	if port := cfg.GateSrv.BindTCPPort; port > 0 {
+		net.Ins().StartTCPService(port + cfg.ServerId)
+	}
+
+	watchExit := make(chan bool, 1)
+	go utils.WatchConfig(ConfigWatchInterval, watchExit)
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	select {
-	case <-c:
-		break
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+	for sig := range c {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		zlog.Info("GateSrv receive SIGHUP, reload config")
+		_ = utils.Reload()
 	}
 	zlog.Warn("GateSrv Shutdown...")
+	watchExit <- true
 	net.Ins().StopService()
+	adminSrv.Stop()
 	zlog.Warn("GateSrv Shutdown...Done")
+	zlog.Close()
+}
+
+// newProvider
+//
+//	@Description: 根据配置创建服务发现, 未配置时退化为各服务的固定地址
+//	@return discovery.IProvider
+//	@return error
+func newProvider() (discovery.IProvider, error) {
+	cfg := utils.GlobalConfig()
+	providerCfg := discovery.Config{
+		Provider: cfg.Discovery.Provider,
+		Path:     cfg.Discovery.Path,
+		Interval: cfg.Discovery.Interval,
+		Static: map[string]string{
+			net.DefaultBackendService: cfg.GameSrv.BindSrvAddr,
+		},
+	}
+	if providerCfg.Provider == "" {
+		providerCfg.Provider = discovery.ProviderStatic
+	}
+	return discovery.NewProvider(providerCfg)
+}
+
+// fatal
+//
+//	@Description: 启动失败, 输出错误(日志已输出到控制台)后以非0状态退出
+//	@param step 出错的启动步骤
+//	@param err 错误
+func fatal(step string, err error) {
+	zlog.Errorf("GateSrv start failed, %s: %v", step, err)
+	zlog.Close()
+	os.Exit(1)
 }
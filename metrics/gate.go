@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"github.com/liaoyudong2/GateServer/zlog"
+	"strconv"
+	"sync"
+)
+
+// 拒绝连接原因
+const (
+	RejectUpgrade  = "upgrade"  // websocket握手失败
+	RejectOverflow = "overflow" // 超过最大会话数
+	RejectNoId     = "no_id"    // 没有空闲的会话ID
+)
+
+// 客户端消息统计中不转发到后端的分类, 其余按转发的服务名统计
+const (
+	ServiceGate     = "gate"     // 网关直接处理(心跳/回显)
+	ServiceReserved = "reserved" // 客户端发送了网关保留的消息ID, 已丢弃
+)
+
+// MsgIdOther 客户端消息统计中未单独建标签的消息ID(被丢弃或超过MaxMsgIdLabels)使用的标签值
+const MsgIdOther = "other"
+
+// MaxMsgIdLabels 客户端消息统计中单独建标签的消息ID上限, 避免客户端任意的消息ID撑大标签
+const MaxMsgIdLabels = 512
+
+// 编解码错误来源
+const (
+	SourceClient  = "client"  // 客户端
+	SourceBackend = "backend" // 后端
+)
+
+// 网关指标
+var (
+	SessionCurrent  = Default.NewGauge("gate_sessions_current", "Current number of client sessions.")
+	SessionPeak     = Default.NewGauge("gate_sessions_peak", "Peak number of client sessions since start.")
+	Accepts         = Default.NewCounter("gate_accepts_total", "Accepted client connections.")
+	Rejects         = Default.NewCounterVec("gate_rejects_total", "Rejected client connections by reason.", "reason")
+	MessagesIn      = Default.NewCounterVec("gate_messages_in_total", "Messages received from clients by msgId.", "msgid")
+	BytesIn         = Default.NewCounterVec("gate_bytes_in_total", "Payload bytes received from clients by msgId.", "msgid")
+	ServiceIn       = Default.NewCounterVec("gate_service_messages_in_total", "Messages received from clients by routed service.", "service")
+	ServiceBytesIn  = Default.NewCounterVec("gate_service_bytes_in_total", "Payload bytes received from clients by routed service.", "service")
+	MessagesOut     = Default.NewCounterVec("gate_messages_out_total", "Messages sent to clients by msgId.", "msgid")
+	BytesOut        = Default.NewCounterVec("gate_bytes_out_total", "Payload bytes sent to clients by msgId.", "msgid")
+	SlowSessions    = Default.NewCounter("gate_slow_sessions_total", "Sessions closed because their write queue was full.")
+	RateLimited     = Default.NewCounter("gate_rate_limited_total", "Client messages dropped by the per-session rate limit.")
+	CodecErrors     = Default.NewCounterVec("gate_codec_errors_total", "Frame decode errors by source.", "source")
+	WriteQueueDepth = Default.NewHistogram("gate_write_queue_depth", "Session write queue depth observed on enqueue.",
+		[]float64{0, 1, 2, 4, 8, 16, 32, 64, 128, 256})
+	SessionLifetime = Default.NewHistogram("gate_session_lifetime_seconds", "Client session lifetime in seconds.",
+		ExponentialBuckets(1, 4, 10))
+	SessionPanics = Default.NewCounterVec("gate_session_panics_total", "Panics recovered in session goroutines by goroutine.", "goroutine")
+	QueueLength   = Default.NewGauge("gate_queue_length", "Connections waiting in the login queue.")
+	QueueJoined   = Default.NewCounterVec("gate_queue_joined_total", "Connections that joined the login queue by lane.", "lane")
+	QueuePromoted = Default.NewCounterVec("gate_queue_promoted_total", "Queued connections promoted to sessions by lane.", "lane")
+	QueueLeft     = Default.NewCounter("gate_queue_left_total", "Queued connections that disconnected or were flushed before promotion.")
+	QueueWait     = Default.NewHistogram("gate_queue_wait_seconds", "Time spent in the login queue before promotion.",
+		ExponentialBuckets(0.5, 2, 12))
+	BackendLatency = Default.NewHistogramVec("gate_backend_rtt_seconds", "Round-trip latency from forwarding to the first backend reply.",
+		"service", ExponentialBuckets(0.0005, 2, 14))
+)
+
+func init() {
+	Default.NewCounterFunc("gate_log_dropped_total", "Log lines dropped because the async log buffer was full.", zlog.Dropped)
+	Default.NewCounterFunc("gate_log_sampled_total", "Log lines suppressed by log sampling.", zlog.Suppressed)
+}
+
+// MsgId
+//
+//	@Description: 消息id标签值
+//	@param id 消息id
+//	@return string
+func MsgId(id uint16) string {
+	return strconv.Itoa(int(id))
+}
+
+// msgIdLabels 客户端消息统计中已单独建标签的消息ID
+var msgIdLabels = struct {
+	sync.RWMutex
+	ids map[uint16]string
+}{ids: make(map[uint16]string)}
+
+// MsgIdLabel
+//
+//	@Description: 网关处理或转发到后端的客户端消息ID的标签值, 已建标签的消息ID达到MaxMsgIdLabels后, 新的消息ID归入MsgIdOther
+//	@param id 消息id
+//	@return string
+func MsgIdLabel(id uint16) string {
+	msgIdLabels.RLock()
+	label, ok := msgIdLabels.ids[id]
+	msgIdLabels.RUnlock()
+	if ok {
+		return label
+	}
+
+	msgIdLabels.Lock()
+	defer msgIdLabels.Unlock()
+	if label, ok = msgIdLabels.ids[id]; ok {
+		return label
+	}
+	if len(msgIdLabels.ids) >= MaxMsgIdLabels {
+		return MsgIdOther
+	}
+	label = MsgId(id)
+	msgIdLabels.ids[id] = label
+	return label
+}
+
+// MessageIn
+//
+//	@Description: 统计通过校验的客户端消息, 按服务和消息ID分类
+//	@param service 转发的服务, 或ServiceGate/ServiceReserved
+//	@param msgId 消息ID标签值, 由MsgIdLabel得到, 丢弃的消息为MsgIdOther
+//	@param size 消息内容字节数
+func MessageIn(service, msgId string, size int) {
+	ServiceIn.With(service).Inc()
+	ServiceBytesIn.With(service).Add(uint64(size))
+	MessagesIn.With(msgId).Inc()
+	BytesIn.With(msgId).Add(uint64(size))
+}
+
+// SessionOpened
+//
+//	@Description: 会话数量增加, 同时刷新峰值
+func SessionOpened() {
+	SessionPeak.SetMax(SessionCurrent.Add(1))
+}
+
+// SessionClosed
+//
+//	@Description: 会话数量减少
+func SessionClosed() {
+	SessionCurrent.Add(-1)
+}
@@ -0,0 +1,23 @@
+package metrics_test
+
+import (
+	"github.com/liaoyudong2/GateServer/metrics"
+	"testing"
+)
+
+func TestMsgIdLabel(t *testing.T) {
+	if label := metrics.MsgIdLabel(1001); label != "1001" {
+		t.Fatalf("label %q, want 1001", label)
+	}
+
+	// 达到上限后新的消息ID归入other, 已建标签的消息ID不受影响
+	for id := 0; id < metrics.MaxMsgIdLabels; id++ {
+		metrics.MsgIdLabel(uint16(2000 + id))
+	}
+	if label := metrics.MsgIdLabel(60000); label != metrics.MsgIdOther {
+		t.Fatalf("label %q after limit, want %q", label, metrics.MsgIdOther)
+	}
+	if label := metrics.MsgIdLabel(1001); label != "1001" {
+		t.Fatalf("label %q after limit, want 1001", label)
+	}
+}
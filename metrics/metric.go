@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter
+// @Description: 只增计数器
+type Counter struct {
+	value atomic.Uint64 // 计数
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) Get() uint64 {
+	return c.value.Load()
+}
+
+// Gauge
+// @Description: 可增减的当前值
+type Gauge struct {
+	value atomic.Int64 // 当前值
+}
+
+func (g *Gauge) Set(n int64) {
+	g.value.Store(n)
+}
+
+func (g *Gauge) Add(n int64) int64 {
+	return g.value.Add(n)
+}
+
+func (g *Gauge) Get() int64 {
+	return g.value.Load()
+}
+
+// SetMax
+//
+//	@Description: 仅当n更大时更新, 用于峰值统计
+//	@receiver g
+//	@param n 新值
+func (g *Gauge) SetMax(n int64) {
+	for {
+		cur := g.value.Load()
+		if n <= cur || g.value.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
+
+// CounterFunc
+// @Description: 输出时读取的计数器, 用于其他模块自行维护的计数
+type CounterFunc func() uint64
+
+// Histogram
+// @Description: 分桶统计
+type Histogram struct {
+	buckets []float64       // 桶上界(升序)
+	counts  []atomic.Uint64 // 各桶计数(非累计)
+	count   atomic.Uint64   // 总次数
+	sum     atomic.Uint64   // 总和(float64 bits)
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	idx := sort.SearchFloat64s(h.buckets, v)
+	if idx < len(h.counts) {
+		h.counts[idx].Add(1)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// CounterVec
+// @Description: 按单个标签区分的计数器
+type CounterVec struct {
+	lock     sync.RWMutex        // 读写锁
+	children map[string]*Counter // 标签值 -> 计数器
+}
+
+func (v *CounterVec) With(value string) *Counter {
+	v.lock.RLock()
+	c, ok := v.children[value]
+	v.lock.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if c, ok = v.children[value]; !ok {
+		c = &Counter{}
+		v.children[value] = c
+	}
+	return c
+}
+
+// HistogramVec
+// @Description: 按单个标签区分的分桶统计
+type HistogramVec struct {
+	buckets  []float64             // 桶上界
+	lock     sync.RWMutex          // 读写锁
+	children map[string]*Histogram // 标签值 -> 分桶统计
+}
+
+func (v *HistogramVec) With(value string) *Histogram {
+	v.lock.RLock()
+	h, ok := v.children[value]
+	v.lock.RUnlock()
+	if ok {
+		return h
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if h, ok = v.children[value]; !ok {
+		h = newHistogram(v.buckets)
+		v.children[value] = h
+	}
+	return h
+}
+
+// ExponentialBuckets
+//
+//	@Description: 生成指数增长的桶
+//	@param start 第一个桶上界
+//	@param factor 增长系数
+//	@param count 桶数量
+//	@return []float64
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sum.Load())
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// 指标类型
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// family
+// @Description: 一个指标名下的全部数据
+type family struct {
+	name   string      // 指标名
+	help   string      // 说明
+	typ    string      // 指标类型
+	label  string      // 标签名(无标签时为空)
+	metric interface{} // *Counter/*Gauge/*Histogram/*CounterVec/*HistogramVec
+}
+
+// Registry
+// @Description: 指标注册表, 输出Prometheus文本格式
+type Registry struct {
+	lock     sync.RWMutex       // 读写锁
+	families []*family          // 按注册顺序
+	names    map[string]*family // 名称索引
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]*family),
+	}
+}
+
+// Default 默认注册表
+var Default = NewRegistry()
+
+func (r *Registry) register(f *family) interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if old, ok := r.names[f.name]; ok {
+		if old.typ != f.typ || old.label != f.label {
+			panic(fmt.Sprintf("metrics: %s registered with different type", f.name))
+		}
+		return old.metric
+	}
+	r.names[f.name] = f
+	r.families = append(r.families, f)
+	return f.metric
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.register(&family{name: name, help: help, typ: TypeCounter, metric: &Counter{}}).(*Counter)
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.register(&family{name: name, help: help, typ: TypeGauge, metric: &Gauge{}}).(*Gauge)
+}
+
+func (r *Registry) NewCounterFunc(name, help string, fn func() uint64) {
+	r.register(&family{name: name, help: help, typ: TypeCounter, metric: CounterFunc(fn)})
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.register(&family{name: name, help: help, typ: TypeHistogram, metric: newHistogram(buckets)}).(*Histogram)
+}
+
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	vec := &CounterVec{children: make(map[string]*Counter)}
+	return r.register(&family{name: name, help: help, typ: TypeCounter, label: label, metric: vec}).(*CounterVec)
+}
+
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	vec := &HistogramVec{buckets: buckets, children: make(map[string]*Histogram)}
+	return r.register(&family{name: name, help: help, typ: TypeHistogram, label: label, metric: vec}).(*HistogramVec)
+}
+
+// WriteText
+//
+//	@Description: 以Prometheus文本格式输出全部指标
+//	@receiver r
+//	@param w 输出
+//	@return error
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.RLock()
+	families := append([]*family(nil), r.families...)
+	r.lock.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		_, _ = fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		switch m := f.metric.(type) {
+		case *Counter:
+			_, _ = fmt.Fprintf(bw, "%s %d\n", f.name, m.Get())
+		case CounterFunc:
+			_, _ = fmt.Fprintf(bw, "%s %d\n", f.name, m())
+		case *Gauge:
+			_, _ = fmt.Fprintf(bw, "%s %d\n", f.name, m.Get())
+		case *Histogram:
+			writeHistogram(bw, f.name, "", m)
+		case *CounterVec:
+			m.lock.RLock()
+			for _, value := range sortedLabels(m.children) {
+				_, _ = fmt.Fprintf(bw, "%s{%s=\"%s\"} %d\n", f.name, f.label, escapeLabel(value), m.children[value].Get())
+			}
+			m.lock.RUnlock()
+		case *HistogramVec:
+			m.lock.RLock()
+			for _, value := range sortedLabels(m.children) {
+				writeHistogram(bw, f.name, fmt.Sprintf("%s=\"%s\",", f.label, escapeLabel(value)), m.children[value])
+			}
+			m.lock.RUnlock()
+		}
+	}
+	return bw.Flush()
+}
+
+// writeHistogram
+//
+//	@Description: 输出分桶统计, 桶计数为累计值
+//	@param w 输出
+//	@param name 指标名
+//	@param labels 额外标签前缀(形如 a="b",)
+//	@param h 分桶统计
+func writeHistogram(w io.Writer, name, labels string, h *Histogram) {
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i].Load()
+		_, _ = fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+	}
+	count := h.count.Load()
+	_, _ = fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, count)
+	if labels != "" {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+	_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.Sum()))
+	_, _ = fmt.Fprintf(w, "%s_count%s %d\n", name, labels, count)
+}
+
+func sortedLabels[T any](children map[string]T) []string {
+	values := make([]string, 0, len(children))
+	for value := range children {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// Handler
+//
+//	@Description: /metrics 接口
+//	@receiver r
+//	@return http.Handler
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(writer)
+	})
+}
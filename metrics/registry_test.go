@@ -0,0 +1,38 @@
+package metrics_test
+
+import (
+	"bytes"
+	"github.com/liaoyudong2/GateServer/metrics"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.NewCounter("test_total", "Counter.").Add(3)
+	r.NewGauge("test_current", "Gauge.").Set(7)
+	vec := r.NewCounterVec("test_msg_total", "Vec.", "msgid")
+	vec.With("2").Inc()
+	vec.With("1").Add(2)
+	h := r.NewHistogram("test_seconds", "Histogram.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"# TYPE test_total counter\ntest_total 3\n",
+		"test_current 7\n",
+		"test_msg_total{msgid=\"1\"} 2\ntest_msg_total{msgid=\"2\"} 1\n",
+		"test_seconds_bucket{le=\"0.1\"} 1\ntest_seconds_bucket{le=\"1\"} 2\ntest_seconds_bucket{le=\"+Inf\"} 3\n",
+		"test_seconds_sum 5.55\ntest_seconds_count 3\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(buf.String(), w) {
+			t.Errorf("missing %q in:\n%s", w, buf.String())
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/discovery"
+	"github.com/liaoyudong2/GateServer/metrics"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	BackendDialTimeout   = 3 * time.Second // 连接超时
+	BackendRetryInterval = 3 * time.Second // 重连间隔
+	BackendWriteQueue    = 1024            // 写队列长度
+	BackendReadBuffer    = 0x4000          // 读缓冲区大小
+	BackendMaxPending    = 0x10000         // 延迟统计最多跟踪的会话数
+)
+
+// Backend
+// @Description: 到单个后端实例的连接, 断线自动重连
+type Backend struct {
+	service    string               // 服务名
+	instance   discovery.Instance   // 实例信息
+	lock       sync.RWMutex         // 读写锁
+	conn       net.Conn             // 连接对象
+	connId     uint64               // 连接序号
+	closed     bool                 // 是否已关闭
+	exitChan   chan bool            // 关闭信号
+	writeChan  chan iface.IMessage  // 写通道
+	sessionMgr iface.ISessionMgr    // 会话管理, 用于回包路由
+	rttLock    sync.Mutex           // 延迟统计锁
+	pending    map[uint32]time.Time // 会话 -> 等待回包的转发时间
+}
+
+func NewBackend(service string, instance discovery.Instance, sessionMgr iface.ISessionMgr) *Backend {
+	backend := &Backend{
+		service:    service,
+		instance:   instance,
+		exitChan:   make(chan bool),
+		writeChan:  make(chan iface.IMessage, BackendWriteQueue),
+		sessionMgr: sessionMgr,
+		pending:    make(map[uint32]time.Time),
+	}
+	go backend.run()
+	return backend
+}
+
+func (b *Backend) GetId() string {
+	return b.instance.Id
+}
+
+func (b *Backend) GetAddress() string {
+	return b.instance.Address
+}
+
+func (b *Backend) GetWeight() int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.instance.Weight
+}
+
+// setInstance
+//
+//	@Description: 更新实例信息(地址不变时)
+//	@receiver b
+//	@param instance 实例
+func (b *Backend) setInstance(instance discovery.Instance) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.instance.Weight = instance.Weight
+	b.instance.Tags = instance.Tags
+}
+
+func (b *Backend) IsConnected() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.conn != nil
+}
+
+func (b *Backend) GetConnId() uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.connId
+}
+
+func (b *Backend) Forward(msg iface.IMessage) bool {
+	if !b.IsConnected() {
+		return false
+	}
+	// 入队后消息可能已被写协程释放, 先取出会话ID
+	sessionId := msg.GetReserve()
+	select {
+	case b.writeChan <- msg:
+		b.markPending(sessionId)
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *Backend) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.exitChan)
+	if b.conn != nil {
+		_ = b.conn.Close()
+	}
+}
+
+// markPending
+//
+//	@Description: 记录会话的转发时间, 已有未回包的记录时保留最早的
+//	@receiver b
+//	@param sessionId 会话ID
+func (b *Backend) markPending(sessionId uint32) {
+	b.rttLock.Lock()
+	defer b.rttLock.Unlock()
+
+	if _, ok := b.pending[sessionId]; ok {
+		return
+	}
+	if len(b.pending) >= BackendMaxPending {
+		// 后端长期不回包的会话过多, 重新统计
+		b.pending = make(map[uint32]time.Time)
+	}
+	b.pending[sessionId] = time.Now()
+}
+
+// observePending
+//
+//	@Description: 收到回包时统计往返延迟
+//	@receiver b
+//	@param sessionId 会话ID
+func (b *Backend) observePending(sessionId uint32) {
+	b.rttLock.Lock()
+	start, ok := b.pending[sessionId]
+	delete(b.pending, sessionId)
+	b.rttLock.Unlock()
+
+	if ok {
+		metrics.BackendLatency.With(b.service).Observe(time.Since(start).Seconds())
+	}
+}
+
+// run
+//
+//	@Description: 连接并维持到后端的连接
+//	@receiver b
+func (b *Backend) run() {
+	for {
+		conn, err := net.DialTimeout("tcp", b.instance.Address, BackendDialTimeout)
+		if err != nil {
+			netLog.Errorf("backend [%s:%s] dial %s error: %v", b.service, b.instance.Id, b.instance.Address, err)
+		} else {
+			b.lock.Lock()
+			if b.closed {
+				b.lock.Unlock()
+				_ = conn.Close()
+				return
+			}
+			b.conn = conn
+			b.connId++
+			b.lock.Unlock()
+
+			netLog.Infof("backend [%s:%s] connected, address: %s", b.service, b.instance.Id, b.instance.Address)
+			done := make(chan bool)
+			go b.startWriter(conn, done)
+			b.startReader(conn)
+			close(done)
+
+			b.lock.Lock()
+			b.conn = nil
+			b.lock.Unlock()
+			_ = conn.Close()
+			netLog.Warnf("backend [%s:%s] disconnected", b.service, b.instance.Id)
+		}
+		select {
+		case <-b.exitChan:
+			return
+		case <-time.After(BackendRetryInterval):
+		}
+	}
+}
+
+// startReader
+//
+//	@Description: 读取后端消息, 按保留字段路由到会话. 处理单个会话的消息时panic只关闭该会话,
+//	其他panic断开当前后端连接后重连, 都不影响网关进程
+//	@receiver b
+//	@param conn 连接
+func (b *Backend) startReader(conn net.Conn) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.onPanic(r, nil)
+		}
+	}()
+	stream := codec.NewStream()
+	buf := make([]byte, BackendReadBuffer)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			netLog.Error("backend read error: ", err)
+			return
+		}
+		data := buf[:n]
+		for readLen := 0; readLen < n; {
+			nread, message, err := stream.UnmarshalFrame(data[readLen:])
+			if err != nil {
+				codecLog.Error("backend net stream unmarshal error: ", err)
+				metrics.CodecErrors.With(metrics.SourceBackend).Inc()
+				return
+			}
+			readLen += nread
+			if message != nil {
+				b.dispatch(message)
+			}
+		}
+	}
+}
+
+// dispatch
+//
+//	@Description: 处理后端的一条消息, 处理中panic时只关闭相关的会话
+//	@receiver b
+//	@param message 后端消息帧, 处理后不能再访问
+func (b *Backend) dispatch(message *codec.Frame) {
+	if message.GetMsgId() == codec.MsgIdBroadcast {
+		b.broadcast(message.GetMsgData())
+		message.Release()
+		return
+	}
+	b.observePending(message.GetReserve())
+	session := b.sessionMgr.GetSession(message.GetReserve())
+	if session == nil {
+		netLog.Warnf("backend message to unknown session, session id: %d, msgId: %d", message.GetReserve(), message.GetMsgId())
+		message.Release()
+		return
+	}
+	defer func() {
+		// 帧可能已交给会话, 不再释放, 由GC回收
+		if r := recover(); r != nil {
+			b.onPanic(r, session)
+		}
+	}()
+	switch message.GetMsgId() {
+	case codec.MsgIdBindUser:
+		session.SetUserId(string(message.GetMsgData()))
+	case codec.MsgIdKick:
+		session.Kick(string(message.GetMsgData()))
+	case codec.MsgIdDisconnect:
+		code, reason := codec.ParseDisconnect(message.GetMsgData())
+		if !codec.IsValidCloseCode(code) {
+			netLog.Warnf("backend [%s] disconnect with invalid close code: %d, kick instead", b.GetId(), code)
+			code = codec.CloseKicked
+		}
+		session.Disconnect(code, reason)
+	case codec.MsgIdTraceContext:
+		// 追踪上下文只由网关发往后端, 后端回传时忽略
+	default:
+		// 帧不复制直接交给会话发送, 客户端与网关之间保留字段为0
+		message.SetReserve(0)
+		session.SendMessage(message)
+		return
+	}
+	message.Release()
+}
+
+// onPanic
+//
+//	@Description: 后端读协程panic后的处理: 记录堆栈和指标, 有相关会话时只关闭该会话, 否则由调用方断开后端连接
+//	@receiver b
+//	@param value panic值
+//	@param session 正在处理的会话, 可以为空
+func (b *Backend) onPanic(value interface{}, session iface.ISession) {
+	metrics.SessionPanics.With("backend").Inc()
+	if session == nil {
+		netLog.Stack(fmt.Sprintf("backend [%s:%s] reader panic: %v", b.service, b.GetId(), value))
+		return
+	}
+	netLog.Stack(fmt.Sprintf("backend [%s:%s] panic on session %d: %v", b.service, b.GetId(), session.GetSessionId(), value))
+	// 会话可能在持锁时panic, 异步关闭, 不阻塞后端读协程
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				netLog.Errorf("backend close panicked session %d error: %v", session.GetSessionId(), r)
+			}
+		}()
+		session.Disconnect(codec.CloseInternalError, "panic")
+	}()
+}
+
+// broadcast
+//
+//	@Description: 将后端的广播消息发送到全部会话, 入队不阻塞, 写队列已满的会话丢弃该帧并被关闭
+//	@receiver b
+//	@param data 广播内容, msgId(2字节) + 消息内容
+func (b *Backend) broadcast(data []byte) {
+	if len(data) < 2 {
+		netLog.Warnf("backend [%s] broadcast message too short, size: %d", b.GetId(), len(data))
+		return
+	}
+	// 只编码一次, 全部会话共享同一个帧, 共享后不能再修改, 编码时保留字段即为0
+	frame := codec.NewFrame(binary.BigEndian.Uint16(data), 0, data[2:])
+	b.sessionMgr.Range(func(session iface.ISession) bool {
+		b.send(session, frame.Retain())
+		return true
+	})
+	frame.Release()
+}
+
+// send
+//
+//	@Description: 发送消息到会话, panic时只关闭该会话, 其他会话照常发送
+//	@receiver b
+//	@param session 会话
+//	@param msg 消息, 转移一个引用
+func (b *Backend) send(session iface.ISession, msg iface.IMessage) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.onPanic(r, session)
+		}
+	}()
+	session.SendMessage(msg)
+}
+
+// startWriter
+//
+//	@Description: 将写队列中的消息发送到后端
+//	@receiver b
+//	@param conn 连接
+//	@param done 读协程结束信号
+func (b *Backend) startWriter(conn net.Conn, done chan bool) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-b.exitChan:
+			return
+		case msg := <-b.writeChan:
+			frame := codec.FrameOf(msg)
+			_, err := conn.Write(frame.Bytes())
+			frame.Release()
+			if err != nil {
+				netLog.Error("backend write error: ", err)
+				_ = conn.Close()
+				return
+			}
+		}
+	}
+}
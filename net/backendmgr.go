@@ -0,0 +1,270 @@
+package net
+
+import (
+	"fmt"
+	"github.com/liaoyudong2/GateServer/discovery"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultBackendService 客户端消息默认转发的服务
+const DefaultBackendService = "game"
+
+// BackendPool
+// @Description: 同一服务的后端连接池
+type BackendPool struct {
+	service  string              // 服务名
+	lock     sync.RWMutex        // 读写锁
+	backends map[string]*Backend // 实例ID -> 连接
+}
+
+func NewBackendPool(service string) *BackendPool {
+	return &BackendPool{
+		service:  service,
+		backends: make(map[string]*Backend),
+	}
+}
+
+func (p *BackendPool) GetService() string {
+	return p.service
+}
+
+func (p *BackendPool) GetBackendCount() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.backends)
+}
+
+func (p *BackendPool) GetBackends() []iface.IBackend {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	backends := make([]iface.IBackend, 0, len(p.backends))
+	for _, backend := range p.backends {
+		backends = append(backends, backend)
+	}
+	sort.Slice(backends, func(i, j int) bool {
+		return backends[i].GetId() < backends[j].GetId()
+	})
+	return backends
+}
+
+// Pick
+//
+//	@Description: 加权一致性选择(rendezvous hash), 实例增减时只有受影响的会话会迁移
+//	@receiver p
+//	@param sessionId 会话ID
+//	@return iface.IBackend
+func (p *BackendPool) Pick(sessionId uint32) iface.IBackend {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	var picked *Backend
+	best := math.Inf(-1)
+	for id, backend := range p.backends {
+		if !backend.IsConnected() {
+			continue
+		}
+		h := fnv.New64a()
+		_, _ = fmt.Fprintf(h, "%s/%d", id, sessionId)
+		// 将hash映射到(0,1), score = -weight / ln(u)
+		u := (float64(mixHash(h.Sum64())>>11) + 0.5) / float64(1<<53)
+		score := -float64(backend.GetWeight()) / math.Log(u)
+		if score > best || (picked != nil && score == best && id < picked.GetId()) {
+			best = score
+			picked = backend
+		}
+	}
+	if picked == nil {
+		return nil
+	}
+	return picked
+}
+
+// mixHash
+//
+//	@Description: 打散fnv的高位, 短key只差末尾几个字符时fnv高位分布不均, 会让等权重的实例分到的会话相差很多
+//	@param h hash值
+//	@return uint64
+func mixHash(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// apply
+//
+//	@Description: 应用实例变更
+//	@receiver p
+//	@param ev 变更事件
+//	@param sessionMgr 会话管理
+func (p *BackendPool) apply(ev discovery.Event, sessionMgr iface.ISessionMgr) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	backend, ok := p.backends[ev.Instance.Id]
+	switch ev.Type {
+	case discovery.EventAdd, discovery.EventUpdate:
+		if ok && backend.GetAddress() == ev.Instance.Address {
+			backend.setInstance(ev.Instance)
+			return
+		}
+		if ok {
+			backend.Close()
+		}
+		p.backends[ev.Instance.Id] = NewBackend(p.service, ev.Instance, sessionMgr)
+	case discovery.EventRemove:
+		if ok {
+			backend.Close()
+			delete(p.backends, ev.Instance.Id)
+		}
+	}
+}
+
+func (p *BackendPool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for id, backend := range p.backends {
+		backend.Close()
+		delete(p.backends, id)
+	}
+}
+
+// BackendRoute
+// @Description: 消息ID区间到服务的路由
+type BackendRoute struct {
+	MsgIdMin uint16 // 起始消息ID(包含)
+	MsgIdMax uint16 // 结束消息ID(包含)
+	Service  string // 服务名
+}
+
+// BackendMgr
+// @Description: 按服务名管理后端连接池, 由服务发现驱动更新
+type BackendMgr struct {
+	lock       sync.RWMutex            // 读写锁
+	pools      map[string]*BackendPool // 服务名 -> 连接池
+	routes     []BackendRoute          // 消息路由, 按顺序匹配
+	sessionMgr iface.ISessionMgr       // 会话管理
+}
+
+func NewBackendMgr(sessionMgr iface.ISessionMgr) *BackendMgr {
+	return &BackendMgr{
+		pools:      make(map[string]*BackendPool),
+		sessionMgr: sessionMgr,
+	}
+}
+
+func (m *BackendMgr) GetPool(service string) iface.IBackendPool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if pool, ok := m.pools[service]; ok {
+		return pool
+	}
+	return nil
+}
+
+// SetRoutes
+//
+//	@Description: 替换消息路由, 未匹配的消息转发到默认服务
+//	@receiver m
+//	@param routes 路由
+func (m *BackendMgr) SetRoutes(routes []BackendRoute) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.routes = append([]BackendRoute(nil), routes...)
+}
+
+func (m *BackendMgr) Route(msgId uint16) string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, route := range m.routes {
+		if msgId >= route.MsgIdMin && msgId <= route.MsgIdMax {
+			return route.Service
+		}
+	}
+	return DefaultBackendService
+}
+
+// Pick
+//
+//	@Description: 为会话选择服务的后端
+//	@receiver m
+//	@param service 服务名
+//	@param sessionId 会话ID
+//	@return iface.IBackend
+//	@return error 服务未定义或没有可用的后端
+func (m *BackendMgr) Pick(service string, sessionId uint32) (iface.IBackend, error) {
+	pool := m.GetPool(service)
+	if pool == nil {
+		return nil, fmt.Errorf("backend service undefined: %s", service)
+	}
+	backend := pool.Pick(sessionId)
+	if backend == nil {
+		return nil, fmt.Errorf("backend service unavailable: %s", service)
+	}
+	return backend, nil
+}
+
+func (m *BackendMgr) Forward(service string, sessionId uint32, msg iface.IMessage) error {
+	backend, err := m.Pick(service, sessionId)
+	if err != nil {
+		return err
+	}
+	return forwardTo(service, backend, msg)
+}
+
+// forwardTo
+//
+//	@Description: 转发消息到选定的后端
+//	@param service 服务名
+//	@param backend 后端
+//	@param msg 消息, 返回错误时引用仍由调用方持有
+//	@return error 写队列已满或未连接
+func forwardTo(service string, backend iface.IBackend, msg iface.IMessage) error {
+	if !backend.Forward(msg) {
+		return fmt.Errorf("backend [%s:%s] write queue full", service, backend.GetId())
+	}
+	return nil
+}
+
+// HandleEvents
+//
+//	@Description: 服务发现变更回调
+//	@receiver m
+//	@param evs 变更事件
+func (m *BackendMgr) HandleEvents(evs []discovery.Event) {
+	for _, ev := range evs {
+		netLog.Infof("backend manager: [%s] service:%s id:%s address:%s weight:%d",
+			ev.Type, ev.Service, ev.Instance.Id, ev.Instance.Address, ev.Instance.Weight)
+
+		m.lock.Lock()
+		pool, ok := m.pools[ev.Service]
+		if !ok {
+			pool = NewBackendPool(ev.Service)
+			m.pools[ev.Service] = pool
+		}
+		m.lock.Unlock()
+
+		pool.apply(ev, m.sessionMgr)
+	}
+}
+
+func (m *BackendMgr) Close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, pool := range m.pools {
+		pool.close()
+	}
+}
@@ -0,0 +1,124 @@
+package net_test
+
+import (
+	"github.com/liaoyudong2/GateServer/discovery"
+	"github.com/liaoyudong2/GateServer/fakebackend"
+	"github.com/liaoyudong2/GateServer/gatetest"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"testing"
+	"time"
+)
+
+// pickSessions 测试选择后端的会话数量
+const pickSessions = 4000
+
+// startPool 启动多个模拟后端并加入同一服务, 等待全部连上后返回连接池
+func startPool(t *testing.T, mgr *gatenet.BackendMgr, weights map[string]int) iface.IBackendPool {
+	t.Helper()
+	var evs []discovery.Event
+	for id, weight := range weights {
+		backend := fakebackend.New()
+		if err := backend.Start("127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = backend.Close() })
+		evs = append(evs, discovery.Event{
+			Type:     discovery.EventAdd,
+			Service:  gatenet.DefaultBackendService,
+			Instance: discovery.Instance{Id: id, Address: backend.Addr(), Weight: weight},
+		})
+	}
+	mgr.HandleEvents(evs)
+	pool := mgr.GetPool(gatenet.DefaultBackendService)
+	deadline := time.Now().Add(gatetest.DefaultTimeout)
+	for !allConnected(pool) {
+		if time.Now().After(deadline) {
+			t.Fatal("backends not connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return pool
+}
+
+func allConnected(pool iface.IBackendPool) bool {
+	for _, backend := range pool.GetBackends() {
+		if !backend.IsConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+// pickAll 每个会话选中的后端ID
+func pickAll(pool iface.IBackendPool) map[uint32]string {
+	picked := make(map[uint32]string, pickSessions)
+	for sessionId := uint32(1); sessionId <= pickSessions; sessionId++ {
+		if backend := pool.Pick(sessionId); backend != nil {
+			picked[sessionId] = backend.GetId()
+		}
+	}
+	return picked
+}
+
+func TestBackendPoolPick(t *testing.T) {
+	mgr := gatenet.NewBackendMgr(gatenet.NewSessionMgr(0))
+	defer mgr.Close()
+	weights := map[string]int{"a": 1, "b": 1, "c": 2}
+	pool := startPool(t, mgr, weights)
+
+	// 按权重分配, 同一会话多次选择结果相同
+	picked := pickAll(pool)
+	counts := make(map[string]int)
+	for sessionId, id := range picked {
+		counts[id]++
+		if again := pool.Pick(sessionId); again.GetId() != id {
+			t.Fatalf("session %d picked %s then %s", sessionId, id, again.GetId())
+		}
+	}
+	for id, weight := range weights {
+		want := pickSessions * weight / 4
+		if n := counts[id]; n < want*85/100 || n > want*115/100 {
+			t.Errorf("backend %s picked %d times, want about %d", id, n, want)
+		}
+	}
+
+	// 下线一个实例只迁移原来落在它上面的会话
+	mgr.HandleEvents([]discovery.Event{{
+		Type:     discovery.EventRemove,
+		Service:  gatenet.DefaultBackendService,
+		Instance: discovery.Instance{Id: "c"},
+	}})
+	moved := pickAll(pool)
+	for sessionId, id := range picked {
+		if id == "c" {
+			if moved[sessionId] == "c" || moved[sessionId] == "" {
+				t.Fatalf("session %d not moved off removed backend: %q", sessionId, moved[sessionId])
+			}
+		} else if moved[sessionId] != id {
+			t.Fatalf("session %d moved from %s to %s", sessionId, id, moved[sessionId])
+		}
+	}
+}
+
+func TestBackendPoolPickUnavailable(t *testing.T) {
+	mgr := gatenet.NewBackendMgr(gatenet.NewSessionMgr(0))
+	defer mgr.Close()
+	startPool(t, mgr, map[string]int{"a": 1})
+
+	// 实例全部下线后没有可选的后端
+	mgr.HandleEvents([]discovery.Event{{
+		Type:     discovery.EventRemove,
+		Service:  gatenet.DefaultBackendService,
+		Instance: discovery.Instance{Id: "a"},
+	}})
+	if backend := mgr.GetPool(gatenet.DefaultBackendService).Pick(1); backend != nil {
+		t.Fatalf("picked removed backend %s", backend.GetId())
+	}
+	if err := mgr.Forward(gatenet.DefaultBackendService, 1, nil); err == nil {
+		t.Fatal("forward to empty pool succeeded")
+	}
+	if err := mgr.Forward("unknown", 1, nil); err == nil {
+		t.Fatal("forward to undefined service succeeded")
+	}
+}
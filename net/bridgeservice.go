@@ -1,100 +1,598 @@
 package net
 
 import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/discovery"
+	"github.com/liaoyudong2/GateServer/metrics"
 	"github.com/liaoyudong2/GateServer/net/iface"
-	"github.com/liaoyudong2/GateServer/zlog"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // BridgeService
 // @Description: 桥服务
 type BridgeService struct {
-	listener    net.Listener      // 监听对象
-	lock        sync.RWMutex      // 读写锁
-	exitChan    chan bool         // 退出信号
-	sessionIter atomic.Uint32     // 会话自增ID
-	maxSession  int               // 最大会话数量
-	sessionMgr  iface.ISessionMgr // 连接管理
+	lock        sync.RWMutex                    // 读写锁
+	server      *http.Server                    // websocket服务, 使用独立的路由
+	listener    net.Listener                    // 监听对象
+	tcpListener net.Listener                    // tcp客户端监听对象
+	upgrader    websocket.Upgrader              // websocket升级
+	serving     sync.WaitGroup                  // 监听协程和处理新tcp连接的协程
+	stopped     bool                            // 是否已停止
+	sessionIds  *SessionIdGenerator             // 会话ID生成器
+	queue       *LoginQueue                     // 登录排队
+	sessionMgr  iface.ISessionMgr               // 连接管理
+	backendMgr  *BackendMgr                     // 后端连接管理
+	provider    discovery.IProvider             // 服务发现
+	options     SessionOptions                  // 会话共享设置
+	certificate atomic.Pointer[tls.Certificate] // TLS证书, 为空时不开启TLS
 }
 
 const DefaultMaxSession = 1024
 
-var gateService = &BridgeService{
-	exitChan:   make(chan bool, 1),
-	maxSession: DefaultMaxSession,
-	sessionMgr: NewSessionMgr(DefaultMaxSession),
+// ErrServiceStarted 重复启动监听
+var ErrServiceStarted = errors.New("BridgeService is already startup")
+
+// ErrServiceStopped 服务已停止
+var ErrServiceStopped = errors.New("BridgeService is stopped")
+
+var gateService = NewBridgeService()
+
+// NewBridgeService
+//
+//	@Description: 创建桥服务, 各实例的会话、后端连接和监听相互独立, 进程内的网关使用Ins()
+//	@return *BridgeService
+func NewBridgeService() *BridgeService {
+	sessionMgr := NewShardedSessionMgr(DefaultMaxSession, DefaultSessionShards)
+	gs := &BridgeService{
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+		sessionIds: NewSessionIdGenerator(0, 0),
+		sessionMgr: sessionMgr,
+		backendMgr: NewBackendMgr(sessionMgr),
+	}
+	gs.options.Slots.SetMax(DefaultMaxSession)
+	gs.options.Slots.SetOverflow(DefaultRetryAfter, false)
+	gs.queue = NewLoginQueue(&gs.options.Slots, gs.accept)
+	return gs
 }
 
 func Ins() *BridgeService {
 	return gateService
 }
 
+// StartService
+//
+//	@Description: 在全部网卡上监听websocket客户端, 监听失败时panic
+//	@receiver gs
+//	@param port 端口
 func (gs *BridgeService) StartService(port int) {
+	if err := gs.Listen(fmt.Sprintf("0.0.0.0:%d", port)); err != nil {
+		if errors.Is(err, ErrServiceStarted) {
+			netLog.Error(err)
+			return
+		}
+		panic(err)
+	}
+}
+
+// Listen
+//
+//	@Description: 监听websocket客户端并在后台服务, 端口为0时使用随机端口, 通过Addr获取实际地址
+//	@receiver gs
+//	@param addr 监听地址
+//	@return error
+func (gs *BridgeService) Listen(addr string) error {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	if gs.stopped {
+		return ErrServiceStopped
+	}
 	if gs.listener != nil {
-		zlog.Error("BridgeService is already startup")
-	} else {
-		addr := fmt.Sprintf("0.0.0.0:%d", port)
+		return ErrServiceStarted
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", gs.serveWebSocket)
+	server := &http.Server{Handler: mux}
+	useTLS := gs.certificate.Load() != nil
+	if useTLS {
+		server.TLSConfig = &tls.Config{GetCertificate: gs.getCertificate}
+	}
+	gs.server = server
+	gs.listener = listener
 
-		var websocketUpgrade = websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
+	netLog.Infof("BridgeService startup, listen at %v, tls: %v", listener.Addr(), useTLS)
+	gs.serving.Add(1)
+	go func() {
+		defer gs.serving.Done()
+		var err error
+		if useTLS {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
 		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			netLog.Errorf("BridgeService serve error: %v", err)
+		}
+	}()
+	return nil
+}
 
-		http.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
-			conn, err := websocketUpgrade.Upgrade(writer, request, nil)
+// serveWebSocket
+//
+//	@Description: 先占用会话名额再升级; 已满时开启排队则进入排队, 否则不做握手直接返回503.
+//	排队令牌通过请求参数queue_token或请求头X-Queue-Token携带
+//	@receiver gs
+//	@param writer
+//	@param request
+func (gs *BridgeService) serveWebSocket(writer http.ResponseWriter, request *http.Request) {
+	slots := &gs.options.Slots
+	if gs.queue.Waiting() || !slots.Acquire() {
+		if gs.queue.Accepting() {
+			conn, err := gs.upgrader.Upgrade(writer, request, nil)
 			if err != nil {
-				zlog.Errorf("accept tcp error: %v", err)
+				metrics.Rejects.With(metrics.RejectUpgrade).Inc()
 				return
 			}
-			if gs.sessionMgr.GetSessionCount() >= gs.maxSession {
-				zlog.Error("session count overflow, limit count is %d", gs.maxSession)
-				_ = conn.Close()
-				return
+			token := request.URL.Query().Get("queue_token")
+			if token == "" {
+				token = request.Header.Get("X-Queue-Token")
 			}
-			gs.sessionIter.Add(1)
-			gs.sessionMgr.AddSession(NewSession(gs.sessionIter.Load(), conn, gs.sessionMgr))
-		})
-
-		zlog.Infof("BridgeService startup, listen at %v", addr)
-		err := http.ListenAndServe(addr, nil)
+			if !gs.queue.Join(codec.NewWebSocketConn(conn), gs.queue.Lane(token)) {
+				gs.overflow()
+				rejectOverflow(codec.NewWebSocketConn(conn), slots.RetryAfter())
+			}
+			return
+		}
+		gs.overflow()
+		if !slots.IsUpgrade() {
+			writer.Header().Set("Retry-After", strconv.Itoa(slots.RetryAfter()))
+			http.Error(writer, "session count overflow", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := gs.upgrader.Upgrade(writer, request, nil)
 		if err != nil {
-			panic(err)
+			return
 		}
+		rejectOverflow(codec.NewWebSocketConn(conn), slots.RetryAfter())
+		return
 	}
+	conn, err := gs.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		slots.Release()
+		netLog.Errorf("accept tcp error: %v", err)
+		metrics.Rejects.With(metrics.RejectUpgrade).Inc()
+		return
+	}
+	gs.accept(codec.NewWebSocketConn(conn))
 }
 
-func (gs *BridgeService) StopService() {
-	if gs.listener != nil {
-		gs.exitChan <- true
-		// 等待结束信号
-		select {
-		case <-gs.exitChan:
-			break
+// rejectOverflow
+//
+//	@Description: 发送codec.MsgIdOverflow后以codec.CloseOverflow关闭
+//	@param conn 客户端连接
+//	@param retryAfter 建议重试的秒数
+func rejectOverflow(conn iface.IConn, retryAfter int) {
+	setWriteDeadline(conn, time.Now().Add(codec.CloseTimeout))
+	_ = conn.WriteData(overflowFrame(retryAfter))
+	_ = conn.CloseWith(codec.CloseOverflow, "session count overflow")
+}
+
+// serveTCP
+//
+//	@Description: 占用会话名额后接入, 已满时开启排队则进入普通通道排队, 否则发送codec.MsgIdOverflow后关闭
+//	@receiver gs
+//	@param conn 客户端连接
+func (gs *BridgeService) serveTCP(conn net.Conn) {
+	if gs.queue.Waiting() || !gs.options.Slots.Acquire() {
+		if gs.queue.Join(codec.NewTCPConn(conn), LaneNormal) {
+			return
+		}
+		gs.overflow()
+		rejectOverflow(codec.NewTCPConn(conn), gs.options.Slots.RetryAfter())
+		return
+	}
+	gs.accept(codec.NewTCPConn(conn))
+}
+
+// overflow
+//
+//	@Description: 记录会话已满的拒绝
+//	@receiver gs
+func (gs *BridgeService) overflow() {
+	netLog.Errorf("session count overflow, limit count is %d", gs.options.Slots.GetMax())
+	metrics.Rejects.With(metrics.RejectOverflow).Inc()
+}
+
+// overflowFrame
+//
+//	@Description: 会话已满的通知消息
+//	@param retryAfter 建议重试的秒数
+//	@return []byte
+func overflowFrame(retryAfter int) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(retryAfter))
+	return codec.NewStream().Marshal(codec.NewMessage(codec.MsgIdOverflow, 0, data))
+}
+
+// StartTCPService
+//
+//	@Description: 在全部网卡上监听tcp客户端, 消息帧格式与websocket相同, 监听失败时panic
+//	@receiver gs
+//	@param port 端口
+func (gs *BridgeService) StartTCPService(port int) {
+	if err := gs.ListenTCP(fmt.Sprintf("0.0.0.0:%d", port)); err != nil {
+		if errors.Is(err, ErrServiceStarted) {
+			netLog.Error(err)
+			return
 		}
-		close(gs.exitChan)
+		panic(err)
+	}
+}
+
+// ListenTCP
+//
+//	@Description: 监听tcp客户端并在后台服务, 端口为0时使用随机端口, 通过TCPAddr获取实际地址
+//	@receiver gs
+//	@param addr 监听地址
+//	@return error
+func (gs *BridgeService) ListenTCP(addr string) error {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	if gs.stopped {
+		return ErrServiceStopped
+	}
+	if gs.tcpListener != nil {
+		return ErrServiceStarted
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	gs.tcpListener = listener
+
+	netLog.Infof("BridgeService tcp startup, listen at %v", listener.Addr())
+	gs.serving.Add(1)
+	go func() {
+		defer gs.serving.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				netLog.Errorf("accept tcp error: %v", err)
+				metrics.Rejects.With(metrics.RejectUpgrade).Inc()
+				continue
+			}
+			// 排队通知和拒绝都可能等待写超时, 不能阻塞accept
+			gs.serving.Add(1)
+			go func() {
+				defer gs.serving.Done()
+				gs.serveTCP(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Addr
+//
+//	@Description: websocket监听的实际地址, 未监听时为空
+//	@receiver gs
+//	@return string
+func (gs *BridgeService) Addr() string {
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	if gs.listener == nil {
+		return ""
+	}
+	return gs.listener.Addr().String()
+}
+
+// TCPAddr
+//
+//	@Description: tcp监听的实际地址, 未监听时为空
+//	@receiver gs
+//	@return string
+func (gs *BridgeService) TCPAddr() string {
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	if gs.tcpListener == nil {
+		return ""
 	}
+	return gs.tcpListener.Addr().String()
+}
+
+// accept
+//
+//	@Description: 为已占用名额的新连接创建会话, 服务停止后直接关闭连接并归还名额
+//	@receiver gs
+//	@param conn 客户端连接
+func (gs *BridgeService) accept(conn iface.IConn) {
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	if gs.stopped {
+		gs.options.Slots.Release()
+		_ = conn.Close()
+		return
+	}
+	sessionId, err := gs.sessionIds.Next(func(sessionId uint32) bool {
+		return gs.sessionMgr.GetSession(sessionId) != nil
+	})
+	if err != nil {
+		netLog.Errorf("session id allocate error: %v", err)
+		metrics.Rejects.With(metrics.RejectNoId).Inc()
+		gs.options.Slots.Release()
+		_ = conn.Close()
+		return
+	}
+	metrics.Accepts.Inc()
+	gs.sessionMgr.AddSession(NewSession(sessionId, conn, gs.sessionMgr, gs.backendMgr, &gs.options))
+}
+
+// StopService
+//
+//	@Description: 停止监听, 关闭全部会话和后端连接, 停止后不能再启动
+//	@receiver gs
+func (gs *BridgeService) StopService() {
+	gs.lock.Lock()
+	if gs.stopped {
+		gs.lock.Unlock()
+		return
+	}
+	gs.stopped = true
+	server, tcpListener := gs.server, gs.tcpListener
+	gs.lock.Unlock()
+
+	gs.queue.Stop()
+	if gs.provider != nil {
+		gs.provider.Stop()
+	}
+	if server != nil {
+		_ = server.Close()
+	}
+	if tcpListener != nil {
+		_ = tcpListener.Close()
+	}
+	gs.serving.Wait()
+	gs.sessionMgr.Range(func(session iface.ISession) bool {
+		session.Disconnect(codec.CloseShutdown, "service stop")
+		return true
+	})
+	gs.backendMgr.Close()
+	netLog.Info("BridgeService stopped")
+}
+
+// SetSessionIdGenerator
+//
+//	@Description: 设置会话ID生成器, 应在开始监听前调用
+//	@receiver gs
+//	@param generator 会话ID生成器
+func (gs *BridgeService) SetSessionIdGenerator(generator *SessionIdGenerator) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	gs.sessionIds = generator
+	netLog.Infof("BridgeService session id server: %d, epoch: %d", generator.GetServerId(), generator.GetEpoch())
 }
 
 func (gs *BridgeService) SetMaxSession(num int) {
-	gs.maxSession = num
+	gs.options.Slots.SetMax(num)
+}
+
+func (gs *BridgeService) GetMaxSession() int {
+	return gs.options.Slots.GetMax()
+}
+
+// SetLoginQueue
+//
+//	@Description: 设置登录排队, 见LoginQueue.Set
+//	@receiver gs
+//	@param open 是否开启
+//	@param maxLen 最大排队数, 0为不限制
+//	@param interval 排名通知间隔
+//	@param vipTokens VIP令牌
+func (gs *BridgeService) SetLoginQueue(open bool, maxLen int, interval time.Duration, vipTokens []string) {
+	gs.queue.Set(open, maxLen, interval, vipTokens)
+}
+
+func (gs *BridgeService) GetLoginQueue() iface.ILoginQueue {
+	return gs.queue
+}
+
+// SetOverflow
+//
+//	@Description: 设置会话已满时的处理, 见SessionSlots
+//	@receiver gs
+//	@param retryAfter 建议客户端重试的间隔
+//	@param upgrade websocket是否完成握手后再以关闭码通知
+func (gs *BridgeService) SetOverflow(retryAfter time.Duration, upgrade bool) {
+	gs.options.Slots.SetOverflow(retryAfter, upgrade)
+}
+
+// SetRateLimit
+//
+//	@Description: 设置单个会话的消息频率限制, 对已有会话同样生效
+//	@receiver gs
+//	@param rate 每秒消息数, 0为不限制
+//	@param burst 突发上限
+func (gs *BridgeService) SetRateLimit(rate, burst int) {
+	gs.options.RateLimit.Set(rate, burst)
+}
+
+// SetRequestId
+//
+//	@Description: 开启或关闭请求ID, 开启后每条转发消息都带追踪上下文, 对已有会话同样生效
+//	@receiver gs
+//	@param enabled 是否开启
+func (gs *BridgeService) SetRequestId(enabled bool) {
+	gs.options.Tracing.SetRequestId(enabled)
+}
+
+// SetEcho
+//
+//	@Description: 开启或关闭回显, 开启后codec.MsgIdEcho消息由网关直接返回, 用于压测
+//	@receiver gs
+//	@param enabled 是否开启
+func (gs *BridgeService) SetEcho(enabled bool) {
+	gs.options.Echo.Store(enabled)
+}
+
+// SetCrashDumpDir
+//
+//	@Description: 设置会话崩溃转储目录, 为空时只记录日志不写文件
+//	@receiver gs
+//	@param dir 目录
+func (gs *BridgeService) SetCrashDumpDir(dir string) {
+	gs.options.CrashDump.SetDir(dir)
+}
+
+// SetRecordDir
+//
+//	@Description: 设置流量录制目录
+//	@receiver gs
+//	@param dir 目录
+func (gs *BridgeService) SetRecordDir(dir string) {
+	gs.options.Recording.SetDir(dir)
+}
+
+// SetRecordUsers
+//
+//	@Description: 整体替换需要录制的用户, 对已在线的会话立即生效
+//	@receiver gs
+//	@param userIds 用户ID
+func (gs *BridgeService) SetRecordUsers(userIds []string) {
+	gs.options.Recording.SetUsers(userIds)
+	gs.sessionMgr.Range(func(session iface.ISession) bool {
+		if userId := session.GetUserId(); userId != "" {
+			_ = session.Record(gs.options.Recording.Wants(session.GetSessionId(), userId))
+		}
+		return true
+	})
+}
+
+// RecordSession
+//
+//	@Description: 开始或停止录制指定会话
+//	@receiver gs
+//	@param sessionId 会话ID
+//	@param enabled 是否录制
+//	@return error
+func (gs *BridgeService) RecordSession(sessionId uint32, enabled bool) error {
+	session := gs.sessionMgr.GetSession(sessionId)
+	if session == nil {
+		return fmt.Errorf("session undefined, session id: %d", sessionId)
+	}
+	gs.options.Recording.SetSession(sessionId, enabled)
+	return session.Record(enabled || gs.options.Recording.Wants(sessionId, session.GetUserId()))
+}
+
+// RecordUser
+//
+//	@Description: 开始或停止录制指定用户, 包括已在线和之后登录的会话
+//	@receiver gs
+//	@param userId 用户ID
+//	@param enabled 是否录制
+func (gs *BridgeService) RecordUser(userId string, enabled bool) {
+	gs.options.Recording.SetUser(userId, enabled)
+	gs.sessionMgr.Range(func(session iface.ISession) bool {
+		if session.GetUserId() == userId {
+			_ = session.Record(gs.options.Recording.Wants(session.GetSessionId(), userId))
+		}
+		return true
+	})
+}
+
+// RecordTargets
+//
+//	@Description: 当前需要录制的会话和用户
+//	@receiver gs
+//	@return []uint32
+//	@return []string
+func (gs *BridgeService) RecordTargets() ([]uint32, []string) {
+	return gs.options.Recording.Targets()
+}
+
+// SetCertificate
+//
+//	@Description: 加载TLS证书, 启动前调用开启TLS, 运行中调用则新连接使用新证书
+//	@receiver gs
+//	@param certFile 证书文件
+//	@param keyFile 私钥文件
+//	@return error
+func (gs *BridgeService) SetCertificate(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	gs.certificate.Store(&cert)
+	netLog.Infof("BridgeService certificate loaded: %s", certFile)
+	return nil
+}
+
+func (gs *BridgeService) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := gs.certificate.Load(); cert != nil {
+		return cert, nil
+	}
+	return nil, errors.New("certificate undefined")
+}
+
+func (gs *BridgeService) SetRoutes(routes []BackendRoute) {
+	gs.backendMgr.SetRoutes(routes)
 }
 
 func (gs *BridgeService) GetSessionMgr() iface.ISessionMgr {
 	return gs.sessionMgr
 }
 
+func (gs *BridgeService) GetBackendMgr() iface.IBackendMgr {
+	return gs.backendMgr
+}
+
+// Discover
+//
+//	@Description: 启动服务发现, 后端连接池随实例变化实时更新
+//	@receiver gs
+//	@param provider 服务发现提供者
+//	@return error
+func (gs *BridgeService) Discover(provider discovery.IProvider) error {
+	if err := provider.Start(); err != nil {
+		return err
+	}
+	gs.provider = provider
+	provider.Subscribe(gs.backendMgr.HandleEvents)
+	netLog.Infof("BridgeService discovery started, provider: %s", provider.Name())
+	return nil
+}
+
 func (gs *BridgeService) SendMessageToSession(sessionId uint32, msg iface.IMessage) {
 	session := gs.sessionMgr.GetSession(sessionId)
 	if session == nil {
-		zlog.Errorf("session undefined, session id: %d", sessionId)
+		netLog.Errorf("session undefined, session id: %d", sessionId)
 	} else {
 		session.SendMessage(msg)
 	}
@@ -103,8 +601,19 @@ func (gs *BridgeService) SendMessageToSession(sessionId uint32, msg iface.IMessa
 func (gs *BridgeService) RawBufferToSession(sessionId uint32, buf []byte) {
 	session := gs.sessionMgr.GetSession(sessionId)
 	if session == nil {
-		zlog.Errorf("session undefined, session id: %d", sessionId)
+		netLog.Errorf("session undefined, session id: %d", sessionId)
 	} else {
 		session.RawBuffer(buf)
 	}
 }
+
+func (gs *BridgeService) Broadcast(msg iface.IMessage) {
+	// 只编码一次, 全部会话共享同一个帧, 共享后不能再修改, 编码时保留字段即为0
+	// SendMessage不阻塞, 单个慢会话不会拖住广播方, 其写队列写满时会被关闭
+	frame := codec.NewFrame(msg.GetMsgId(), 0, msg.GetMsgData())
+	gs.sessionMgr.Range(func(session iface.ISession) bool {
+		session.SendMessage(frame.Retain())
+		return true
+	})
+	frame.Release()
+}
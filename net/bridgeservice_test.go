@@ -0,0 +1,486 @@
+package net_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/liaoyudong2/GateServer/client"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/gatetest"
+	"github.com/liaoyudong2/GateServer/metrics"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMain 测试日志不写文件, 需要检查日志的用例自行调用zlog.StartCapture
+func TestMain(m *testing.M) {
+	zlog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// closedState 客户端关闭时通知
+func closedState(c *client.Client) chan error {
+	closed := make(chan error, 1)
+	c.OnState(func(state client.State, err error) {
+		if state == client.StateClosed {
+			closed <- err
+		}
+	})
+	return closed
+}
+
+func TestBridgeServiceSessions(t *testing.T) {
+	gateA := gatetest.Start(t)
+	gateB := gatetest.Start(t)
+
+	clients := []*client.Client{
+		gateA.Dial(client.Config{}),
+		gateA.Dial(client.Config{}),
+		gateA.Dial(client.Config{Addr: gateA.TCPURL()}),
+	}
+	gateB.Dial(client.Config{Addr: gateB.TCPURL()})
+	gateA.WaitSessions(3)
+	gateB.WaitSessions(1)
+
+	_ = clients[0].Close()
+	_ = clients[2].Close()
+	gateA.WaitSessions(1)
+	gateB.WaitSessions(1)
+}
+
+// expectDisconnect 等待客户端关闭, 关闭原因为网关通知的关闭码和原因
+func expectDisconnect(t *testing.T, closed chan error, code uint16, reason string) {
+	t.Helper()
+	var disconnect *client.DisconnectError
+	select {
+	case err := <-closed:
+		if !errors.As(err, &disconnect) || disconnect.Code != code || disconnect.Reason != reason {
+			t.Fatalf("closed with %v, want code %d reason %q", err, code, reason)
+		}
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("client not closed")
+	}
+}
+
+func TestBridgeServiceDelivery(t *testing.T) {
+	gate := gatetest.Start(t)
+	received := make(chan iface.IMessage, 4)
+	handler := func(msg iface.IMessage) {
+		received <- msg
+	}
+	ws := gate.Dial(client.Config{})
+	ws.HandleDefault(handler)
+	tcp := gate.Dial(client.Config{Addr: gate.TCPURL(), Heartbeat: 10 * time.Millisecond})
+	tcp.HandleDefault(handler)
+	gate.WaitSessions(2)
+
+	expect := func(msgId uint16, data string) {
+		t.Helper()
+		select {
+		case msg := <-received:
+			if msg.GetMsgId() != msgId || string(msg.GetMsgData()) != data {
+				t.Fatalf("received msgId %d %q, want %d %q", msg.GetMsgId(), msg.GetMsgData(), msgId, data)
+			}
+			// 会话ID不下发到客户端
+			if msg.GetReserve() != 0 {
+				t.Fatalf("received msgId %d with reserve %d, want 0", msgId, msg.GetReserve())
+			}
+		case <-time.After(gatetest.DefaultTimeout):
+			t.Fatalf("msgId %d not received", msgId)
+		}
+	}
+
+	// 客户端 -> 后端 -> 客户端, 后端默认回显
+	if err := ws.Send(100, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	req, err := gate.Backend.WaitMsg(100, gatetest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(req.Data) != "hello" || req.TraceId == 0 {
+		t.Fatalf("unexpected backend request: %+v", req)
+	}
+	expect(100, "hello")
+
+	// 后端绑定用户和广播
+	if err = gate.Backend.BindUser(req.SessionId, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if !gate.Eventually(func() bool { return gate.Session(req.SessionId).GetUserId() == "user-1" }) {
+		t.Fatal("user not bound")
+	}
+	if err = gate.Backend.Broadcast(200, []byte("notice")); err != nil {
+		t.Fatal(err)
+	}
+	expect(200, "notice")
+	expect(200, "notice")
+	gate.Service.Broadcast(codec.NewMessage(201, req.SessionId, []byte("admin")))
+	expect(201, "admin")
+	expect(201, "admin")
+
+	// 后端踢下线
+	closed := closedState(ws)
+	if err = gate.Backend.Kick(req.SessionId, "test"); err != nil {
+		t.Fatal(err)
+	}
+	expectDisconnect(t, closed, codec.CloseKicked, "test")
+	gate.WaitSessions(1)
+
+	// 网关保留的消息不转发, 心跳由网关直接返回
+	gate.Backend.Reset()
+	reply, err := tcp.Request(codec.MsgIdBindUser, []byte("spoof"), 300, 200*time.Millisecond)
+	if err == nil {
+		t.Fatalf("reserved msgId forwarded, reply %v", reply)
+	}
+	if n := len(gate.Backend.Received()); n != 0 {
+		t.Fatalf("backend received %d messages, want 0", n)
+	}
+	if tcp.RTT() <= 0 {
+		t.Fatal("no heartbeat reply from gate")
+	}
+}
+
+func TestBridgeServiceMaxSession(t *testing.T) {
+	gate := gatetest.Start(t)
+	gate.Service.SetMaxSession(1)
+	gate.Service.SetOverflow(3*time.Second, false)
+	first := gate.Dial(client.Config{})
+	gate.WaitSessions(1)
+
+	// websocket在握手前返回503和Retry-After
+	var overflow *client.OverflowError
+	err := client.New(client.Config{Addr: gate.URL()}).Connect()
+	if !errors.As(err, &overflow) || overflow.RetryAfter != 3*time.Second {
+		t.Fatalf("connect when full: %v", err)
+	}
+
+	// tcp连接收到溢出消息后被关闭
+	c := client.New(client.Config{Addr: gate.TCPURL()})
+	closed := closedState(c)
+	if err = c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-closed:
+		if !errors.Is(err, client.ErrOverflow) {
+			t.Fatalf("closed with %v, want overflow", err)
+		}
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("client not closed")
+	}
+
+	// 开启后websocket完成握手, 收到溢出消息后被关闭
+	gate.Service.SetOverflow(3*time.Second, true)
+	c = client.New(client.Config{Addr: gate.URL()})
+	closed = closedState(c)
+	if err = c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-closed; !errors.As(err, &overflow) || overflow.RetryAfter != 3*time.Second {
+		t.Fatalf("closed with %v, want overflow", err)
+	}
+	gate.WaitSessions(1)
+
+	// 会话关闭后归还名额
+	_ = first.Close()
+	gate.WaitSessions(0)
+	gate.Dial(client.Config{Addr: gate.TCPURL()})
+	gate.WaitSessions(1)
+}
+
+func TestBridgeServiceStop(t *testing.T) {
+	gate := gatetest.Start(t)
+	ws := gate.Dial(client.Config{})
+	tcp := gate.Dial(client.Config{Addr: gate.TCPURL()})
+	gate.WaitSessions(2)
+	wsClosed, tcpClosed := closedState(ws), closedState(tcp)
+
+	gate.Stop()
+	expectDisconnect(t, wsClosed, codec.CloseShutdown, "service stop")
+	expectDisconnect(t, tcpClosed, codec.CloseShutdown, "service stop")
+	if n := gate.Sessions(); n != 0 {
+		t.Fatalf("%d sessions after stop, want 0", n)
+	}
+	for _, addr := range []string{gate.URL(), gate.TCPURL()} {
+		if err := client.New(client.Config{Addr: addr, DialTimeout: time.Second}).Connect(); err == nil {
+			t.Fatalf("connected to %s after stop", addr)
+		}
+	}
+	if err := gate.Service.Listen("127.0.0.1:0"); err == nil {
+		t.Fatal("listen after stop succeeded")
+	}
+}
+
+func TestBridgeServiceLoginQueue(t *testing.T) {
+	gate := gatetest.Start(t)
+	gate.Service.SetMaxSession(1)
+	gate.Service.SetLoginQueue(true, 0, 20*time.Millisecond, []string{"vip"})
+	first := gate.Dial(client.Config{})
+	gate.WaitSessions(1)
+
+	// 排队期间定时收到排名, 晋升后网关才读取排队时发送的消息
+	queued := func(addr string, msgId uint16) (*client.Client, chan int) {
+		positions := make(chan int, 64)
+		c := gate.Dial(client.Config{Addr: addr})
+		c.Handle(codec.MsgIdQueue, func(msg iface.IMessage) {
+			position, _ := client.QueuePosition(msg)
+			select {
+			case positions <- position:
+			default:
+			}
+		})
+		if err := c.Send(msgId, nil); err != nil {
+			t.Fatal(err)
+		}
+		return c, positions
+	}
+	expectPosition := func(positions chan int, want int) {
+		t.Helper()
+		deadline := time.After(gatetest.DefaultTimeout)
+		for {
+			select {
+			case position := <-positions:
+				if position == want {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("queue position %d not received", want)
+			}
+		}
+	}
+	normal, normalPositions := queued(gate.URL(), 1)
+	expectPosition(normalPositions, 1)
+	_, tcpPositions := queued(gate.TCPURL(), 2)
+	expectPosition(tcpPositions, 2)
+	vip, vipPositions := queued(gate.URL()+"?queue_token=vip", 3)
+	expectPosition(vipPositions, 1)
+	expectPosition(tcpPositions, 3)
+	queue := gate.Service.GetLoginQueue()
+	if lanes := queue.Lanes(); lanes["vip"] != 1 || lanes["normal"] != 2 {
+		t.Fatalf("queue lanes %v", lanes)
+	}
+
+	// 名额空出后VIP优先, 通道内先进先出
+	gate.Backend.Reset()
+	for _, next := range []struct {
+		prev  *client.Client
+		msgId uint16
+	}{{first, 3}, {vip, 1}, {normal, 2}} {
+		_ = next.prev.Close()
+		if _, err := gate.Backend.WaitMsg(next.msgId, gatetest.DefaultTimeout); err != nil {
+			t.Fatalf("msgId %d: %v", next.msgId, err)
+		}
+		if n := len(gate.Backend.Received()); n != 1 {
+			t.Fatalf("backend received %d messages after promotion, want 1", n)
+		}
+		gate.Backend.Reset()
+	}
+	gate.WaitSessions(1)
+
+	// 清空后排队的连接收到会话已满
+	c, _ := queued(gate.URL(), 4)
+	closed := closedState(c)
+	if !gate.Eventually(func() bool { return queue.Len() == 1 }) {
+		t.Fatal("client not queued")
+	}
+	if n := queue.Flush(); n != 1 {
+		t.Fatalf("flushed %d, want 1", n)
+	}
+	if err := <-closed; !errors.Is(err, client.ErrOverflow) {
+		t.Fatalf("closed with %v, want overflow", err)
+	}
+
+	// 排空期间不再接收新的排队连接
+	queue.Drain(true)
+	if err := client.New(client.Config{Addr: gate.URL()}).Connect(); !errors.Is(err, client.ErrOverflow) {
+		t.Fatalf("connect while draining: %v", err)
+	}
+}
+
+func TestBridgeServiceLoginQueueLeave(t *testing.T) {
+	gate := gatetest.Start(t)
+	gate.Service.SetMaxSession(1)
+	// 排名通知间隔远大于等待时间, 断开只能由排队期间的读取发现
+	gate.Service.SetLoginQueue(true, 0, time.Hour, nil)
+	gate.Dial(client.Config{})
+	gate.WaitSessions(1)
+
+	queue := gate.Service.GetLoginQueue()
+	for _, addr := range []string{gate.URL(), gate.TCPURL()} {
+		c := gate.Dial(client.Config{Addr: addr})
+		if !gate.Eventually(func() bool { return queue.Len() == 1 }) {
+			t.Fatalf("%s: client not queued", addr)
+		}
+		_ = c.Close()
+		if !gate.Eventually(func() bool { return queue.Len() == 0 }) {
+			t.Fatalf("%s: disconnected client still queued", addr)
+		}
+	}
+}
+
+func TestBridgeServiceDisconnect(t *testing.T) {
+	gate := gatetest.Start(t)
+	for _, addr := range []string{gate.URL(), gate.TCPURL()} {
+		c := gate.Dial(client.Config{Addr: addr})
+		closed := closedState(c)
+		gate.Backend.Reset()
+		if err := c.Send(100, nil); err != nil {
+			t.Fatal(err)
+		}
+		req, err := gate.Backend.WaitMsg(100, gatetest.DefaultTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 后端登录验证失败后按关闭码关闭
+		if err = gate.Backend.CloseSession(req.SessionId, codec.CloseAuthFailed, "bad token"); err != nil {
+			t.Fatal(err)
+		}
+		expectDisconnect(t, closed, codec.CloseAuthFailed, "bad token")
+		gate.WaitSessions(0)
+	}
+}
+
+func TestBridgeServiceMessageMetrics(t *testing.T) {
+	gate := gatetest.Start(t)
+	c := gate.Dial(client.Config{})
+	game := metrics.ServiceIn.With(gatenet.DefaultBackendService).Get()
+	gameBytes := metrics.ServiceBytesIn.With(gatenet.DefaultBackendService).Get()
+	reserved := metrics.ServiceIn.With(metrics.ServiceReserved).Get()
+	msgIn := metrics.MessagesIn.With("4321").Get()
+	msgBytes := metrics.BytesIn.With("4321").Get()
+	other := metrics.MessagesIn.With(metrics.MsgIdOther).Get()
+
+	// 客户端消息按转发的服务和消息ID统计, 保留的消息ID被丢弃, 归入reserved服务和other消息ID
+	if err := c.Send(codec.MsgIdBindUser, []byte("spoof")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Send(4321, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gate.Backend.WaitMsg(4321, gatetest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+	for name, n := range map[string]uint64{
+		"game messages":     metrics.ServiceIn.With(gatenet.DefaultBackendService).Get() - game,
+		"game bytes":        metrics.ServiceBytesIn.With(gatenet.DefaultBackendService).Get() - gameBytes,
+		"reserved messages": metrics.ServiceIn.With(metrics.ServiceReserved).Get() - reserved,
+		"4321 messages":     metrics.MessagesIn.With("4321").Get() - msgIn,
+		"4321 bytes":        metrics.BytesIn.With("4321").Get() - msgBytes,
+		"other messages":    metrics.MessagesIn.With(metrics.MsgIdOther).Get() - other,
+	} {
+		want := uint64(1)
+		if strings.HasSuffix(name, "bytes") {
+			want = 5
+		}
+		if n != want {
+			t.Errorf("%s +%d, want +%d", name, n, want)
+		}
+	}
+	var buf bytes.Buffer
+	if err := metrics.Default.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `gate_messages_in_total{msgid="4321"}`) || strings.Contains(buf.String(), metrics.MsgId(codec.MsgIdBindUser)) {
+		t.Fatalf("unexpected msgId labels:\n%s", buf.String())
+	}
+}
+
+func TestBridgeServiceSlowClient(t *testing.T) {
+	gate := gatetest.Start(t)
+	stalled := dialStalled(t, gate)
+	received := make(chan iface.IMessage, 1)
+	c := gate.Dial(client.Config{})
+	c.Handle(200, func(msg iface.IMessage) {
+		received <- msg
+	})
+	if err := c.Send(101, nil); err != nil {
+		t.Fatal(err)
+	}
+	req, err := gate.Backend.WaitMsg(101, gatetest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 写满慢会话的写队列后关闭该会话, 后端读协程和其他会话不受影响
+	data := make([]byte, 32<<10)
+	for i := 0; i < 2*gatenet.SessionWriteQueue; i++ {
+		if err = gate.Backend.Send(stalled, 100, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = gate.Backend.Send(req.SessionId, 200, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("backend reader blocked by a slow session")
+	}
+	gate.WaitSessions(1)
+}
+
+func TestBridgeServiceBroadcastSlowClient(t *testing.T) {
+	gate := gatetest.Start(t)
+	dialStalled(t, gate)
+	var count atomic.Int32
+	done := make(chan struct{}, 1)
+	c := gate.Dial(client.Config{})
+	c.Handle(200, func(msg iface.IMessage) {
+		count.Add(1)
+	})
+	c.Handle(201, func(msg iface.IMessage) {
+		done <- struct{}{}
+	})
+	gate.WaitSessions(2)
+
+	// 广播写满慢会话的写队列, 慢会话被关闭, 其他会话照常收到全部广播
+	// 分批发送并等待正常客户端读完, 避免正常客户端的写队列也被写满
+	data := make([]byte, 32<<10)
+	batch := gatenet.SessionWriteQueue / 4
+	total := 2 * gatenet.SessionWriteQueue
+	for sent := batch; sent <= total; sent += batch {
+		for i := 0; i < batch; i++ {
+			if err := gate.Backend.Broadcast(200, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := int32(sent)
+		if !gate.Eventually(func() bool { return count.Load() == want }) {
+			t.Fatalf("client received %d broadcasts, want %d", count.Load(), want)
+		}
+	}
+	gate.WaitSessions(1)
+	gate.Service.Broadcast(codec.NewMessage(201, 0, nil))
+	select {
+	case <-done:
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("broadcast blocked by a slow session")
+	}
+}
+
+// dialStalled 建立一个从不读取的tcp会话, 返回会话ID
+func dialStalled(t *testing.T, gate *gatetest.Gate) uint32 {
+	t.Helper()
+	conn, err := net.Dial("tcp", gate.Service.TCPAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	gate.Backend.Reset()
+	if _, err = conn.Write(codec.NewStream().Marshal(codec.NewMessage(100, 0, nil))); err != nil {
+		t.Fatal(err)
+	}
+	req, err := gate.Backend.WaitMsg(100, gatetest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req.SessionId
+}
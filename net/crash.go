@@ -0,0 +1,71 @@
+package net
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// crashStackSize 崩溃转储中全部协程堆栈的最大字节数
+const crashStackSize = 16 << 20
+
+// CrashDump
+// @Description: 崩溃转储设置, 由网关服务持有, 所有会话共享, 目录为空时不写转储文件
+type CrashDump struct {
+	dir atomic.Pointer[string] // 转储目录
+}
+
+// SetDir
+//
+//	@Description: 设置转储目录, 为空时关闭
+//	@receiver c
+//	@param dir 目录
+func (c *CrashDump) SetDir(dir string) {
+	c.dir.Store(&dir)
+}
+
+func (c *CrashDump) Dir() string {
+	if dir := c.dir.Load(); dir != nil {
+		return *dir
+	}
+	return ""
+}
+
+// Write
+//
+//	@Description: 写入转储文件: 会话信息、panic值、全部协程堆栈和出错消息的原始字节
+//	@receiver c
+//	@param sessionId 会话ID
+//	@param traceId 追踪ID
+//	@param where 出错的协程(reader/writer)
+//	@param value panic值
+//	@param data 出错时正在处理的消息, 可以为空
+//	@return string 文件路径, 未开启时为空
+//	@return error
+func (c *CrashDump) Write(sessionId uint32, traceId string, where string, value interface{}, data []byte) (string, error) {
+	dir := c.Dir()
+	if dir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("crash-%s-%d-%s.txt", now.Format("20060102-150405.000000"), sessionId, where))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stack := make([]byte, crashStackSize)
+	stack = stack[:runtime.Stack(stack, true)]
+	_, _ = fmt.Fprintf(file, "time: %s\nsession: %d\ntrace: %s\ngoroutine: %s\npanic: %v\n\n", now.Format(time.RFC3339Nano), sessionId, traceId, where, value)
+	_, _ = fmt.Fprintf(file, "message (%d bytes):\n%s\n", len(data), hex.Dump(data))
+	_, _ = fmt.Fprintf(file, "goroutines:\n%s\n", stack)
+	return path, file.Sync()
+}
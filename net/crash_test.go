@@ -0,0 +1,330 @@
+package net_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/discovery"
+	"github.com/liaoyudong2/GateServer/fakebackend"
+	"github.com/liaoyudong2/GateServer/gatetest"
+	"github.com/liaoyudong2/GateServer/metrics"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// panicMsgId 触发panic的消息ID
+const panicMsgId = 666
+
+// closeEvent 连接关闭时通知的关闭码和原因
+type closeEvent struct {
+	code   uint16
+	reason string
+}
+
+// fakeConn 内存中的客户端连接, 写入带panic标记的数据时panic
+type fakeConn struct {
+	reads     chan []byte
+	closed    chan closeEvent
+	writes    chan []byte
+	closeOnce sync.Once
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{reads: make(chan []byte, 4), closed: make(chan closeEvent, 2), writes: make(chan []byte, 4)}
+}
+
+func (c *fakeConn) ReadData() ([]byte, error) {
+	data, ok := <-c.reads
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return data, nil
+}
+
+func (c *fakeConn) WriteData(data []byte) error {
+	if bytes.Contains(data, []byte("panic")) {
+		panic("write boom")
+	}
+	c.writes <- data
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	return c.CloseWith(0, "")
+}
+
+func (c *fakeConn) CloseWith(code uint16, reason string) error {
+	c.closeOnce.Do(func() {
+		c.closed <- closeEvent{code: code, reason: reason}
+		close(c.reads)
+	})
+	return nil
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+}
+
+// panicBackendMgr 路由panicMsgId时panic, 其余消息转发失败(引用仍由会话持有)
+type panicBackendMgr struct {
+	iface.IBackendMgr
+}
+
+func (m panicBackendMgr) Route(msgId uint16) string {
+	if msgId == panicMsgId {
+		panic("route boom")
+	}
+	return gatenet.DefaultBackendService
+}
+
+func (m panicBackendMgr) Pick(service string, sessionId uint32) (iface.IBackend, error) {
+	return nil, errors.New("no backend")
+}
+
+// expectClose 等待连接以指定关闭码和原因关闭
+func expectClose(t *testing.T, conn *fakeConn, code uint16, reason string) {
+	t.Helper()
+	select {
+	case ev := <-conn.closed:
+		if ev.code != code || ev.reason != reason {
+			t.Fatalf("closed with %d %q, want %d %q", ev.code, ev.reason, code, reason)
+		}
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("session not closed")
+	}
+}
+
+// crashDumps 目录下的崩溃转储内容
+func crashDumps(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "crash-*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dumps []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dumps = append(dumps, string(data))
+	}
+	return dumps
+}
+
+func TestSessionPanic(t *testing.T) {
+	capture, stop := zlog.StartCapture()
+	defer stop()
+	dir := t.TempDir()
+	options := &gatenet.SessionOptions{}
+	options.CrashDump.SetDir(dir)
+	mgr := gatenet.NewSessionMgr(0)
+	readerPanics := metrics.SessionPanics.With("reader").Get()
+	writerPanics := metrics.SessionPanics.With("writer").Get()
+
+	healthy := newFakeConn()
+	mgr.AddSession(gatenet.NewSession(1, healthy, mgr, panicBackendMgr{}, options))
+
+	// 读协程panic: 只关闭出错的会话, 通知内部错误, 记录堆栈、指标和转储
+	conn := newFakeConn()
+	session := gatenet.NewSession(2, conn, mgr, panicBackendMgr{}, options)
+	mgr.AddSession(session)
+	frame := codec.NewStream().Marshal(codec.NewMessage(panicMsgId, 0, []byte("bad input")))
+	conn.reads <- frame
+	expectClose(t, conn, codec.CloseInternalError, "panic")
+	for deadline := time.Now().Add(gatetest.DefaultTimeout); mgr.GetSession(2) != nil; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("panicked session not removed")
+		}
+	}
+	if got := metrics.SessionPanics.With("reader").Get(); got != readerPanics+1 {
+		t.Fatalf("reader panics %d, want %d", got, readerPanics+1)
+	}
+	if entry := capture.Find(zlog.LogError, "session reader panic: route boom"); entry == nil || !strings.Contains(entry.Message, "goroutine ") {
+		t.Fatalf("no panic stack in log: %q", capture.Messages())
+	}
+	dumps := crashDumps(t, dir)
+	if len(dumps) != 1 {
+		t.Fatalf("%d crash dumps, want 1", len(dumps))
+	}
+	for _, want := range []string{"session: 2\n", "trace: " + session.GetTraceId(), "goroutine: reader", "panic: route boom",
+		fmt.Sprintf("message (%d bytes):", len(frame)), hex.Dump(frame), "goroutines:\n"} {
+		if !strings.Contains(dumps[0], want) {
+			t.Fatalf("crash dump missing %q:\n%s", want, dumps[0])
+		}
+	}
+
+	// 其他会话不受影响
+	healthy.reads <- codec.NewStream().Marshal(codec.NewMessage(100, 0, nil))
+	mgr.GetSession(1).SendMessage(codec.NewMessage(200, 0, []byte("ok")))
+	select {
+	case data := <-healthy.writes:
+		if !bytes.HasSuffix(data, []byte("ok")) {
+			t.Fatalf("healthy session wrote %q", data)
+		}
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("healthy session stopped writing")
+	}
+
+	// 写协程panic同样只关闭当前会话
+	mgr.GetSession(1).SendMessage(codec.NewMessage(200, 0, []byte("panic")))
+	expectClose(t, healthy, codec.CloseInternalError, "panic")
+	if got := metrics.SessionPanics.With("writer").Get(); got != writerPanics+1 {
+		t.Fatalf("writer panics %d, want %d", got, writerPanics+1)
+	}
+	if dumps = crashDumps(t, dir); len(dumps) != 2 {
+		t.Fatalf("%d crash dumps, want 2", len(dumps))
+	}
+}
+
+func TestCrashDump(t *testing.T) {
+	var dump gatenet.CrashDump
+	if path, err := dump.Write(1, "trace", "reader", "boom", nil); path != "" || err != nil {
+		t.Fatalf("disabled dump wrote %q, %v", path, err)
+	}
+
+	// 目录不存在时自动创建, 同一会话多次转储不覆盖
+	dir := filepath.Join(t.TempDir(), "crash")
+	dump.SetDir(dir)
+	first, err := dump.Write(3, "0000000000000abc", "writer", errors.New("boom"), []byte{0x01, 0x02})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := dump.Write(3, "0000000000000abc", "writer", "again", nil)
+	if err != nil || first == second || filepath.Dir(first) != dir {
+		t.Fatalf("dumps %q %q, %v", first, second, err)
+	}
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "panic: boom\n") || !strings.Contains(string(data), "message (2 bytes):\n00000000  01 02") {
+		t.Fatalf("unexpected dump:\n%s", data)
+	}
+
+	dump.SetDir("")
+	if path, _ := dump.Write(3, "", "reader", "boom", nil); path != "" {
+		t.Fatalf("dump written after disabled: %q", path)
+	}
+}
+
+// panicSession 后端发来的消息交给faulty会话时panic, 记录收到的消息和关闭码
+type panicSession struct {
+	iface.ISession
+	id       uint32
+	faulty   bool
+	received chan string
+	closed   chan closeEvent
+}
+
+func newPanicSession(id uint32, faulty bool) *panicSession {
+	return &panicSession{id: id, faulty: faulty, received: make(chan string, 4), closed: make(chan closeEvent, 4)}
+}
+
+func (s *panicSession) GetSessionId() uint32 {
+	return s.id
+}
+
+func (s *panicSession) SendMessage(msg iface.IMessage) {
+	data := string(msg.GetMsgData())
+	codec.Release(msg)
+	if s.faulty {
+		panic("send boom")
+	}
+	s.received <- data
+}
+
+func (s *panicSession) Kick(reason string) {
+	panic("kick boom")
+}
+
+func (s *panicSession) Disconnect(code uint16, reason string) {
+	s.closed <- closeEvent{code: code, reason: reason}
+}
+
+// expectSessionClose 等待会话以指定关闭码和原因关闭
+func expectSessionClose(t *testing.T, session *panicSession, code uint16, reason string) {
+	t.Helper()
+	select {
+	case ev := <-session.closed:
+		if ev.code != code || ev.reason != reason {
+			t.Fatalf("closed with %d %q, want %d %q", ev.code, ev.reason, code, reason)
+		}
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("session not closed")
+	}
+}
+
+// expectReceived 等待会话收到消息
+func expectReceived(t *testing.T, session *panicSession, want string) {
+	t.Helper()
+	select {
+	case data := <-session.received:
+		if data != want {
+			t.Fatalf("received %q, want %q", data, want)
+		}
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("backend reader stopped delivering")
+	}
+}
+
+func TestBackendPanic(t *testing.T) {
+	capture, stop := zlog.StartCapture()
+	defer stop()
+	server := fakebackend.New()
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	mgr := gatenet.NewSessionMgr(0)
+	faulty, healthy := newPanicSession(1, true), newPanicSession(2, false)
+	mgr.AddSession(faulty)
+	mgr.AddSession(healthy)
+	backend := gatenet.NewBackend(gatenet.DefaultBackendService, discovery.Instance{Id: "game-1", Address: server.Addr(), Weight: 1}, mgr)
+	defer backend.Close()
+	if err := server.WaitConn(1, gatetest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+	panics := metrics.SessionPanics.With("backend").Get()
+
+	// 处理单个会话的消息时panic只关闭该会话, 后端读协程继续处理其他会话的消息
+	if err := server.Send(1, 100, []byte("boom")); err != nil {
+		t.Fatal(err)
+	}
+	expectSessionClose(t, faulty, codec.CloseInternalError, "panic")
+	if err := server.Kick(1, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	expectSessionClose(t, faulty, codec.CloseInternalError, "panic")
+	if err := server.Send(2, 100, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	expectReceived(t, healthy, "after")
+
+	// 广播时单个会话panic, 其他会话照常收到
+	if err := server.Broadcast(200, []byte("notice")); err != nil {
+		t.Fatal(err)
+	}
+	expectSessionClose(t, faulty, codec.CloseInternalError, "panic")
+	expectReceived(t, healthy, "notice")
+
+	if got := metrics.SessionPanics.With("backend").Get(); got != panics+3 {
+		t.Fatalf("backend panics %d, want %d", got, panics+3)
+	}
+	if entry := capture.Find(zlog.LogError, "backend [game:game-1] panic on session 1: kick boom"); entry == nil || !strings.Contains(entry.Message, "goroutine ") {
+		t.Fatalf("no panic stack in log: %q", capture.Messages())
+	}
+	if !backend.IsConnected() || len(server.Conns()) != 1 {
+		t.Fatal("backend connection dropped")
+	}
+}
@@ -0,0 +1,32 @@
+package iface
+
+// IBackend
+// @Description: 后端服务连接
+type IBackend interface {
+	GetId() string             // 实例ID
+	GetAddress() string        // 连接地址
+	GetWeight() int            // 权重
+	IsConnected() bool         // 是否已连接
+	GetConnId() uint64         // 连接序号, 每次连接成功后递增
+	Forward(msg IMessage) bool // 转发消息, 队列已满或未连接时返回false
+	Close()                    // 关闭
+}
+
+// IBackendPool
+// @Description: 同一服务的后端连接池
+type IBackendPool interface {
+	GetService() string             // 服务名
+	GetBackendCount() int           // 后端数量
+	GetBackends() []IBackend        // 全部后端
+	Pick(sessionId uint32) IBackend // 为会话选择后端
+}
+
+// IBackendMgr
+// @Description: 后端连接池管理
+type IBackendMgr interface {
+	GetPool(service string) IBackendPool                          // 获取服务连接池
+	Route(msgId uint16) string                                    // 消息ID对应的服务名
+	Pick(service string, sessionId uint32) (IBackend, error)      // 为会话选择服务的后端
+	Forward(service string, sessionId uint32, msg IMessage) error // 转发会话消息
+	Close()                                                       // 关闭全部后端
+}
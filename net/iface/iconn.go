@@ -0,0 +1,13 @@
+package iface
+
+import "net"
+
+// IConn
+// @Description: 客户端连接, websocket按二进制消息收发, tcp按字节流收发, 数据均为10字节头部的消息帧
+type IConn interface {
+	ReadData() ([]byte, error)                  // 读取数据, 返回值在下次读取前有效
+	WriteData(data []byte) error                // 写入数据, 不支持并发调用
+	Close() error                               // 关闭
+	CloseWith(code uint16, reason string) error // 通知关闭码和原因后关闭, 可以与WriteData并发调用
+	RemoteAddr() net.Addr                       // 客户端地址
+}
@@ -0,0 +1,13 @@
+package iface
+
+// ILoginQueue
+// @Description: 登录排队接口
+type ILoginQueue interface {
+	IsOpen() bool          // 是否开启排队
+	Len() int              // 排队总数
+	Lanes() map[string]int // 各通道的排队数
+	Rate() float64         // 每秒晋升数
+	Drain(enabled bool)    // 开始或停止排空, 排空期间不接收新的排队连接
+	IsDraining() bool      // 是否正在排空
+	Flush() int            // 清空排队, 返回清空的连接数
+}
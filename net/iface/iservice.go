@@ -6,7 +6,14 @@ type IService interface {
 	StartService(port int)                               // 启动服务
 	StopService()                                        // 停止服务
 	SetMaxSession(num int)                               // 设置最大连接数量
+	GetMaxSession() int                                  // 获取最大连接数量
 	GetSessionMgr() ISessionMgr                          // 获取连接管理对象
+	GetBackendMgr() IBackendMgr                          // 获取后端连接管理对象
 	SendMessageToSession(sessionId uint32, msg IMessage) // 发送消息
 	RawBufferToSession(sessionId uint32, buf []byte)     // 发送原始数据给客户端
+	Broadcast(msg IMessage)                              // 发送消息给全部会话
+	RecordSession(sessionId uint32, enabled bool) error  // 开始或停止录制会话
+	RecordUser(userId string, enabled bool)              // 开始或停止录制用户
+	RecordTargets() ([]uint32, []string)                 // 需要录制的会话和用户
+	GetLoginQueue() ILoginQueue                          // 获取登录排队
 }
@@ -1,8 +1,21 @@
 package iface
 
+import "time"
+
 type ISession interface {
-	GetSessionId() uint32     // 获取会话id
-	Close()                   // 关闭
-	SendMessage(msg IMessage) // 发送信息
-	RawBuffer(buf []byte)     // 发送原始数据
+	GetSessionId() uint32                  // 获取会话id
+	GetRemoteAddr() string                 // 获取客户端地址
+	GetUserId() string                     // 获取绑定的用户id
+	SetUserId(userId string)               // 绑定用户id
+	GetCreatedAt() time.Time               // 获取创建时间
+	GetBytesIn() uint64                    // 已接收字节数
+	GetBytesOut() uint64                   // 已发送字节数
+	GetTraceId() string                    // 获取追踪id
+	Close()                                // 关闭
+	Kick(reason string)                    // 踢下线
+	Disconnect(code uint16, reason string) // 通知关闭码和原因后关闭
+	SendMessage(msg IMessage)              // 发送信息, 消息是codec.Frame时转移一个引用
+	RawBuffer(buf []byte)                  // 发送原始数据
+	Record(enabled bool) error             // 开始或停止录制流量
+	IsRecording() bool                     // 是否正在录制
 }
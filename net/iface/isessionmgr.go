@@ -5,5 +5,7 @@ type ISessionMgr interface {
 	AddSession(session ISession)          // 添加会话
 	RemoveSession(sessionId uint32)       // 移除会话
 	GetSession(sessionId uint32) ISession // 获取会话
+	GetSessions() []ISession              // 获取全部会话(快照)
+	Range(f func(session ISession) bool)  // 遍历全部会话, f返回false时停止, f中可以关闭会话
 	CleanSession()                        // 移除所有会话
 }
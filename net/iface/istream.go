@@ -4,6 +4,7 @@ type IMessage interface {
 	GetMsgId() uint16   // 获取消息ID
 	GetMsgLen() int     // 获取消息长度
 	GetMsgData() []byte // 获取消息内容
+	GetReserve() uint32 // 获取保留字段(SessionID)
 }
 
 type IStream interface {
@@ -0,0 +1,10 @@
+package net
+
+import "github.com/liaoyudong2/GateServer/zlog"
+
+// 模块日志, 级别可单独调整
+var (
+	netLog     = zlog.Module("net")     // 服务/后端
+	sessionLog = zlog.Module("session") // 会话
+	codecLog   = zlog.Module("codec")   // 编解码
+)
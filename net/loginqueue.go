@@ -0,0 +1,599 @@
+package net
+
+import (
+	"encoding/binary"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/metrics"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 排队通道, 数字越小优先级越高
+const (
+	LaneVip    = 0 // 持有VIP令牌的连接
+	LaneNormal = 1 // 其他连接
+	QueueLanes = 2 // 通道数
+)
+
+// LaneNames 通道名称, 用于指标和管理接口
+var LaneNames = [QueueLanes]string{"vip", "normal"}
+
+const (
+	DefaultQueueInterval = time.Second            // 默认排名通知间隔
+	QueuePromoteInterval = 50 * time.Millisecond  // 检查空闲名额的间隔
+	queueWriteTimeout    = time.Second            // 单个排队连接的写超时, 避免慢连接阻塞队列
+	queueReadBuffer      = 16                     // 排队连接缓存的读取次数, 排队期间写满视为客户端异常
+	queueRateWeight      = 0.3                    // 晋升速度的平滑系数
+	queueRateWindow      = 500 * time.Millisecond // 晋升速度的最小统计时长
+)
+
+// waiter
+// @Description: 排队中的连接, 排队期间由后台协程读取, 读取出错或通知写入失败时视为已断开
+type waiter struct {
+	lock   sync.Mutex  // 写入和离开排队互斥, 晋升后不再由排队写入
+	conn   iface.IConn // 客户端连接
+	lane   int         // 排队通道
+	joined time.Time   // 入队时间
+	done   bool        // 是否已晋升或离开
+}
+
+// send
+//
+//	@Description: 带超时写入, 已晋升或离开时忽略
+//	@receiver w
+//	@param frame 消息帧
+//	@return bool 是否成功
+func (w *waiter) send(frame []byte) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.done {
+		return true
+	}
+	setWriteDeadline(w.conn, time.Now().Add(queueWriteTimeout))
+	return w.conn.WriteData(frame) == nil
+}
+
+// waiting
+//
+//	@Description: 是否仍在排队
+//	@receiver w
+//	@return bool
+func (w *waiter) waiting() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return !w.done
+}
+
+// finish
+//
+//	@Description: 结束排队, 等待进行中的写入完成
+//	@receiver w
+//	@return bool 是否由本次调用结束
+func (w *waiter) finish() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.done {
+		return false
+	}
+	w.done = true
+	setWriteDeadline(w.conn, time.Time{})
+	return true
+}
+
+// readResult 一次读取的结果
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// queuedConn
+// @Description: 排队连接的读取包装, 由后台协程持续读取以便排队期间及时发现断开,
+// 晋升后会话通过ReadData按顺序取出读到的数据
+type queuedConn struct {
+	iface.IConn
+	reads     chan readResult // 读取结果, 后台协程退出时关闭
+	closed    chan bool       // 连接关闭信号
+	closeOnce sync.Once       // 保证只关闭一次信号
+}
+
+func newQueuedConn(conn iface.IConn) *queuedConn {
+	return &queuedConn{
+		IConn:  conn,
+		reads:  make(chan readResult, queueReadBuffer),
+		closed: make(chan bool),
+	}
+}
+
+func (c *queuedConn) ReadData() ([]byte, error) {
+	select {
+	case result, ok := <-c.reads:
+		if !ok {
+			return nil, net.ErrClosed
+		}
+		return result.data, result.err
+	case <-c.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (c *queuedConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.IConn.Close()
+}
+
+func (c *queuedConn) CloseWith(code uint16, reason string) error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.IConn.CloseWith(code, reason)
+}
+
+func (c *queuedConn) SetWriteDeadline(t time.Time) error {
+	setWriteDeadline(c.IConn, t)
+	return nil
+}
+
+// LoginQueue
+// @Description: 登录排队, 会话已满时新连接进入等待状态并定时收到排名和预计等待时间,
+// 名额空出后按通道优先级、通道内先进先出晋升为会话
+type LoginQueue struct {
+	lock      sync.Mutex                      // 加锁
+	lanes     [QueueLanes][]*waiter           // 各通道的排队连接
+	slots     *SessionSlots                   // 会话名额
+	admit     func(conn iface.IConn)          // 晋升为会话, 调用前已占用名额
+	open      atomic.Bool                     // 是否开启排队
+	draining  atomic.Bool                     // 是否停止接收新的排队连接
+	maxLen    atomic.Int64                    // 最大排队数, 0为不限制
+	interval  atomic.Int64                    // 排名通知间隔
+	vipTokens atomic.Pointer[map[string]bool] // VIP令牌
+	promoted  int                             // 上次统计后晋升的数量
+	rate      float64                         // 平滑后的每秒晋升数
+	sampledAt time.Time                       // 上次统计晋升速度的时间
+	running   bool                            // 协程是否已启动
+	stopped   bool                            // 是否已停止
+	exitChan  chan bool                       // 退出信号
+}
+
+// NewLoginQueue
+//
+//	@Description: 创建登录排队, 默认关闭
+//	@param slots 会话名额
+//	@param admit 晋升为会话, 调用前已占用名额
+//	@return *LoginQueue
+func NewLoginQueue(slots *SessionSlots, admit func(conn iface.IConn)) *LoginQueue {
+	q := &LoginQueue{
+		slots:     slots,
+		admit:     admit,
+		sampledAt: time.Now(),
+		exitChan:  make(chan bool),
+	}
+	q.interval.Store(int64(DefaultQueueInterval))
+	return q
+}
+
+// Set
+//
+//	@Description: 修改排队设置, 第一次开启时启动处理协程. 关闭后已排队的连接继续晋升, 不再接收新的连接
+//	@receiver q
+//	@param open 是否开启
+//	@param maxLen 最大排队数, 0为不限制
+//	@param interval 排名通知间隔, 不大于0时使用DefaultQueueInterval
+//	@param vipTokens VIP令牌, 连接时携带其中之一进入VIP通道
+func (q *LoginQueue) Set(open bool, maxLen int, interval time.Duration, vipTokens []string) {
+	if interval <= 0 {
+		interval = DefaultQueueInterval
+	}
+	tokens := make(map[string]bool, len(vipTokens))
+	for _, token := range vipTokens {
+		if token != "" {
+			tokens[token] = true
+		}
+	}
+	q.maxLen.Store(int64(maxLen))
+	q.interval.Store(int64(interval))
+	q.vipTokens.Store(&tokens)
+	q.open.Store(open)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if open && !q.running && !q.stopped {
+		q.running = true
+		go q.run()
+	}
+}
+
+func (q *LoginQueue) IsOpen() bool {
+	return q.open.Load()
+}
+
+// Lane
+//
+//	@Description: 按连接携带的令牌选择通道
+//	@receiver q
+//	@param token 排队令牌
+//	@return int
+func (q *LoginQueue) Lane(token string) int {
+	if tokens := q.vipTokens.Load(); token != "" && tokens != nil && (*tokens)[token] {
+		return LaneVip
+	}
+	return LaneNormal
+}
+
+// Accepting
+//
+//	@Description: 是否接收新的排队连接
+//	@receiver q
+//	@return bool
+func (q *LoginQueue) Accepting() bool {
+	return q.open.Load() && !q.draining.Load()
+}
+
+// Waiting
+//
+//	@Description: 是否有连接在排队, 此时新连接也要排队, 避免插队
+//	@receiver q
+//	@return bool
+func (q *LoginQueue) Waiting() bool {
+	return q.Len() > 0
+}
+
+// Join
+//
+//	@Description: 连接进入排队并立即收到排名
+//	@receiver q
+//	@param conn 客户端连接
+//	@param lane 排队通道
+//	@return bool 未开启、停止接收或已满时返回false, 由调用者拒绝连接
+func (q *LoginQueue) Join(conn iface.IConn, lane int) bool {
+	if !q.Accepting() {
+		return false
+	}
+	q.lock.Lock()
+	if q.stopped {
+		q.lock.Unlock()
+		return false
+	}
+	if maxLen := q.maxLen.Load(); maxLen > 0 && int64(q.length()) >= maxLen {
+		q.lock.Unlock()
+		return false
+	}
+	reader := newQueuedConn(conn)
+	w := &waiter{conn: reader, lane: lane, joined: time.Now()}
+	q.lanes[lane] = append(q.lanes[lane], w)
+	position := 0
+	for i := 0; i <= lane; i++ {
+		position += len(q.lanes[i])
+	}
+	eta := q.eta(position)
+	metrics.QueueLength.Set(int64(q.length()))
+	q.lock.Unlock()
+
+	metrics.QueueJoined.With(LaneNames[lane]).Inc()
+	netLog.Infof("login queue join, lane: %s, position: %d, remote: %s", LaneNames[lane], position, conn.RemoteAddr())
+	go q.watch(w, reader)
+	if !q.notify(w, position, eta) {
+		q.abandon(w)
+	}
+	return true
+}
+
+func (q *LoginQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.length()
+}
+
+// Lanes
+//
+//	@Description: 各通道的排队数
+//	@receiver q
+//	@return map[string]int
+func (q *LoginQueue) Lanes() map[string]int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	lanes := make(map[string]int, QueueLanes)
+	for lane, waiters := range q.lanes {
+		lanes[LaneNames[lane]] = len(waiters)
+	}
+	return lanes
+}
+
+// Rate
+//
+//	@Description: 平滑后的每秒晋升数, 用于估算等待时间
+//	@receiver q
+//	@return float64
+func (q *LoginQueue) Rate() float64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.rate
+}
+
+// Drain
+//
+//	@Description: 开始或停止排空: 排空期间不再接收新的排队连接, 已排队的连接继续晋升
+//	@receiver q
+//	@param enabled 是否排空
+func (q *LoginQueue) Drain(enabled bool) {
+	q.draining.Store(enabled)
+	netLog.Infof("login queue drain: %v", enabled)
+}
+
+func (q *LoginQueue) IsDraining() bool {
+	return q.draining.Load()
+}
+
+// Flush
+//
+//	@Description: 清空排队, 全部连接收到codec.MsgIdOverflow后以codec.CloseOverflow关闭
+//	@receiver q
+//	@return int 清空的连接数
+func (q *LoginQueue) Flush() int {
+	q.lock.Lock()
+	var waiters []*waiter
+	for lane := range q.lanes {
+		waiters = append(waiters, q.lanes[lane]...)
+		q.lanes[lane] = nil
+	}
+	metrics.QueueLength.Set(0)
+	q.lock.Unlock()
+
+	frame := overflowFrame(q.slots.RetryAfter())
+	for _, w := range waiters {
+		metrics.QueueLeft.Inc()
+		_ = w.send(frame)
+		if w.finish() {
+			_ = w.conn.CloseWith(codec.CloseOverflow, "login queue flushed")
+		}
+	}
+	if len(waiters) > 0 {
+		netLog.Warnf("login queue flushed, count: %d", len(waiters))
+	}
+	return len(waiters)
+}
+
+// Stop
+//
+//	@Description: 停止处理协程并清空排队
+//	@receiver q
+func (q *LoginQueue) Stop() {
+	q.lock.Lock()
+	if q.stopped {
+		q.lock.Unlock()
+		return
+	}
+	q.stopped = true
+	running := q.running
+	q.lock.Unlock()
+
+	if running {
+		q.exitChan <- true
+	}
+	q.Flush()
+}
+
+// length
+//
+//	@Description: 排队总数, 调用时需持有锁
+//	@receiver q
+//	@return int
+func (q *LoginQueue) length() int {
+	length := 0
+	for _, waiters := range q.lanes {
+		length += len(waiters)
+	}
+	return length
+}
+
+// eta
+//
+//	@Description: 按晋升速度估算的等待秒数, 还没有晋升记录时为0, 调用时需持有锁
+//	@receiver q
+//	@param position 排名
+//	@return uint32
+func (q *LoginQueue) eta(position int) uint32 {
+	if q.rate <= 0 {
+		return 0
+	}
+	return uint32(float64(position)/q.rate + 0.5)
+}
+
+// run
+//
+//	@Description: 处理协程, 定时晋升和通知排名
+//	@receiver q
+func (q *LoginQueue) run() {
+	ticker := time.NewTicker(QueuePromoteInterval)
+	defer ticker.Stop()
+	notifiedAt := time.Now()
+	for {
+		select {
+		case <-q.exitChan:
+			return
+		case now := <-ticker.C:
+			q.promote()
+			if now.Sub(notifiedAt) >= time.Duration(q.interval.Load()) {
+				notifiedAt = now
+				q.notifyAll()
+			}
+		}
+	}
+}
+
+// promote
+//
+//	@Description: 名额空出时按优先级晋升排队的连接
+//	@receiver q
+func (q *LoginQueue) promote() {
+	for {
+		q.lock.Lock()
+		var w *waiter
+		for lane := range q.lanes {
+			if len(q.lanes[lane]) > 0 {
+				w = q.lanes[lane][0]
+				break
+			}
+		}
+		if w == nil || !q.slots.Acquire() {
+			q.sample()
+			q.lock.Unlock()
+			return
+		}
+		q.lanes[w.lane][0] = nil
+		q.lanes[w.lane] = q.lanes[w.lane][1:]
+		q.promoted++
+		metrics.QueueLength.Set(int64(q.length()))
+		q.lock.Unlock()
+
+		wait := time.Since(w.joined)
+		metrics.QueueWait.Observe(wait.Seconds())
+		metrics.QueuePromoted.With(LaneNames[w.lane]).Inc()
+		netLog.Infof("login queue promote, lane: %s, wait: %s, remote: %s", LaneNames[w.lane], wait, w.conn.RemoteAddr())
+		w.finish()
+		q.admit(w.conn)
+	}
+}
+
+// sample
+//
+//	@Description: 统计晋升速度, 调用时需持有锁
+//	@receiver q
+func (q *LoginQueue) sample() {
+	elapsed := time.Since(q.sampledAt)
+	if elapsed < queueRateWindow {
+		return
+	}
+	current := float64(q.promoted) / elapsed.Seconds()
+	if q.length() == 0 {
+		// 没有排队时名额充足, 晋升数不代表速度, 保持之前的估算
+		current = q.rate
+	}
+	q.rate = q.rate*(1-queueRateWeight) + current*queueRateWeight
+	q.promoted = 0
+	q.sampledAt = time.Now()
+}
+
+// notifyAll
+//
+//	@Description: 通知全部排队连接的排名和预计等待时间, 写入失败的连接移出排队
+//	@receiver q
+func (q *LoginQueue) notifyAll() {
+	type entry struct {
+		w        *waiter
+		position int
+		eta      uint32
+	}
+	q.lock.Lock()
+	entries := make([]entry, 0, q.length())
+	position := 0
+	for _, waiters := range q.lanes {
+		for _, w := range waiters {
+			position++
+			entries = append(entries, entry{w: w, position: position, eta: q.eta(position)})
+		}
+	}
+	q.lock.Unlock()
+
+	for _, e := range entries {
+		if !q.notify(e.w, e.position, e.eta) {
+			q.abandon(e.w)
+		}
+	}
+}
+
+// notify
+//
+//	@Description: 发送codec.MsgIdQueue
+//	@receiver q
+//	@param w 排队连接
+//	@param position 排名
+//	@param eta 预计等待秒数
+//	@return bool 是否成功
+func (q *LoginQueue) notify(w *waiter, position int, eta uint32) bool {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(position))
+	binary.BigEndian.PutUint32(data[4:], eta)
+	return w.send(codec.NewStream().Marshal(codec.NewMessage(codec.MsgIdQueue, 0, data)))
+}
+
+// watch
+//
+//	@Description: 后台读取排队连接, 排队期间断开或缓存写满时移出排队; 晋升后继续为会话读取, 直到连接出错或关闭
+//	@receiver q
+//	@param w 排队连接
+//	@param conn 排队连接的读取包装
+func (q *LoginQueue) watch(w *waiter, conn *queuedConn) {
+	defer close(conn.reads)
+	for {
+		data, err := conn.IConn.ReadData()
+		result := readResult{err: err}
+		if err == nil {
+			// 读到的数据只在下次读取前有效, 缓存前需要复制
+			result.data = append([]byte(nil), data...)
+		}
+		select {
+		case conn.reads <- result:
+		default:
+			if w.waiting() {
+				netLog.Warnf("login queue read buffer full, remote: %s", conn.RemoteAddr())
+				q.abandon(w)
+				return
+			}
+			select {
+			case conn.reads <- result:
+			case <-conn.closed:
+				return
+			}
+		}
+		if err != nil {
+			// 已晋升时由会话处理读取错误
+			q.abandon(w)
+			return
+		}
+	}
+}
+
+// abandon
+//
+//	@Description: 连接已断开, 移出排队
+//	@receiver q
+//	@param w 排队连接
+func (q *LoginQueue) abandon(w *waiter) {
+	q.lock.Lock()
+	waiters := q.lanes[w.lane]
+	found := false
+	for i := range waiters {
+		if waiters[i] == w {
+			q.lanes[w.lane] = append(waiters[:i], waiters[i+1:]...)
+			found = true
+			break
+		}
+	}
+	metrics.QueueLength.Set(int64(q.length()))
+	q.lock.Unlock()
+
+	// 可能已被晋升或清空
+	if found && w.finish() {
+		metrics.QueueLeft.Inc()
+		netLog.Infof("login queue leave, lane: %s, remote: %s", LaneNames[w.lane], w.conn.RemoteAddr())
+		_ = w.conn.Close()
+	}
+}
+
+// setWriteDeadline
+//
+//	@Description: 设置连接的写超时, 连接不支持时忽略
+//	@param conn 连接
+//	@param t 超时时间, 零值为取消
+func setWriteDeadline(conn iface.IConn, t time.Time) {
+	if deadline, ok := conn.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		_ = deadline.SetWriteDeadline(t)
+	}
+}
@@ -0,0 +1,67 @@
+package net
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RateLimit
+// @Description: 会话消息频率限制参数, 所有会话共享, 可热更新
+type RateLimit struct {
+	rate  atomic.Int64 // 每秒消息数, 0为不限制
+	burst atomic.Int64 // 突发上限
+}
+
+// Set
+//
+//	@Description: 修改限制参数, 已有会话下一条消息起生效
+//	@receiver r
+//	@param rate 每秒消息数
+//	@param burst 突发上限, 小于rate时取rate
+func (r *RateLimit) Set(rate, burst int) {
+	if burst < rate {
+		burst = rate
+	}
+	r.rate.Store(int64(rate))
+	r.burst.Store(int64(burst))
+}
+
+// RateLimiter
+// @Description: 单个会话的令牌桶, 仅由会话读协程使用
+type RateLimiter struct {
+	limit  *RateLimit // 共享的限制参数
+	tokens float64    // 当前令牌数
+	last   time.Time  // 上次补充时间
+}
+
+func NewRateLimiter(limit *RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:  limit,
+		tokens: float64(limit.burst.Load()),
+		last:   time.Now(),
+	}
+}
+
+// Allow
+//
+//	@Description: 消耗一个令牌
+//	@receiver l
+//	@return bool
+func (l *RateLimiter) Allow() bool {
+	rate := l.limit.rate.Load()
+	if rate <= 0 {
+		return true
+	}
+	burst := float64(l.limit.burst.Load())
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+	l.last = now
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
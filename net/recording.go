@@ -0,0 +1,169 @@
+package net
+
+import (
+	"fmt"
+	"github.com/liaoyudong2/GateServer/record"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRecordDir 默认录制目录
+const DefaultRecordDir = "log/record"
+
+// recordSeq 录制文件序号, 同一会话在同一时刻多次开始录制时文件名也不重复
+var recordSeq atomic.Uint64
+
+// Recording
+// @Description: 流量录制设置, 按会话ID或用户ID开启, 由网关服务持有, 所有会话共享
+type Recording struct {
+	lock     sync.RWMutex    // 读写锁
+	dir      string          // 录制目录
+	sessions map[uint32]bool // 需要录制的会话
+	users    map[string]bool // 需要录制的用户
+}
+
+// SetDir
+//
+//	@Description: 设置录制目录, 对之后开始的录制生效
+//	@receiver r
+//	@param dir 目录
+func (r *Recording) SetDir(dir string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.dir = dir
+}
+
+func (r *Recording) Dir() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.dir == "" {
+		return DefaultRecordDir
+	}
+	return r.dir
+}
+
+// SetSession
+//
+//	@Description: 开启或关闭会话录制
+//	@receiver r
+//	@param sessionId 会话ID
+//	@param enabled 是否开启
+func (r *Recording) SetSession(sessionId uint32, enabled bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if enabled {
+		if r.sessions == nil {
+			r.sessions = make(map[uint32]bool)
+		}
+		r.sessions[sessionId] = true
+	} else {
+		delete(r.sessions, sessionId)
+	}
+}
+
+// SetUser
+//
+//	@Description: 开启或关闭用户录制, 用户的新会话绑定用户ID后开始录制
+//	@receiver r
+//	@param userId 用户ID
+//	@param enabled 是否开启
+func (r *Recording) SetUser(userId string, enabled bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if enabled {
+		if r.users == nil {
+			r.users = make(map[string]bool)
+		}
+		r.users[userId] = true
+	} else {
+		delete(r.users, userId)
+	}
+}
+
+// SetUsers
+//
+//	@Description: 整体替换需要录制的用户(配置重载时使用)
+//	@receiver r
+//	@param userIds 用户ID
+func (r *Recording) SetUsers(userIds []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.users = make(map[string]bool, len(userIds))
+	for _, userId := range userIds {
+		r.users[userId] = true
+	}
+}
+
+// Targets
+//
+//	@Description: 当前需要录制的会话和用户
+//	@receiver r
+//	@return sessions 会话ID
+//	@return users 用户ID
+func (r *Recording) Targets() (sessions []uint32, users []string) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for sessionId := range r.sessions {
+		sessions = append(sessions, sessionId)
+	}
+	for userId := range r.users {
+		users = append(users, userId)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i] < sessions[j]
+	})
+	sort.Strings(users)
+	return sessions, users
+}
+
+// Wants
+//
+//	@Description: 会话或其绑定的用户是否需要录制
+//	@receiver r
+//	@param sessionId 会话ID
+//	@param userId 用户ID, 未绑定时为空
+//	@return bool
+func (r *Recording) Wants(sessionId uint32, userId string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.sessions[sessionId] || (userId != "" && r.users[userId])
+}
+
+// create
+//
+//	@Description: 创建录制文件: 目录/record-会话ID-追踪ID-时间-序号.grec, 不覆盖已有文件
+//	@receiver r
+//	@param sessionId 会话ID
+//	@param traceId 追踪ID
+//	@return *record.Writer
+//	@return string 文件路径
+//	@return error
+func (r *Recording) create(sessionId uint32, traceId uint64) (*record.Writer, string, error) {
+	dir := r.Dir()
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("record-%d-%s-%s-%d.grec", sessionId, FormatTraceId(traceId), now.Format("20060102-150405"), recordSeq.Add(1)))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, "", err
+	}
+	writer, err := record.NewWriter(file, record.Header{SessionId: sessionId, TraceId: traceId, StartTime: now})
+	if err != nil {
+		_ = file.Close()
+		return nil, "", err
+	}
+	return writer, path, nil
+}
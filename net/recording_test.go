@@ -0,0 +1,225 @@
+package net_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/client"
+	"github.com/liaoyudong2/GateServer/gatetest"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/record"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordingWants(t *testing.T) {
+	var recording gatenet.Recording
+	if recording.Dir() != gatenet.DefaultRecordDir || recording.Wants(1, "") {
+		t.Fatal("unexpected defaults")
+	}
+
+	// 按会话ID或绑定的用户ID录制
+	recording.SetSession(1, true)
+	recording.SetUser("u1", true)
+	for _, c := range []struct {
+		sessionId uint32
+		userId    string
+		want      bool
+	}{{1, "", true}, {1, "u2", true}, {2, "", false}, {2, "u1", true}, {2, "u2", false}} {
+		if got := recording.Wants(c.sessionId, c.userId); got != c.want {
+			t.Errorf("Wants(%d, %q) = %v, want %v", c.sessionId, c.userId, got, c.want)
+		}
+	}
+
+	// 整体替换用户, 关闭会话录制
+	recording.SetUsers([]string{"u3", "u2"})
+	recording.SetSession(1, false)
+	if recording.Wants(1, "") || recording.Wants(2, "u1") || !recording.Wants(2, "u2") {
+		t.Fatal("Wants does not follow SetUsers/SetSession")
+	}
+	sessions, users := recording.Targets()
+	if len(sessions) != 0 || !reflect.DeepEqual(users, []string{"u2", "u3"}) {
+		t.Fatalf("targets %v %v", sessions, users)
+	}
+}
+
+// recordFile 一个录制文件的会话ID和帧(方向 消息ID 内容)
+type recordFile struct {
+	sessionId uint32
+	frames    []string
+}
+
+// readRecords 读取目录下的全部录制文件, 每个文件都必须完整
+func readRecords(t *testing.T, dir string) []recordFile {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "record-*.grec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []recordFile
+	for _, path := range paths {
+		in, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := record.NewReader(in)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		file := recordFile{sessionId: reader.Header().SessionId}
+		for {
+			frame, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			file.frames = append(file.frames, fmt.Sprintf("%s %d %s", record.DirName(frame.Dir), frame.MsgId, frame.Data))
+		}
+		_ = in.Close()
+		files = append(files, file)
+	}
+	return files
+}
+
+func TestSessionRecord(t *testing.T) {
+	gate := gatetest.Start(t)
+	dir := t.TempDir()
+	gate.Service.SetRecordDir(dir)
+	replies := make(chan iface.IMessage, 4)
+	dial := func() *client.Client {
+		c := gate.Dial(client.Config{})
+		c.HandleDefault(func(msg iface.IMessage) {
+			replies <- msg
+		})
+		return c
+	}
+	// request 发送消息并等待后端回显, 返回会话ID
+	request := func(c *client.Client, msgId uint16, data string) uint32 {
+		t.Helper()
+		gate.Backend.Reset()
+		if err := c.Send(msgId, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		req, err := gate.Backend.WaitMsg(msgId, gatetest.DefaultTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-replies:
+		case <-time.After(gatetest.DefaultTimeout):
+			t.Fatalf("no reply to msgId %d", msgId)
+		}
+		return req.SessionId
+	}
+
+	// 按会话录制, 开始之前的消息不录制
+	bySession := dial()
+	sessionId := request(bySession, 100, "before")
+	if err := gate.Service.RecordSession(sessionId, true); err != nil {
+		t.Fatal(err)
+	}
+	request(bySession, 101, "session")
+
+	// 按用户录制, 绑定用户后开始
+	byUser := dial()
+	gate.Service.RecordUser("u1", true)
+	userSession := request(byUser, 100, "before")
+	if err := gate.Backend.BindUser(userSession, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	session := gate.Session(userSession)
+	if !gate.Eventually(session.IsRecording) {
+		t.Fatal("bound user not recorded")
+	}
+	request(byUser, 102, "user")
+
+	// 会话关闭后留下完整的录制文件, 关闭后不能再开始录制
+	_ = bySession.Close()
+	_ = byUser.Close()
+	gate.WaitSessions(0)
+	if err := session.Record(true); err != nil || session.IsRecording() {
+		t.Fatalf("closed session recording: %v", err)
+	}
+	got := map[uint32][]string{}
+	for _, file := range readRecords(t, dir) {
+		got[file.sessionId] = append(got[file.sessionId], file.frames...)
+	}
+	want := map[uint32][]string{
+		sessionId:   {"in 101 session", "out 101 session"},
+		userSession: {"in 102 user", "out 102 user"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("recorded %q, want %q", got, want)
+	}
+}
+
+func TestSessionRecordToggle(t *testing.T) {
+	gate := gatetest.Start(t)
+	dir := t.TempDir()
+	gate.Service.SetRecordDir(dir)
+	c := gate.Dial(client.Config{})
+	ready := make(chan bool, 1)
+	c.Handle(100, func(iface.IMessage) {
+		ready <- true
+	})
+	if err := c.Send(100, nil); err != nil {
+		t.Fatal(err)
+	}
+	req, err := gate.Backend.WaitMsg(100, gatetest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 等待回显到达, 避免被录制
+	select {
+	case <-ready:
+	case <-time.After(gatetest.DefaultTimeout):
+		t.Fatal("no reply to msgId 100")
+	}
+
+	// 读写协程收发的同时反复开始和停止录制, 用 -race 检查, 每个文件都完整
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = c.Send(101, []byte("data"))
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if err = gate.Service.RecordSession(req.SessionId, i%2 == 0); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_ = gate.Service.RecordSession(req.SessionId, true)
+	close(stop)
+	wg.Wait()
+	_ = c.Close()
+	gate.WaitSessions(0)
+
+	files := readRecords(t, dir)
+	if len(files) != 26 {
+		t.Fatalf("%d record files, want 26", len(files))
+	}
+	for _, file := range files {
+		for _, frame := range file.frames {
+			if frame != "in 101 data" && frame != "out 101 data" {
+				t.Fatalf("unexpected frame %q", frame)
+			}
+		}
+	}
+}
@@ -1,36 +1,92 @@
 package net
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"github.com/gorilla/websocket"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/metrics"
 	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/record"
 	"github.com/liaoyudong2/GateServer/zlog"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	SessionWriteQueue   = 256             // 会话写队列长度, 写满时视为客户端接收过慢并关闭会话
+	SessionWriteTimeout = 5 * time.Second // 单次写入的超时时间, 超时后关闭会话
+)
+
+// SessionOptions
+// @Description: 会话共享设置, 由网关服务持有, 可在运行中修改, 对已有会话同样生效
+type SessionOptions struct {
+	RateLimit RateLimit    // 消息频率限制
+	Tracing   Tracing      // 追踪设置
+	CrashDump CrashDump    // 崩溃转储设置
+	Recording Recording    // 流量录制设置
+	Echo      atomic.Bool  // 是否回显codec.MsgIdEcho消息, 用于压测
+	Slots     SessionSlots // 会话名额, 接入前占用, 会话关闭时归还
+}
+
+// tracedConn
+// @Description: 已发送过追踪上下文的后端连接, 会话迁移到其他实例或后端重连后需要重新发送
+type tracedConn struct {
+	backendId string // 后端实例ID
+	connId    uint64 // 连接序号
+}
+
 type Session struct {
-	sessionId  uint32              // 会话ID
-	conn       *websocket.Conn     // 连接对象
-	closed     bool                // 是否已关闭
-	lock       sync.RWMutex        // 读写锁
-	exitChan   chan bool           // 关闭信号
-	exitStr    string              // 退出原因
-	writeChan  chan iface.IMessage // 写通道
-	rawChan    chan []byte         // 原始写通道
-	netStream  iface.IStream       // 解析
-	sessionMgr iface.ISessionMgr   // 管理方
-}
-
-func NewSession(sessionId uint32, conn *websocket.Conn, sessionMgr iface.ISessionMgr) iface.ISession {
+	sessionId  uint32                        // 会话ID
+	conn       iface.IConn                   // 连接对象
+	closed     bool                          // 是否已关闭
+	lock       sync.RWMutex                  // 读写锁
+	exitChan   chan bool                     // 关闭信号
+	exitCode   uint16                        // 通知客户端的关闭码, 为0时不通知
+	exitStr    string                        // 退出原因
+	writeChan  chan iface.IMessage           // 写通道
+	rawChan    chan []byte                   // 原始写通道
+	netStream  *codec.Stream                 // 解析
+	sessionMgr iface.ISessionMgr             // 管理方
+	backendMgr iface.IBackendMgr             // 后端转发
+	limiter    *RateLimiter                  // 消息频率限制
+	createdAt  time.Time                     // 创建时间
+	userId     string                        // 绑定的用户ID
+	bytesIn    atomic.Uint64                 // 已接收字节数
+	bytesOut   atomic.Uint64                 // 已发送字节数
+	traceId    uint64                        // 追踪ID
+	options    *SessionOptions               // 共享设置
+	recorder   atomic.Pointer[record.Writer] // 流量录制, 为空时不录制
+	requestId  uint32                        // 最近一条转发消息的请求ID(仅读协程访问)
+	traced     map[string]tracedConn         // 服务 -> 已发送过追踪上下文的后端连接(仅读协程访问)
+	log        *zlog.ZLogger                 // 会话日志, 带会话ID和追踪ID
+	codecLog   *zlog.ZLogger                 // 编解码日志, 带会话ID和追踪ID
+}
+
+func NewSession(sessionId uint32, conn iface.IConn, sessionMgr iface.ISessionMgr, backendMgr iface.IBackendMgr, options *SessionOptions) iface.ISession {
+	traceId := NewTraceId()
 	session := &Session{
 		sessionId:  sessionId,
 		conn:       conn,
 		closed:     false,
 		exitChan:   make(chan bool, 1),
-		writeChan:  make(chan iface.IMessage, 1),
-		rawChan:    make(chan []byte, 1),
-		netStream:  NewStream(),
+		writeChan:  make(chan iface.IMessage, SessionWriteQueue),
+		rawChan:    make(chan []byte, SessionWriteQueue),
+		netStream:  codec.NewStream(),
 		sessionMgr: sessionMgr,
+		backendMgr: backendMgr,
+		limiter:    NewRateLimiter(&options.RateLimit),
+		createdAt:  time.Now(),
+		traceId:    traceId,
+		options:    options,
+		traced:     make(map[string]tracedConn),
+		log:        sessionLog.With("session", sessionId, "trace", FormatTraceId(traceId)),
+		codecLog:   codecLog.With("session", sessionId, "trace", FormatTraceId(traceId)),
+	}
+	if options.Recording.Wants(sessionId, "") {
+		_ = session.Record(true)
 	}
 	// 启动读
 	go session.startReader()
@@ -43,6 +99,152 @@ func (s *Session) GetSessionId() uint32 {
 	return s.sessionId
 }
 
+func (s *Session) GetRemoteAddr() string {
+	return s.conn.RemoteAddr().String()
+}
+
+func (s *Session) GetUserId() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.userId
+}
+
+func (s *Session) SetUserId(userId string) {
+	s.lock.Lock()
+	s.userId = userId
+	s.lock.Unlock()
+
+	s.log.Infof("session bind user: %s", userId)
+	if s.options.Recording.Wants(s.sessionId, userId) {
+		_ = s.Record(true)
+	}
+}
+
+// Record
+//
+//	@Description: 开始或停止录制会话流量, 会话关闭时自动停止, 关闭后不能再开始
+//	@receiver s
+//	@param enabled 是否录制
+//	@return error
+func (s *Session) Record(enabled bool) error {
+	if !enabled {
+		if writer := s.recorder.Swap(nil); writer != nil {
+			s.log.Infof("session record stop, frames: %d", writer.Frames())
+			return writer.Close()
+		}
+		return nil
+	}
+	if s.recorder.Load() != nil || s.isClosed() {
+		return nil
+	}
+	writer, path, err := s.options.Recording.create(s.sessionId, s.traceId)
+	if err != nil {
+		s.log.Errorf("session record start error: %v", err)
+		return err
+	}
+	if !s.recorder.CompareAndSwap(nil, writer) {
+		_ = writer.Close()
+		_ = os.Remove(path)
+		return nil
+	}
+	s.log.Infof("session record start: %s", path)
+	// 与Close并发时, Close中的停止录制可能早于上面的开始, 由这里停止
+	if s.isClosed() {
+		return s.Record(false)
+	}
+	return nil
+}
+
+func (s *Session) isClosed() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.closed
+}
+
+// IsRecording
+//
+//	@Description: 是否正在录制
+//	@receiver s
+//	@return bool
+func (s *Session) IsRecording() bool {
+	return s.recorder.Load() != nil
+}
+
+// recordFrame
+//
+//	@Description: 录制一帧, 未录制时直接返回
+//	@receiver s
+//	@param dir 方向(record.DirIn/record.DirOut)
+//	@param msgId 消息ID
+//	@param data 消息内容
+func (s *Session) recordFrame(dir uint8, msgId uint16, data []byte) {
+	if writer := s.recorder.Load(); writer != nil {
+		_ = writer.Write(dir, msgId, data)
+	}
+}
+
+// GetTraceId
+//
+//	@Description: 追踪ID, 会话的日志和发往后端的追踪上下文都带有此ID
+//	@receiver s
+//	@return string
+func (s *Session) GetTraceId() string {
+	return FormatTraceId(s.traceId)
+}
+
+func (s *Session) GetCreatedAt() time.Time {
+	return s.createdAt
+}
+
+func (s *Session) GetBytesIn() uint64 {
+	return s.bytesIn.Load()
+}
+
+func (s *Session) GetBytesOut() uint64 {
+	return s.bytesOut.Load()
+}
+
+// Kick
+//
+//	@Description: 踢下线, 客户端收到codec.CloseKicked和原因
+//	@receiver s
+//	@param reason 原因
+func (s *Session) Kick(reason string) {
+	s.Disconnect(codec.CloseKicked, reason)
+}
+
+// Disconnect
+//
+//	@Description: 记录关闭码和原因后关闭, websocket客户端收到关闭帧, tcp客户端收到codec.MsgIdDisconnect
+//	@receiver s
+//	@param code 关闭码
+//	@param reason 原因, 为空时使用关闭码的默认原因
+func (s *Session) Disconnect(code uint16, reason string) {
+	s.setExit(code, reason)
+	s.Close()
+}
+
+// setExit
+//
+//	@Description: 记录退出原因, 会话已关闭时忽略, 关闭连接引起的读写错误不会覆盖原因
+//	@receiver s
+//	@param code 通知客户端的关闭码, 为0时不通知(如客户端已断开)
+//	@param reason 原因
+//	@return bool 是否记录
+func (s *Session) setExit(code uint16, reason string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.exitCode = code
+	s.exitStr = reason
+	return true
+}
+
 func (s *Session) Close() {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -50,89 +252,273 @@ func (s *Session) Close() {
 	if s.closed == true {
 		return
 	}
-	_ = s.conn.Close()
+	if s.exitCode == 0 {
+		_ = s.conn.Close()
+	} else {
+		// 通知可能等待正在进行的写入, 不阻塞调用方(如后端读协程)
+		go func(code uint16, reason string) {
+			_ = s.conn.CloseWith(code, reason)
+		}(s.exitCode, s.exitStr)
+	}
 	s.closed = true
 	s.exitChan <- true
-	zlog.Infof("session close, session id is [%d], reason: [%s]", s.sessionId, s.exitStr)
+	metrics.SessionLifetime.Observe(time.Since(s.createdAt).Seconds())
+	s.log.Infof("session close, code: %d, reason: [%s]", s.exitCode, s.exitStr)
+	_ = s.Record(false)
 	s.sessionMgr.RemoveSession(s.sessionId)
+	s.options.Slots.Release()
 }
 
+// SendMessage
+//
+//	@Description: 发送消息到客户端, 消息是帧时转移一个引用, 写完后释放. 不阻塞调用方(如后端读协程),
+//	写队列已满时丢弃消息并关闭会话
+//	@receiver s
+//	@param msg 消息
 func (s *Session) SendMessage(msg iface.IMessage) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-
-	zlog.Infof("session write message, msgId:%d, msgLen:%d", msg.GetMsgId(), msg.GetMsgLen())
-	s.writeChan <- msg
+	s.lock.RLock()
+	if s.closed {
+		s.lock.RUnlock()
+		codec.Release(msg)
+		return
+	}
+	metrics.WriteQueueDepth.Observe(float64(len(s.writeChan)))
+	select {
+	case s.writeChan <- msg:
+		s.lock.RUnlock()
+		s.log.Debugf("session write message, msgId:%d, msgLen:%d", msg.GetMsgId(), msg.GetMsgLen())
+		return
+	default:
+	}
+	s.lock.RUnlock()
+	s.log.Warnf("session write queue full, drop msgId: %d", msg.GetMsgId())
+	codec.Release(msg)
+	s.tooSlow()
 }
 
+// RawBuffer
+//
+//	@Description: 发送原始数据到客户端, 与SendMessage相同, 写队列已满时丢弃并关闭会话
+//	@receiver s
+//	@param buf 数据
 func (s *Session) RawBuffer(buf []byte) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	s.lock.RLock()
+	if s.closed {
+		s.lock.RUnlock()
+		return
+	}
+	select {
+	case s.rawChan <- buf:
+		s.lock.RUnlock()
+		s.log.Debugf("session write raw buffer")
+		return
+	default:
+	}
+	s.lock.RUnlock()
+	s.log.Warnf("session write queue full, drop raw buffer, size: %d", len(buf))
+	s.tooSlow()
+}
+
+// tooSlow
+//
+//	@Description: 写队列已满, 客户端接收过慢, 以codec.CloseTooSlow关闭会话, 不影响其他会话
+//	@receiver s
+func (s *Session) tooSlow() {
+	if s.setExit(codec.CloseTooSlow, "write queue full") {
+		metrics.SlowSessions.Inc()
+	}
+	s.Close()
+}
+
+// write
+//
+//	@Description: 带超时写入, 失败时关闭会话
+//	@receiver s
+//	@param data 数据
+//	@return bool 是否成功
+func (s *Session) write(data []byte) bool {
+	setWriteDeadline(s.conn, time.Now().Add(SessionWriteTimeout))
+	err := s.conn.WriteData(data)
+	if err == nil {
+		return true
+	}
+	if s.setExit(0, "write error: "+err.Error()) {
+		s.log.Error("session write err: ", err)
+	}
+	s.Close()
+	return false
+}
 
-	zlog.Infof("session write raw buffer")
-	s.rawChan <- buf
+// onPanic
+//
+//	@Description: 会话协程panic后的处理: 记录堆栈和指标, 写崩溃转储, 只关闭当前会话
+//	@receiver s
+//	@param where 出错的协程(reader/writer)
+//	@param value panic值
+//	@param data 出错时正在处理的消息
+func (s *Session) onPanic(where string, value interface{}, data []byte) {
+	metrics.SessionPanics.With(where).Inc()
+	s.log.Stack(fmt.Sprintf("session %s panic: %v", where, value))
+	if path, err := s.options.CrashDump.Write(s.sessionId, s.GetTraceId(), where, value, data); err != nil {
+		s.log.Errorf("session write crash dump error: %v", err)
+	} else if path != "" {
+		s.log.Errorf("session crash dump written: %s", path)
+	}
+	s.setExit(codec.CloseInternalError, "panic")
 }
 
 func (s *Session) startReader() {
-	zlog.Info("session reader start: ", s.sessionId)
+	s.log.Infof("session reader start, remote: %s", s.GetRemoteAddr())
 	defer s.Close()
+	var data []byte // 正在处理的消息, 崩溃转储使用
+	defer func() {
+		if r := recover(); r != nil {
+			s.onPanic("reader", r, data)
+		}
+	}()
 
 	for {
-		msgType, data, err := s.conn.ReadMessage()
+		buf, err := s.conn.ReadData()
+		data = buf
 		if err != nil {
-			zlog.Error("session read error: ", err)
-			s.exitStr = err.Error()
-			break
-		}
-		if msgType != websocket.BinaryMessage {
-			zlog.Error("session read msg type error")
-			s.exitStr = fmt.Sprintf("websocket msg type error, [%d]", msgType)
+			code := uint16(0)
+			if errors.Is(err, codec.ErrMsgType) {
+				code = codec.CloseProtocolError
+			}
+			if s.setExit(code, err.Error()) {
+				s.log.Error("session read error: ", err)
+			}
 			break
 		}
-		readLen := 0
 		dataLen := len(data)
+		s.bytesIn.Add(uint64(dataLen))
 		sessionShutdown := false
-		for {
-			nread, message, err := s.netStream.Unmarshal(data)
+		for readLen := 0; readLen < dataLen; {
+			nread, message, err := s.netStream.UnmarshalFrame(data[readLen:])
 			if err != nil {
-				zlog.Error("session net stream unmarshal error: ", err)
+				s.codecLog.Error("session net stream unmarshal error: ", err)
+				metrics.CodecErrors.With(metrics.SourceClient).Inc()
 				sessionShutdown = true
 				break
 			}
 			readLen += nread
-			if message == nil || readLen > dataLen {
-				break
+			if message == nil {
+				continue
 			}
-			zlog.Infof("session receive msg, id: %d size: %d", message.GetMsgId(), message.GetMsgLen())
+			s.log.Debugf("session receive msg, id: %d size: %d", message.GetMsgId(), message.GetMsgLen())
+			s.recordFrame(record.DirIn, message.GetMsgId(), message.GetMsgData())
+			s.forward(message)
 		}
 		if sessionShutdown {
-			s.exitStr = fmt.Sprintf("session message unmarshal failed")
+			s.setExit(codec.CloseProtocolError, "message unmarshal failed")
 			break
 		}
 	}
-	zlog.Info("session reader stop: ", s.sessionId)
+	s.log.Info("session reader stop")
+}
+
+// forward
+//
+//	@Description: 转发客户端消息到后端, 保留字段填充为会话ID, 帧不复制直接转发
+//	@receiver s
+//	@param message 客户端消息帧, 转发或丢弃后不能再访问
+func (s *Session) forward(message *codec.Frame) {
+	// 心跳和开启时的回显由网关直接返回
+	msgId := message.GetMsgId()
+	reply := msgId == codec.MsgIdHeartbeat || (msgId == codec.MsgIdEcho && s.options.Echo.Load())
+	if codec.IsGateMsgId(msgId) && !reply {
+		s.log.Warnf("session send gate reserved msgId: %d", message.GetMsgId())
+		metrics.MessageIn(metrics.ServiceReserved, metrics.MsgIdOther, message.GetMsgLen())
+		message.Release()
+		return
+	}
+	if !s.limiter.Allow() {
+		s.log.Warnf("session rate limited, msgId: %d", message.GetMsgId())
+		metrics.RateLimited.Inc()
+		message.Release()
+		return
+	}
+	if reply {
+		metrics.MessageIn(metrics.ServiceGate, metrics.MsgIdLabel(msgId), message.GetMsgLen())
+		message.SetReserve(0)
+		s.SendMessage(message)
+		return
+	}
+	service := s.backendMgr.Route(message.GetMsgId())
+	metrics.MessageIn(service, metrics.MsgIdLabel(msgId), message.GetMsgLen())
+	log := s.log
+	backend, err := s.backendMgr.Pick(service, s.sessionId)
+	if err != nil {
+		log.Errorf("session forward error, msgId: %d, err: %v", msgId, err)
+		message.Release()
+		return
+	}
+	conn := tracedConn{backendId: backend.GetId(), connId: backend.GetConnId()}
+	if s.options.Tracing.RequestId() {
+		s.requestId++
+		// 转发期间的日志带请求ID
+		log = log.With("req", s.requestId)
+		s.traced[service] = conn
+		if err = forwardTo(service, backend, NewTraceContext(s.sessionId, s.traceId, s.requestId)); err != nil {
+			log.Errorf("session forward trace context error: %v", err)
+			message.Release()
+			return
+		}
+		log.Debugf("session forward msg, msgId: %d, service: %s, backend: %s", msgId, service, conn.backendId)
+	} else if s.traced[service] != conn {
+		// 每个后端连接首次转发前发送一次, 后端据此关联会话的追踪ID
+		if err = forwardTo(service, backend, NewTraceContext(s.sessionId, s.traceId, 0)); err == nil {
+			s.traced[service] = conn
+		}
+	}
+	message.SetReserve(s.sessionId)
+	if err = forwardTo(service, backend, message); err != nil {
+		log.Errorf("session forward error, msgId: %d, err: %v", msgId, err)
+		// 未进入写队列, 引用仍由当前持有
+		message.Release()
+	}
 }
 
 func (s *Session) startWriter() {
-	zlog.Info("session writer start: ", s.sessionId)
+	s.log.Info("session writer start")
+	var data []byte // 正在发送的消息, 崩溃转储使用
+	defer func() {
+		if r := recover(); r != nil {
+			s.onPanic("writer", r, data)
+			s.Close()
+		}
+	}()
 
-	select {
-	case <-s.exitChan:
-		break
-	case msg, ok := <-s.writeChan:
-		if ok {
-			if err := s.conn.WriteMessage(websocket.BinaryMessage, s.netStream.Marshal(msg)); err != nil {
-				zlog.Error("session write err: ", err)
+	for running := true; running; {
+		select {
+		case <-s.exitChan:
+			running = false
+		case msg, ok := <-s.writeChan:
+			if ok {
+				frame := codec.FrameOf(msg)
+				data = frame.Bytes()
+				if running = s.write(data); running {
+					s.bytesOut.Add(uint64(len(data)))
+					s.recordFrame(record.DirOut, frame.GetMsgId(), frame.GetMsgData())
+					metrics.MessagesOut.With(metrics.MsgId(frame.GetMsgId())).Inc()
+					metrics.BytesOut.With(metrics.MsgId(frame.GetMsgId())).Add(uint64(frame.GetMsgLen()))
+				}
+				s.log.Debugf("session write message ok, msgId:%d, msgSize:%d", frame.GetMsgId(), frame.GetMsgLen())
+				data = nil
+				frame.Release()
 			}
-			zlog.Infof("session write message ok, msgId:%d, msgSize:%d", msg.GetMsgId(), msg.GetMsgLen())
-		}
-	case buf, ok := <-s.rawChan:
-		if ok {
-			if err := s.conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
-				zlog.Error("session write err: ", err)
+		case buf, ok := <-s.rawChan:
+			if ok {
+				data = buf
+				if running = s.write(buf); running {
+					s.bytesOut.Add(uint64(len(buf)))
+					if len(buf) >= codec.HeaderSize {
+						s.recordFrame(record.DirOut, binary.BigEndian.Uint16(buf[4:]), buf[codec.HeaderSize:])
+					}
+				}
+				s.log.Debugf("session write raw buffer ok")
 			}
-			zlog.Infof("session write raw buffer ok")
 		}
 	}
-	zlog.Info("session writer stop: ", s.sessionId)
+	s.log.Info("session writer stop")
 }
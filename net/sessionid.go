@@ -0,0 +1,102 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/codec"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrSessionIdExhausted 序号回绕一圈后仍没有空闲的会话ID
+var ErrSessionIdExhausted = errors.New("session id exhausted")
+
+// SessionIdGenerator
+// @Description: 会话ID生成器, ID由ServerId、重启纪元和自增序号组成, 格式见codec.MakeSessionId
+type SessionIdGenerator struct {
+	lock     sync.Mutex // 加锁
+	serverId uint32     // 网关ServerId
+	epoch    uint32     // 重启纪元
+	seq      uint32     // 上一次分配的序号
+}
+
+// NewSessionIdGenerator
+//
+//	@Description: 创建会话ID生成器
+//	@param serverId 网关ServerId, 不超过codec.MaxSessionServerId
+//	@param epoch 重启纪元, 超过codec.MaxSessionEpoch时回绕
+//	@return *SessionIdGenerator
+func NewSessionIdGenerator(serverId uint32, epoch uint32) *SessionIdGenerator {
+	return &SessionIdGenerator{
+		serverId: serverId & codec.MaxSessionServerId,
+		epoch:    epoch & codec.MaxSessionEpoch,
+	}
+}
+
+// Next
+//
+//	@Description: 分配下一个会话ID, 序号用完后回绕, 跳过0和仍在使用的ID
+//	@receiver g
+//	@param inUse 会话ID是否仍在使用
+//	@return uint32
+//	@return error 全部序号都在使用时返回ErrSessionIdExhausted
+func (g *SessionIdGenerator) Next(inUse func(sessionId uint32) bool) (uint32, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for i := 0; i < codec.MaxSessionSeq; i++ {
+		g.seq++
+		if g.seq > codec.MaxSessionSeq {
+			g.seq = 1
+		}
+		sessionId := codec.MakeSessionId(g.serverId, g.epoch, g.seq)
+		if !inUse(sessionId) {
+			return sessionId, nil
+		}
+	}
+	return 0, ErrSessionIdExhausted
+}
+
+func (g *SessionIdGenerator) GetServerId() uint32 {
+	return g.serverId
+}
+
+func (g *SessionIdGenerator) GetEpoch() uint32 {
+	return g.epoch
+}
+
+// NextSessionEpoch
+//
+//	@Description: 读取文件中保存的重启纪元, 加1后写回, 文件不存在时从0开始
+//	@param path 纪元文件路径
+//	@return uint32 本次启动的纪元
+//	@return error
+func NextSessionEpoch(path string) (uint32, error) {
+	var epoch uint32
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		last, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("session epoch file %s: %v", path, err)
+		}
+		epoch = (uint32(last) + 1) & codec.MaxSessionEpoch
+	case !os.IsNotExist(err):
+		return 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	// 先写临时文件再改名, 避免写到一半时退出导致文件损坏
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, []byte(strconv.FormatUint(uint64(epoch), 10)+"\n"), 0644); err != nil {
+		return 0, err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return epoch, nil
+}
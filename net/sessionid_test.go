@@ -0,0 +1,64 @@
+package net_test
+
+import (
+	"errors"
+	"github.com/liaoyudong2/GateServer/codec"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionIdGenerator(t *testing.T) {
+	generator := gatenet.NewSessionIdGenerator(200, 3)
+	inUse := map[uint32]bool{}
+	isInUse := func(sessionId uint32) bool {
+		return inUse[sessionId]
+	}
+
+	first, err := generator.Next(isInUse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.SessionServerId(first) != 200 || codec.SessionEpoch(first) != 3 || codec.SessionSeq(first) != 1 {
+		t.Fatalf("session id %#x: server %d epoch %d seq %d", first, codec.SessionServerId(first),
+			codec.SessionEpoch(first), codec.SessionSeq(first))
+	}
+
+	// 回绕后跳过0和仍在使用的ID
+	inUse[first] = true
+	inUse[codec.MakeSessionId(200, 3, 2)] = true
+	for seq := uint32(3); seq <= codec.MaxSessionSeq; seq++ {
+		sessionId, err := generator.Next(isInUse)
+		if err != nil || codec.SessionSeq(sessionId) != seq {
+			t.Fatalf("seq %d, want %d, err %v", codec.SessionSeq(sessionId), seq, err)
+		}
+	}
+	if wrapped, _ := generator.Next(isInUse); codec.SessionSeq(wrapped) != 3 {
+		t.Fatalf("seq %d after wraparound, want 3", codec.SessionSeq(wrapped))
+	}
+
+	if _, err = generator.Next(func(uint32) bool { return true }); !errors.Is(err, gatenet.ErrSessionIdExhausted) {
+		t.Fatalf("all ids in use: %v", err)
+	}
+}
+
+func TestNextSessionEpoch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "gate.epoch")
+	for i := 0; i <= codec.MaxSessionEpoch+1; i++ {
+		epoch, err := gatenet.NextSessionEpoch(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := uint32(i) & codec.MaxSessionEpoch; epoch != want {
+			t.Fatalf("start %d: epoch %d, want %d", i, epoch, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("bad"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gatenet.NextSessionEpoch(path); err == nil {
+		t.Fatal("corrupt epoch file accepted")
+	}
+}
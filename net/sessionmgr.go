@@ -1,8 +1,8 @@
 package net
 
 import (
+	"github.com/liaoyudong2/GateServer/metrics"
 	"github.com/liaoyudong2/GateServer/net/iface"
-	"github.com/liaoyudong2/GateServer/zlog"
 	"sync"
 )
 
@@ -26,21 +26,31 @@ func (s *SessionMgr) GetSessionCount() int {
 
 func (s *SessionMgr) AddSession(session iface.ISession) {
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	_, repeated := s.sessions[session.GetSessionId()]
+	s.sessions[session.GetSessionId()] = session
+	count := len(s.sessions)
+	s.lock.Unlock()
 
-	if session, ok := s.sessions[session.GetSessionId()]; ok {
-		zlog.Errorf("add session error: repeated session id: %v", session.GetSessionId())
+	// 日志和指标在锁外处理, 缩短持锁时间
+	if repeated {
+		sessionLog.Errorf("add session error: repeated session id: %v", session.GetSessionId())
+	} else {
+		metrics.SessionOpened()
 	}
-	s.sessions[session.GetSessionId()] = session
-	zlog.Infof("session manager: [ADD] count:%d", len(s.sessions))
+	sessionLog.Infof("session manager: [ADD] count:%d", count)
 }
 
 func (s *SessionMgr) RemoveSession(sessionId uint32) {
 	s.lock.Lock()
-	defer s.lock.Unlock()
-
+	_, ok := s.sessions[sessionId]
 	delete(s.sessions, sessionId)
-	zlog.Infof("session manager: [REMOVE] count:%d", len(s.sessions))
+	count := len(s.sessions)
+	s.lock.Unlock()
+
+	if ok {
+		metrics.SessionClosed()
+	}
+	sessionLog.Infof("session manager: [REMOVE] count:%d", count)
 }
 
 func (s *SessionMgr) GetSession(sessionId uint32) iface.ISession {
@@ -53,8 +63,33 @@ func (s *SessionMgr) GetSession(sessionId uint32) iface.ISession {
 	return nil
 }
 
-func (s *SessionMgr) CleanSession() {
+func (s *SessionMgr) GetSessions() []iface.ISession {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	sessions := make([]iface.ISession, 0, len(s.sessions))
 	for _, session := range s.sessions {
-		session.Close()
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// Range
+//
+//	@Description: 遍历会话快照, 回调在锁外执行
+//	@receiver s
+//	@param f 回调, 返回false时停止
+func (s *SessionMgr) Range(f func(session iface.ISession) bool) {
+	for _, session := range s.GetSessions() {
+		if !f(session) {
+			return
+		}
 	}
 }
+
+func (s *SessionMgr) CleanSession() {
+	s.Range(func(session iface.ISession) bool {
+		session.Close()
+		return true
+	})
+}
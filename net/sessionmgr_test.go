@@ -0,0 +1,172 @@
+package net_test
+
+import (
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeSession 只实现会话管理用到的方法
+type fakeSession struct {
+	iface.ISession
+	sessionId uint32
+	mgr       iface.ISessionMgr
+}
+
+func (s *fakeSession) GetSessionId() uint32 {
+	return s.sessionId
+}
+
+func (s *fakeSession) Close() {
+	s.mgr.RemoveSession(s.sessionId)
+}
+
+// sessionMgrs 对比的会话管理实现
+var sessionMgrs = []struct {
+	name string
+	new  func(maxSession int) iface.ISessionMgr
+}{
+	{"single", gatenet.NewSessionMgr},
+	{"sharded", func(maxSession int) iface.ISessionMgr {
+		return gatenet.NewShardedSessionMgr(maxSession, gatenet.DefaultSessionShards)
+	}},
+}
+
+func fill(mgr iface.ISessionMgr, count int) {
+	for i := 1; i <= count; i++ {
+		mgr.AddSession(&fakeSession{sessionId: uint32(i), mgr: mgr})
+	}
+}
+
+func TestShardedSessionMgr(t *testing.T) {
+	mgr := gatenet.NewShardedSessionMgr(1000, 10)
+	fill(mgr, 1000)
+	mgr.AddSession(&fakeSession{sessionId: 1, mgr: mgr})
+	if n := mgr.GetSessionCount(); n != 1000 {
+		t.Fatalf("%d sessions, want 1000", n)
+	}
+	if session := mgr.GetSession(500); session == nil || session.GetSessionId() != 500 {
+		t.Fatalf("get session 500: %v", session)
+	}
+	if mgr.GetSession(1001) != nil {
+		t.Fatal("got undefined session")
+	}
+	if n := len(mgr.GetSessions()); n != 1000 {
+		t.Fatalf("%d sessions in snapshot, want 1000", n)
+	}
+
+	visited := 0
+	mgr.Range(func(session iface.ISession) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Fatalf("range visited %d after stop, want 10", visited)
+	}
+
+	// 遍历中关闭会话不会死锁
+	mgr.Range(func(session iface.ISession) bool {
+		if session.GetSessionId()%2 == 0 {
+			session.Close()
+		}
+		return true
+	})
+	mgr.RemoveSession(2)
+	if n := mgr.GetSessionCount(); n != 500 {
+		t.Fatalf("%d sessions after remove, want 500", n)
+	}
+	mgr.CleanSession()
+	if n := mgr.GetSessionCount(); n != 0 {
+		t.Fatalf("%d sessions after clean, want 0", n)
+	}
+}
+
+// quietSessionLog 基准测试只比较锁竞争, 关闭会话模块的日志输出
+func quietSessionLog(b *testing.B) {
+	zlog.SetModuleLevel("session", zlog.LogError)
+	b.Cleanup(func() { zlog.SetModuleLevel("session", zlog.LevelInherit) })
+}
+
+// BenchmarkSessionMgrChurn 并发上下线, 每次操作加入并移除一个会话
+func BenchmarkSessionMgrChurn(b *testing.B) {
+	quietSessionLog(b)
+	for _, impl := range sessionMgrs {
+		b.Run(impl.name, func(b *testing.B) {
+			mgr := impl.new(50000)
+			fill(mgr, 50000)
+			var next atomic.Uint32
+			next.Store(50000)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					sessionId := next.Add(1)
+					mgr.AddSession(&fakeSession{sessionId: sessionId, mgr: mgr})
+					mgr.RemoveSession(sessionId)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSessionMgrMixed 并发查找为主, 每16次操作有一次上下线, 模拟后端消息路由
+func BenchmarkSessionMgrMixed(b *testing.B) {
+	quietSessionLog(b)
+	for _, impl := range sessionMgrs {
+		b.Run(impl.name, func(b *testing.B) {
+			mgr := impl.new(50000)
+			fill(mgr, 50000)
+			var next atomic.Uint32
+			next.Store(50000)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := uint32(0); pb.Next(); i++ {
+					if i%16 == 0 {
+						sessionId := next.Add(1)
+						mgr.AddSession(&fakeSession{sessionId: sessionId, mgr: mgr})
+						mgr.RemoveSession(sessionId)
+					} else {
+						mgr.GetSession(i%50000 + 1)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSessionMgrRange 广播遍历, 同时有其它协程上下线
+func BenchmarkSessionMgrRange(b *testing.B) {
+	quietSessionLog(b)
+	for _, impl := range sessionMgrs {
+		for _, count := range []int{1000, 50000} {
+			b.Run(impl.name+"/"+strconv.Itoa(count), func(b *testing.B) {
+				mgr := impl.new(count)
+				fill(mgr, count)
+				stop := make(chan bool)
+				defer close(stop)
+				go func() {
+					for sessionId := uint32(count + 1); ; sessionId++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						mgr.AddSession(&fakeSession{sessionId: sessionId, mgr: mgr})
+						mgr.RemoveSession(sessionId)
+					}
+				}()
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						mgr.Range(func(session iface.ISession) bool {
+							return true
+						})
+					}
+				})
+			})
+		}
+	}
+}
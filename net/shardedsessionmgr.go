@@ -0,0 +1,139 @@
+package net
+
+import (
+	"github.com/liaoyudong2/GateServer/metrics"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSessionShards 默认分片数
+const DefaultSessionShards = 64
+
+// sessionShard
+// @Description: 会话分片, 独立加锁
+type sessionShard struct {
+	lock     sync.RWMutex
+	sessions map[uint32]iface.ISession
+}
+
+// ShardedSessionMgr
+// @Description: 按会话ID分片的会话管理, 每个分片独立加锁, 减少大量连接和频繁上下线时的锁竞争
+type ShardedSessionMgr struct {
+	shards []sessionShard // 分片, 数量为2的幂
+	mask   uint32         // 分片掩码
+	count  atomic.Int64   // 会话数量
+}
+
+// NewShardedSessionMgr
+//
+//	@Description: 创建分片会话管理
+//	@param maxSession 最大会话数, 用于预分配
+//	@param shards 分片数, 向上取整为2的幂, 不大于0时使用DefaultSessionShards
+//	@return iface.ISessionMgr
+func NewShardedSessionMgr(maxSession int, shards int) iface.ISessionMgr {
+	if shards <= 0 {
+		shards = DefaultSessionShards
+	}
+	size := 1
+	for size < shards {
+		size <<= 1
+	}
+	m := &ShardedSessionMgr{
+		shards: make([]sessionShard, size),
+		mask:   uint32(size - 1),
+	}
+	for i := range m.shards {
+		m.shards[i].sessions = make(map[uint32]iface.ISession, maxSession/size)
+	}
+	return m
+}
+
+func (m *ShardedSessionMgr) shard(sessionId uint32) *sessionShard {
+	return &m.shards[sessionId&m.mask]
+}
+
+func (m *ShardedSessionMgr) GetSessionCount() int {
+	return int(m.count.Load())
+}
+
+func (m *ShardedSessionMgr) AddSession(session iface.ISession) {
+	shard := m.shard(session.GetSessionId())
+	shard.lock.Lock()
+	_, repeated := shard.sessions[session.GetSessionId()]
+	shard.sessions[session.GetSessionId()] = session
+	shard.lock.Unlock()
+
+	if repeated {
+		sessionLog.Errorf("add session error: repeated session id: %v", session.GetSessionId())
+		return
+	}
+	metrics.SessionOpened()
+	sessionLog.Debugf("session manager: [ADD] count:%d", m.count.Add(1))
+}
+
+func (m *ShardedSessionMgr) RemoveSession(sessionId uint32) {
+	shard := m.shard(sessionId)
+	shard.lock.Lock()
+	_, ok := shard.sessions[sessionId]
+	delete(shard.sessions, sessionId)
+	shard.lock.Unlock()
+
+	if !ok {
+		return
+	}
+	metrics.SessionClosed()
+	sessionLog.Debugf("session manager: [REMOVE] count:%d", m.count.Add(-1))
+}
+
+func (m *ShardedSessionMgr) GetSession(sessionId uint32) iface.ISession {
+	shard := m.shard(sessionId)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+
+	return shard.sessions[sessionId]
+}
+
+func (m *ShardedSessionMgr) GetSessions() []iface.ISession {
+	sessions := make([]iface.ISession, 0, m.GetSessionCount())
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.lock.RLock()
+		for _, session := range shard.sessions {
+			sessions = append(sessions, session)
+		}
+		shard.lock.RUnlock()
+	}
+	return sessions
+}
+
+// Range
+//
+//	@Description: 逐个分片遍历, 每次只复制一个分片的快照, 回调在锁外执行.
+//	遍历期间加入或移除的会话可能不被访问
+//	@receiver m
+//	@param f 回调, 返回false时停止
+func (m *ShardedSessionMgr) Range(f func(session iface.ISession) bool) {
+	var batch []iface.ISession
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.lock.RLock()
+		batch = batch[:0]
+		for _, session := range shard.sessions {
+			batch = append(batch, session)
+		}
+		shard.lock.RUnlock()
+		for _, session := range batch {
+			if !f(session) {
+				return
+			}
+		}
+	}
+}
+
+func (m *ShardedSessionMgr) CleanSession() {
+	m.Range(func(session iface.ISession) bool {
+		session.Close()
+		return true
+	})
+}
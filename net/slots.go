@@ -0,0 +1,93 @@
+package net
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRetryAfter 会话已满时默认建议客户端重试的间隔
+const DefaultRetryAfter = 5 * time.Second
+
+// SessionSlots
+// @Description: 会话名额, 握手前原子地占用, 会话关闭或接入失败时归还, 保证会话数不超过上限.
+// 已满时websocket默认返回HTTP 503和Retry-After; 开启Upgrade时完成握手后发送codec.MsgIdOverflow,
+// 再以关闭码1013(Try Again Later)关闭. tcp连接总是发送codec.MsgIdOverflow后关闭
+type SessionSlots struct {
+	used       atomic.Int64 // 已占用名额
+	max        atomic.Int64 // 最大会话数
+	retryAfter atomic.Int64 // 建议客户端重试的间隔
+	upgrade    atomic.Bool  // 已满时是否仍完成websocket握手
+}
+
+// Acquire
+//
+//	@Description: 占用一个名额
+//	@receiver s
+//	@return bool 已满时返回false
+func (s *SessionSlots) Acquire() bool {
+	for {
+		used := s.used.Load()
+		if used >= s.max.Load() {
+			return false
+		}
+		if s.used.CompareAndSwap(used, used+1) {
+			return true
+		}
+	}
+}
+
+// Release
+//
+//	@Description: 归还一个名额
+//	@receiver s
+func (s *SessionSlots) Release() {
+	s.used.Add(-1)
+}
+
+func (s *SessionSlots) Used() int {
+	return int(s.used.Load())
+}
+
+// SetMax
+//
+//	@Description: 修改最大会话数, 调低时已有会话不受影响, 之后的连接等名额归还后才能接入
+//	@receiver s
+//	@param max 最大会话数
+func (s *SessionSlots) SetMax(max int) {
+	s.max.Store(int64(max))
+}
+
+func (s *SessionSlots) GetMax() int {
+	return int(s.max.Load())
+}
+
+// SetOverflow
+//
+//	@Description: 修改已满时的处理
+//	@receiver s
+//	@param retryAfter 建议客户端重试的间隔, 不大于0时使用DefaultRetryAfter
+//	@param upgrade websocket是否完成握手后再以关闭码通知
+func (s *SessionSlots) SetOverflow(retryAfter time.Duration, upgrade bool) {
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+	s.retryAfter.Store(int64(retryAfter))
+	s.upgrade.Store(upgrade)
+}
+
+// RetryAfter
+//
+//	@Description: 建议客户端重试的秒数, 至少为1
+//	@receiver s
+//	@return int
+func (s *SessionSlots) RetryAfter() int {
+	seconds := int((time.Duration(s.retryAfter.Load()) + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return int(DefaultRetryAfter / time.Second)
+	}
+	return seconds
+}
+
+func (s *SessionSlots) IsUpgrade() bool {
+	return s.upgrade.Load()
+}
@@ -0,0 +1,81 @@
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"math/rand"
+	"sync/atomic"
+)
+
+// TraceContextLen 追踪上下文消息内容长度
+const TraceContextLen = 12
+
+// Tracing
+// @Description: 追踪设置, 由网关服务持有, 所有会话共享, 可在运行中修改
+type Tracing struct {
+	requestId atomic.Bool // 是否为每条转发消息生成请求ID
+}
+
+// SetRequestId
+//
+//	@Description: 开启后每条转发消息前都发送追踪上下文(带请求ID), 否则每个会话对每个后端连接只发送一次(迁移到其他实例或后端重连后重新发送)
+//	@receiver t
+//	@param enabled 是否开启
+func (t *Tracing) SetRequestId(enabled bool) {
+	t.requestId.Store(enabled)
+}
+
+func (t *Tracing) RequestId() bool {
+	return t.requestId.Load()
+}
+
+// NewTraceId
+//
+//	@Description: 生成会话追踪ID(非0随机数)
+//	@return uint64
+func NewTraceId() uint64 {
+	for {
+		if id := rand.Uint64(); id != 0 {
+			return id
+		}
+	}
+}
+
+// FormatTraceId
+//
+//	@Description: 追踪ID的文本形式(16位十六进制), 日志和管理接口中使用
+//	@param traceId 追踪ID
+//	@return string
+func FormatTraceId(traceId uint64) string {
+	return fmt.Sprintf("%016x", traceId)
+}
+
+// NewTraceContext
+//
+//	@Description: 创建发往后端的追踪上下文消息, 描述同一会话随后转发的消息
+//	@param sessionId 会话ID
+//	@param traceId 追踪ID
+//	@param requestId 请求ID, 未开启请求ID时为0
+//	@return iface.IMessage
+func NewTraceContext(sessionId uint32, traceId uint64, requestId uint32) iface.IMessage {
+	data := make([]byte, TraceContextLen)
+	binary.BigEndian.PutUint64(data, traceId)
+	binary.BigEndian.PutUint32(data[8:], requestId)
+	return codec.NewMessage(codec.MsgIdTraceContext, sessionId, data)
+}
+
+// ParseTraceContext
+//
+//	@Description: 解析追踪上下文消息内容, 供后端使用
+//	@param data 消息内容
+//	@return traceId 追踪ID
+//	@return requestId 请求ID
+//	@return ok 长度是否正确
+func ParseTraceContext(data []byte) (traceId uint64, requestId uint32, ok bool) {
+	if len(data) != TraceContextLen {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint64(data), binary.BigEndian.Uint32(data[8:]), true
+}
@@ -0,0 +1,204 @@
+package net_test
+
+import (
+	"github.com/liaoyudong2/GateServer/client"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/fakebackend"
+	"github.com/liaoyudong2/GateServer/gatetest"
+	gatenet "github.com/liaoyudong2/GateServer/net"
+	"github.com/liaoyudong2/GateServer/net/iface"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTraceContext(t *testing.T) {
+	msg := gatenet.NewTraceContext(7, 0x0102030405060708, 9)
+	if msg.GetMsgId() != codec.MsgIdTraceContext || msg.GetReserve() != 7 || msg.GetMsgLen() != gatenet.TraceContextLen {
+		t.Fatalf("trace context msgId %d session %d len %d", msg.GetMsgId(), msg.GetReserve(), msg.GetMsgLen())
+	}
+	traceId, requestId, ok := gatenet.ParseTraceContext(msg.GetMsgData())
+	if !ok || traceId != 0x0102030405060708 || requestId != 9 {
+		t.Fatalf("parsed %x %d %v", traceId, requestId, ok)
+	}
+	for _, data := range [][]byte{nil, make([]byte, gatenet.TraceContextLen-1), make([]byte, gatenet.TraceContextLen+1)} {
+		if _, _, ok = gatenet.ParseTraceContext(data); ok {
+			t.Fatalf("parsed %d bytes", len(data))
+		}
+	}
+
+	if got := gatenet.FormatTraceId(0xabc); got != "0000000000000abc" {
+		t.Fatalf("FormatTraceId %q", got)
+	}
+	if gatenet.NewTraceId() == 0 {
+		t.Fatal("zero trace id")
+	}
+}
+
+func TestBridgeServiceTrace(t *testing.T) {
+	capture, stop := zlog.StartCapture()
+	defer stop()
+	gate := gatetest.Start(t)
+	clients := []*client.Client{gate.Dial(client.Config{}), gate.Dial(client.Config{Addr: gate.TCPURL()})}
+	gate.WaitSessions(2)
+
+	// send 发送一条消息, 返回后端收到的请求
+	send := func(c *client.Client, msgId uint16) *fakebackend.Request {
+		t.Helper()
+		gate.Backend.Reset()
+		if err := c.Send(msgId, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		req, err := gate.Backend.WaitMsg(msgId, gatetest.DefaultTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	// 后端收到的追踪ID与会话一致, 不同会话不同, 未开启请求ID时为0
+	traces := map[uint64]bool{}
+	for _, c := range clients {
+		req := send(c, 100)
+		traceId := gate.Session(req.SessionId).GetTraceId()
+		if gatenet.FormatTraceId(req.TraceId) != traceId || req.RequestId != 0 {
+			t.Fatalf("backend trace %x req %d, session trace %s", req.TraceId, req.RequestId, traceId)
+		}
+		traces[req.TraceId] = true
+
+		// 会话的日志带会话ID和追踪ID
+		var found bool
+		for _, e := range capture.Entries() {
+			session, _ := e.Field("session")
+			trace, _ := e.Field("trace")
+			if session == req.SessionId && trace == traceId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("no log line with session %d trace %s", req.SessionId, traceId)
+		}
+	}
+	if len(traces) != 2 {
+		t.Fatal("sessions share a trace id")
+	}
+
+	// 开启请求ID后对已有会话生效, 每条转发消息递增
+	gate.Service.SetRequestId(true)
+	for want := uint32(1); want <= 3; want++ {
+		req := send(clients[0], 101)
+		if req.RequestId != want || gatenet.FormatTraceId(req.TraceId) != gate.Session(req.SessionId).GetTraceId() {
+			t.Fatalf("request id %d trace %x, want %d", req.RequestId, req.TraceId, want)
+		}
+	}
+	if req := send(clients[1], 101); req.RequestId != 1 {
+		t.Fatalf("second session request id %d, want 1", req.RequestId)
+	}
+}
+
+// traceBackend 记录收到的消息ID, 可修改连接序号模拟重连, 拒绝refuseMsgId
+type traceBackend struct {
+	iface.IBackend
+	id       string
+	connId   atomic.Uint64
+	received chan uint16
+}
+
+func newTraceBackend(id string) *traceBackend {
+	return &traceBackend{id: id, received: make(chan uint16, 16)}
+}
+
+// refuseMsgId 后端拒绝的消息ID, 模拟写队列已满
+const refuseMsgId = 101
+
+func (b *traceBackend) GetId() string {
+	return b.id
+}
+
+func (b *traceBackend) GetConnId() uint64 {
+	return b.connId.Load()
+}
+
+func (b *traceBackend) Forward(msg iface.IMessage) bool {
+	if msg.GetMsgId() == refuseMsgId {
+		return false
+	}
+	b.received <- msg.GetMsgId()
+	codec.Release(msg)
+	return true
+}
+
+// traceBackendMgr 全部消息转发到当前选中的后端
+type traceBackendMgr struct {
+	iface.IBackendMgr
+	picked atomic.Pointer[traceBackend]
+}
+
+func (m *traceBackendMgr) Route(msgId uint16) string {
+	return gatenet.DefaultBackendService
+}
+
+func (m *traceBackendMgr) Pick(service string, sessionId uint32) (iface.IBackend, error) {
+	return m.picked.Load(), nil
+}
+
+// expectForward 发送一条消息, 后端依次收到want
+func expectForward(t *testing.T, conn *fakeConn, backend *traceBackend, msgId uint16, want ...uint16) {
+	t.Helper()
+	conn.reads <- codec.NewStream().Marshal(codec.NewMessage(msgId, 0, nil))
+	var got []uint16
+	for len(got) < len(want) {
+		select {
+		case id := <-backend.received:
+			got = append(got, id)
+		case <-time.After(gatetest.DefaultTimeout):
+			t.Fatalf("backend %s received %v, want %v", backend.id, got, want)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("backend %s received %v, want %v", backend.id, got, want)
+	}
+}
+
+func TestSessionTraceBackendChange(t *testing.T) {
+	capture, stop := zlog.StartCapture()
+	defer stop()
+	options := &gatenet.SessionOptions{}
+	a, b := newTraceBackend("a"), newTraceBackend("b")
+	backendMgr := &traceBackendMgr{}
+	backendMgr.picked.Store(a)
+	conn := newFakeConn()
+	gatenet.NewSession(1, conn, gatenet.NewSessionMgr(0), backendMgr, options)
+	defer conn.Close()
+
+	// 每个后端连接首次转发前发送追踪上下文
+	expectForward(t, conn, a, 100, codec.MsgIdTraceContext, 100)
+	expectForward(t, conn, a, 100, 100)
+
+	// 后端重连后重新发送
+	a.connId.Add(1)
+	expectForward(t, conn, a, 100, codec.MsgIdTraceContext, 100)
+
+	// 会话迁移到其他实例后重新发送
+	backendMgr.picked.Store(b)
+	expectForward(t, conn, b, 100, codec.MsgIdTraceContext, 100)
+	expectForward(t, conn, b, 100, 100)
+
+	// 开启请求ID后转发期间的日志带请求ID
+	options.Tracing.SetRequestId(true)
+	expectForward(t, conn, b, 100, codec.MsgIdTraceContext, 100)
+	expectForward(t, conn, b, refuseMsgId, codec.MsgIdTraceContext)
+	entry := capture.Find(zlog.LogError, "session forward error")
+	if entry == nil {
+		t.Fatalf("no forward error in log: %q", capture.Messages())
+	}
+	if req, _ := entry.Field("req"); req != uint32(2) {
+		t.Fatalf("forward error logged with req %v, want 2", req)
+	}
+	if len(a.received) != 0 || len(b.received) != 0 {
+		t.Fatalf("unexpected messages: a %d, b %d", len(a.received), len(b.received))
+	}
+}
@@ -0,0 +1,256 @@
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// 文件格式(大端):
+//
+//	文件头: magic "GREC"(4) + version(2) + sessionId(4) + traceId(8) + startTime(8, unix纳秒)
+//	帧:     offset(8, 距startTime纳秒) + dir(1) + msgId(2) + len(4) + payload(len)
+const (
+	Magic       = "GREC"
+	Version     = 1
+	HeaderSize  = 26
+	FrameHeader = 15
+	MaxPayload  = 64 << 20 // 单帧最大长度, 超过时视为文件损坏
+)
+
+// 帧方向
+const (
+	DirIn  = 0 // 客户端 -> 网关
+	DirOut = 1 // 网关 -> 客户端
+)
+
+// ErrBadMagic 不是录制文件
+var ErrBadMagic = errors.New("record: bad magic")
+
+// Header
+// @Description: 录制文件头
+type Header struct {
+	SessionId uint32    // 会话ID
+	TraceId   uint64    // 追踪ID
+	StartTime time.Time // 开始录制时间
+}
+
+// Frame
+// @Description: 一帧录制数据
+type Frame struct {
+	Time  time.Time // 时间
+	Dir   uint8     // 方向(DirIn/DirOut)
+	MsgId uint16    // 消息ID
+	Data  []byte    // 消息内容
+}
+
+// DirName
+//
+//	@Description: 方向的文本形式
+//	@param dir 方向
+//	@return string
+func DirName(dir uint8) string {
+	switch dir {
+	case DirIn:
+		return "in"
+	case DirOut:
+		return "out"
+	}
+	return fmt.Sprintf("dir(%d)", dir)
+}
+
+// Writer
+// @Description: 录制写入, 并发安全, 每帧写完即落地到输出, 网关崩溃时不丢失已写入的帧
+type Writer struct {
+	lock   sync.Mutex    // 保护写入
+	out    io.Writer     // 输出
+	buf    *bufio.Writer // 写缓冲
+	start  time.Time     // 开始时间
+	closer io.Closer     // 关闭输出, 可以为空
+	frames uint64        // 已写入帧数
+	err    error         // 首个写入错误, 之后的写入直接返回
+}
+
+// NewWriter
+//
+//	@Description: 创建录制写入并写入文件头, 文件头立即落地, out实现io.Closer时Close一并关闭
+//	@param out 输出
+//	@param header 文件头, StartTime为零值时使用当前时间
+//	@return *Writer
+//	@return error
+func NewWriter(out io.Writer, header Header) (*Writer, error) {
+	if header.StartTime.IsZero() {
+		header.StartTime = time.Now()
+	}
+	w := &Writer{
+		out:   out,
+		buf:   bufio.NewWriter(out),
+		start: header.StartTime,
+	}
+	if closer, ok := out.(io.Closer); ok {
+		w.closer = closer
+	}
+	head := make([]byte, HeaderSize)
+	copy(head, Magic)
+	binary.BigEndian.PutUint16(head[4:], Version)
+	binary.BigEndian.PutUint32(head[6:], header.SessionId)
+	binary.BigEndian.PutUint64(head[10:], header.TraceId)
+	binary.BigEndian.PutUint64(head[18:], uint64(header.StartTime.UnixNano()))
+	if _, err := w.buf.Write(head); err != nil {
+		return nil, err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write
+//
+//	@Description: 写入一帧
+//	@receiver w
+//	@param dir 方向
+//	@param msgId 消息ID
+//	@param data 消息内容
+//	@return error
+func (w *Writer) Write(dir uint8, msgId uint16, data []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	var head [FrameHeader]byte
+	binary.BigEndian.PutUint64(head[0:], uint64(time.Since(w.start)))
+	head[8] = dir
+	binary.BigEndian.PutUint16(head[9:], msgId)
+	binary.BigEndian.PutUint32(head[11:], uint32(len(data)))
+	if _, w.err = w.buf.Write(head[:]); w.err != nil {
+		return w.err
+	}
+	if _, w.err = w.buf.Write(data); w.err != nil {
+		return w.err
+	}
+	// 帧头和内容合并为一次写入
+	if w.err = w.buf.Flush(); w.err != nil {
+		return w.err
+	}
+	w.frames++
+	return nil
+}
+
+// Frames
+//
+//	@Description: 已写入帧数
+//	@receiver w
+//	@return uint64
+func (w *Writer) Frames() uint64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.frames
+}
+
+// Flush
+//
+//	@Description: 落地写缓冲
+//	@receiver w
+//	@return error
+func (w *Writer) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.buf.Flush()
+}
+
+// Close
+//
+//	@Description: 落地写缓冲并关闭输出
+//	@receiver w
+//	@return error
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	err := w.buf.Flush()
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if w.err == nil {
+		w.err = io.ErrClosedPipe
+	}
+	return err
+}
+
+// Reader
+// @Description: 录制读取
+type Reader struct {
+	in     *bufio.Reader // 输入
+	header Header        // 文件头
+}
+
+// NewReader
+//
+//	@Description: 创建录制读取并解析文件头
+//	@param in 输入
+//	@return *Reader
+//	@return error
+func NewReader(in io.Reader) (*Reader, error) {
+	r := &Reader{in: bufio.NewReader(in)}
+	head := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r.in, head); err != nil {
+		return nil, err
+	}
+	if string(head[:4]) != Magic {
+		return nil, ErrBadMagic
+	}
+	if version := binary.BigEndian.Uint16(head[4:]); version != Version {
+		return nil, fmt.Errorf("record: unsupported version %d", version)
+	}
+	r.header = Header{
+		SessionId: binary.BigEndian.Uint32(head[6:]),
+		TraceId:   binary.BigEndian.Uint64(head[10:]),
+		StartTime: time.Unix(0, int64(binary.BigEndian.Uint64(head[18:]))),
+	}
+	return r, nil
+}
+
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next
+//
+//	@Description: 读取下一帧, 读完时返回io.EOF
+//	@receiver r
+//	@return *Frame
+//	@return error
+func (r *Reader) Next() (*Frame, error) {
+	var head [FrameHeader]byte
+	if _, err := io.ReadFull(r.in, head[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("record: truncated frame header")
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(head[11:])
+	if size > MaxPayload {
+		return nil, fmt.Errorf("record: frame too large: %d", size)
+	}
+	frame := &Frame{
+		Time:  r.header.StartTime.Add(time.Duration(binary.BigEndian.Uint64(head[0:]))),
+		Dir:   head[8],
+		MsgId: binary.BigEndian.Uint16(head[9:]),
+		Data:  make([]byte, size),
+	}
+	if _, err := io.ReadFull(r.in, frame.Data); err != nil {
+		return nil, fmt.Errorf("record: truncated frame: %w", err)
+	}
+	return frame, nil
+}
@@ -1,52 +1,351 @@
 package utils
 
 import (
-	"encoding/json"
+	"fmt"
 	"github.com/liaoyudong2/GateServer/zlog"
 	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const LoggerPath = "log/GateServer"
 
+// configLog 配置模块日志
+var configLog = zlog.Module("config")
+
+// DefaultEpochFile 默认的会话ID重启纪元文件, 按ServerId区分, 同一目录下的多个网关互不影响
+const DefaultEpochFile = "data/GateServer-%d.epoch"
+
+// DefaultConfigPath 默认配置文件路径
+const DefaultConfigPath = "config/SrvCfg.json"
+
+// ConfigPath 当前配置文件路径, 由 Init 设置
+var ConfigPath = DefaultConfigPath
+
 // GateSSLConfig 网关的ssl配置
 type GateSSLConfig struct {
-	Open   bool
-	Cert   string
-	PKey   string
-	Passwd string
+	Open   bool   // 是否开启
+	Cert   string // 证书文件
+	PKey   string // 私钥文件
+	Passwd string // 私钥密码
+}
+
+// GateQueueConfig 登录排队配置, 会话已满时新连接排队等待名额(可热更新)
+type GateQueueConfig struct {
+	Open      bool     // 是否开启, 关闭时会话已满直接拒绝
+	MaxLength int      // 最大排队数, 0为不限制
+	Interval  int      // 排名通知间隔(毫秒), 0为默认1000
+	VipTokens []string // VIP令牌, 连接时通过参数queue_token或请求头X-Queue-Token携带, 优先晋升
 }
 
 // GateConfig 网管配置
 type GateConfig struct {
 	UseSSL         GateSSLConfig
-	BindClientPort int
-	BindSrvAddr    string
+	BindClientPort int    // 客户端端口(加上ServerId)
+	BindTCPPort    int    // 客户端tcp端口(加上ServerId), 为0时不开启
+	BindSrvAddr    string // 服务器间通信地址
+	MaxSession     int    // 最大会话数量(可热更新)
+	RetryAfter     int    // 会话已满时建议客户端重试的秒数, 为0时使用默认值(可热更新)
+	OverflowClose  bool   // 会话已满时websocket仍完成握手, 发送溢出消息后以关闭码1013关闭, 否则返回HTTP 503(可热更新)
+	Queue          GateQueueConfig
+	AdminPort      int      // 管理端口(加上ServerId), 为0时不开启
+	AdminToken     string   // 管理接口访问令牌
+	RequestId      bool     // 为每条转发消息生成请求ID, 随追踪上下文发往后端(可热更新)
+	CrashDumpDir   string   // 会话panic时写入崩溃转储的目录, 为空时不写(可热更新)
+	RecordDir      string   // 流量录制目录(可热更新)
+	RecordUsers    []string // 需要录制流量的用户ID, 也可通过管理接口按会话或用户开启(可热更新)
+	Echo           bool     // 回显MsgIdEcho消息, 供gatebench压测网关本身(可热更新)
+	EpochFile      string   // 保存会话ID重启纪元的文件, 为空时按ServerId使用data/GateServer-<ServerId>.epoch
 }
 
+// GameConfig 游戏服配置
 type GameConfig struct {
 	BindSrvAddr string
 }
 
+// WorldConfig 世界服配置
+type WorldConfig struct {
+	WorldSrvId  int
+	BindSrvAddr string
+}
+
+// DBConfig 数据服配置
+type DBConfig struct {
+	BindSrvAddr string
+}
+
+// RedisConfig redis连接配置
+type RedisConfig struct {
+	BindSrvAddr string
+}
+
+// MySQLDBConfig 单个mysql库配置
+type MySQLDBConfig struct {
+	Ip     string
+	Port   int
+	User   string
+	PassWd string
+	DBName string
+}
+
+// MySQLConfig mysql连接配置
+type MySQLConfig struct {
+	SrvDB   MySQLDBConfig
+	LoginDB MySQLDBConfig
+	LogDB   MySQLDBConfig
+	WorldDB MySQLDBConfig
+}
+
+// DiscoveryConfig 服务发现配置
+type DiscoveryConfig struct {
+	Provider string // 提供者(static/file), 为空时使用各服务的BindSrvAddr
+	Path     string // 注册表路径
+	Interval int    // 检查间隔(毫秒)
+}
+
+// RateLimitConfig 单个会话的消息频率限制, MsgPerSecond为0时不限制
+type RateLimitConfig struct {
+	MsgPerSecond int // 每秒消息数
+	Burst        int // 突发上限
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level      string            // 日志级别(debug/info/warn/error), 为空时由DebugMode决定
+	Modules    map[string]string // 模块日志级别(net/session/codec/config...), 覆盖全局级别
+	Path       string            // 日志目录
+	Encoder    string            // 输出格式(text/json), 默认text
+	MaxSize    int               // 单个文件最大MB, 0为不按大小拆分
+	MaxAge     int               // 保留天数, 0为不限制
+	MaxBackups int               // 保留的历史文件数量, 0为不限制
+	Compress   bool              // 是否压缩历史文件
+	Async      bool              // 异步写入
+	AsyncSize  int               // 异步缓冲行数
+	AsyncDrop  bool              // 缓冲满时丢弃(否则阻塞)
+	Sinks      []LogSinkConfig   // 额外输出, 默认的文件和控制台输出之外
+	Sampling   LogSamplingConfig // 采样, 防止热点日志刷屏
+}
+
+// LogSamplingConfig 日志采样配置, First为0时不采样
+type LogSamplingConfig struct {
+	By         string // 分组方式(caller/template), 默认caller
+	Interval   int    // 采样周期(毫秒), 默认1000
+	First      int    // 每个分组每个周期先输出的条数
+	Thereafter int    // 之后每N条输出1条, 0为全部抑制
+	Summary    int    // 抑制汇总的输出间隔(毫秒), 默认10000
+}
+
+// LogSinkConfig 额外的日志输出
+type LogSinkConfig struct {
+	Type    string // 输出类型(file/stdout/stderr/syslog)
+	Level   string // 最低级别, 为空时只受全局和模块级别限制
+	Encoder string // 输出格式(text/json), 为空时沿用Log.Encoder
+	Path    string // file: 日志目录(沿用Log的拆分配置); syslog: unix socket路径, 为空时自动查找
+	Tag     string // syslog: 程序标识, 为空时使用进程名
+}
+
+// RouteConfig 按消息ID区间转发到指定服务
+type RouteConfig struct {
+	MsgIdMin uint16 // 起始消息ID(包含)
+	MsgIdMax uint16 // 结束消息ID(包含)
+	Service  string // 服务名
+}
+
 type ServerConfig struct {
-	GateSrv  GateConfig
-	ServerId int
+	DebugMode    bool
+	ServerId     int
+	GateSrv      GateConfig
+	GameSrv      GameConfig
+	WorldSrv     WorldConfig
+	DBSrv        DBConfig
+	RedisConnect RedisConfig
+	MySQLConnect MySQLConfig
+	Discovery    DiscoveryConfig
+	RateLimit    RateLimitConfig
+	Log          LogConfig
+	Routes       []RouteConfig
 }
 
-var GlobalConfig *ServerConfig
+// DefaultConfig
+//
+//	@Description: 默认配置, 配置文件和环境变量在此基础上覆盖
+//	@return *ServerConfig
+func DefaultConfig() *ServerConfig {
+	return &ServerConfig{
+		GateSrv: GateConfig{
+			BindClientPort: 9010,
+			BindSrvAddr:    "127.0.0.1:8010",
+			MaxSession:     4096,
+		},
+		GameSrv:      GameConfig{BindSrvAddr: "127.0.0.1:7010"},
+		WorldSrv:     WorldConfig{WorldSrvId: 1, BindSrvAddr: "127.0.0.1:6010"},
+		DBSrv:        DBConfig{BindSrvAddr: "127.0.0.1:5010"},
+		RedisConnect: RedisConfig{BindSrvAddr: "127.0.0.1:6379"},
+		Discovery:    DiscoveryConfig{Interval: 2000},
+		Log:          LogConfig{Path: LoggerPath},
+	}
+}
+
+// LogLevel
+//
+//	@Description: 生效的日志级别
+//	@receiver g
+//	@return string
+func (g *ServerConfig) LogLevel() string {
+	if g.Log.Level != "" {
+		return g.Log.Level
+	}
+	if g.DebugMode {
+		return "debug"
+	}
+	return "info"
+}
+
+// SessionEpochFile
+//
+//	@Description: 生效的会话ID重启纪元文件
+//	@receiver g
+//	@return string
+func (g *ServerConfig) SessionEpochFile() string {
+	if g.GateSrv.EpochFile != "" {
+		return g.GateSrv.EpochFile
+	}
+	return fmt.Sprintf(DefaultEpochFile, g.ServerId)
+}
+
+// 配置分段名称, 与ServerConfig字段名一致
+const (
+	SectionDebugMode    = "DebugMode"
+	SectionServerId     = "ServerId"
+	SectionGateSrv      = "GateSrv"
+	SectionGameSrv      = "GameSrv"
+	SectionWorldSrv     = "WorldSrv"
+	SectionDBSrv        = "DBSrv"
+	SectionRedisConnect = "RedisConnect"
+	SectionMySQLConnect = "MySQLConnect"
+	SectionDiscovery    = "Discovery"
+	SectionRateLimit    = "RateLimit"
+	SectionLog          = "Log"
+	SectionRoutes       = "Routes"
+)
+
+// Subscriber 配置分段变更回调
+type Subscriber func(old, cur *ServerConfig)
+
+var (
+	globalConfig atomic.Pointer[ServerConfig] // 当前配置
+	reloadLock   sync.Mutex                   // 保证重载串行
+	subLock      sync.RWMutex                 // 订阅者锁
+	subscribers  = map[string][]Subscriber{}  // 分段 -> 订阅者
+)
+
+// GlobalConfig
+//
+//	@Description: 当前生效的配置, 重载时整体替换, 调用方不应修改返回值
+//	@return *ServerConfig
+func GlobalConfig() *ServerConfig {
+	return globalConfig.Load()
+}
 
-func (g *ServerConfig) Reload() {
-	data, err := os.ReadFile("config/SrvCfg.json")
+// Init
+//
+//	@Description: 加载配置并设为全局配置, 由main在启动时显式调用
+//	@param path 配置文件路径
+//	@return error
+func Init(path string) error {
+	cfg, err := LoadConfig(path)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	err = json.Unmarshal(data, GlobalConfig)
+	ConfigPath = path
+	globalConfig.Store(cfg)
+	return nil
+}
+
+// Subscribe
+//
+//	@Description: 订阅配置分段变更, 重载成功且该分段有变化时回调
+//	@param section 分段名称
+//	@param fn 回调
+func Subscribe(section string, fn Subscriber) {
+	subLock.Lock()
+	defer subLock.Unlock()
+
+	subscribers[section] = append(subscribers[section], fn)
+}
+
+// Reload
+//
+//	@Description: 重新加载配置, 校验失败时保留旧配置
+//	@return error
+func Reload() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	cfg, err := LoadConfig(ConfigPath)
 	if err != nil {
-		panic(err)
+		configLog.Errorf("config reload failed, keep current config: %v", err)
+		return err
 	}
+	old := globalConfig.Swap(cfg)
+	sections := changedSections(old, cfg)
+	configLog.Infof("config reloaded, changed sections: %v", sections)
+
+	subLock.RLock()
+	defer subLock.RUnlock()
+	for _, section := range sections {
+		for _, fn := range subscribers[section] {
+			fn(old, cfg)
+		}
+	}
+	return nil
+}
+
+// changedSections
+//
+//	@Description: 比较两份配置, 返回有变化的分段
+//	@param old 旧配置
+//	@param cur 新配置
+//	@return []string
+func changedSections(old, cur *ServerConfig) []string {
+	var sections []string
+	ov := reflect.ValueOf(old).Elem()
+	cv := reflect.ValueOf(cur).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		if !reflect.DeepEqual(ov.Field(i).Interface(), cv.Field(i).Interface()) {
+			sections = append(sections, cv.Type().Field(i).Name)
+		}
+	}
+	return sections
 }
 
-func init() {
-	zlog.SetLogPath(LoggerPath)
-	GlobalConfig = &ServerConfig{}
-	GlobalConfig.Reload()
+// WatchConfig
+//
+//	@Description: 轮询配置文件, 修改后自动重载
+//	@param interval 检查间隔
+//	@param exitChan 退出信号
+func WatchConfig(interval time.Duration, exitChan chan bool) {
+	var modTime time.Time
+	if info, err := os.Stat(ConfigPath); err == nil {
+		modTime = info.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exitChan:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(ConfigPath)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			configLog.Infof("config file changed: %s", ConfigPath)
+			_ = Reload()
+		}
+	}
 }
@@ -0,0 +1,95 @@
+package utils_test
+
+import (
+	"github.com/liaoyudong2/GateServer/utils"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// reloadCall 一次订阅回调
+type reloadCall struct {
+	section  string
+	old, cur *utils.ServerConfig
+}
+
+func TestReload(t *testing.T) {
+	path := writeConfig(t, `{"GateSrv": {"MaxSession": 10}, "RateLimit": {"MsgPerSecond": 5}}`)
+	if err := utils.Init(path); err != nil {
+		t.Fatal(err)
+	}
+	var calls []reloadCall
+	for _, section := range []string{utils.SectionGateSrv, utils.SectionRateLimit, utils.SectionLog} {
+		name := section
+		utils.Subscribe(name, func(old, cur *utils.ServerConfig) {
+			calls = append(calls, reloadCall{section: name, old: old, cur: cur})
+		})
+	}
+	reload := func(content string) error {
+		t.Helper()
+		calls = nil
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return utils.Reload()
+	}
+
+	// 只有变化的分段触发回调, 回调拿到重载前后的配置
+	before := utils.GlobalConfig()
+	if err := reload(`{"GateSrv": {"MaxSession": 20}, "RateLimit": {"MsgPerSecond": 5}}`); err != nil {
+		t.Fatal(err)
+	}
+	after := utils.GlobalConfig()
+	if after == before || after.GateSrv.MaxSession != 20 {
+		t.Fatalf("config not replaced: %+v", after.GateSrv)
+	}
+	if len(calls) != 1 || calls[0].section != utils.SectionGateSrv || calls[0].old != before || calls[0].cur != after {
+		t.Fatalf("unexpected subscriber calls: %+v", calls)
+	}
+	if calls[0].old.GateSrv.MaxSession != 10 || calls[0].cur.GateSrv.MaxSession != 20 {
+		t.Fatalf("subscriber got MaxSession %d -> %d, want 10 -> 20", calls[0].old.GateSrv.MaxSession, calls[0].cur.GateSrv.MaxSession)
+	}
+
+	// 多个分段变化时各自触发一次
+	if err := reload(`{"GateSrv": {"MaxSession": 20}, "RateLimit": {"MsgPerSecond": 6}, "Log": {"Path": "log/other"}}`); err != nil {
+		t.Fatal(err)
+	}
+	var sections []string
+	for _, call := range calls {
+		sections = append(sections, call.section)
+	}
+	if want := []string{utils.SectionRateLimit, utils.SectionLog}; !reflect.DeepEqual(sections, want) {
+		t.Fatalf("changed sections %v, want %v", sections, want)
+	}
+
+	// 内容不变时不触发回调
+	if err := reload(`{"GateSrv": {"MaxSession": 20}, "RateLimit": {"MsgPerSecond": 6}, "Log": {"Path": "log/other"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("unchanged config fired subscribers: %+v", calls)
+	}
+
+	// 解析或校验失败时保留旧配置, 不触发回调
+	current := utils.GlobalConfig()
+	for _, content := range []string{`{"GateSrv": {"MaxSession": 30}`, `{"GateSrv": {"MaxSession": -1}}`} {
+		if err := reload(content); err == nil {
+			t.Fatalf("reload %s succeeded", content)
+		}
+		if utils.GlobalConfig() != current || len(calls) != 0 {
+			t.Fatalf("failed reload %s changed config or fired subscribers", content)
+		}
+	}
+}
+
+func TestSessionEpochFile(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.ServerId = 7
+	if got := cfg.SessionEpochFile(); got != "data/GateServer-7.epoch" {
+		t.Fatalf("default epoch file %q", got)
+	}
+	cfg.GateSrv.EpochFile = "/var/lib/gate/7.epoch"
+	if got := cfg.SessionEpochFile(); got != cfg.GateSrv.EpochFile {
+		t.Fatalf("configured epoch file %q", got)
+	}
+}
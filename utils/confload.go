@@ -0,0 +1,318 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix 环境变量前缀, 如 GATE_GATESRV_BINDCLIENTPORT=9011
+const EnvPrefix = "GATE"
+
+// ValidationErrors 配置校验错误
+type ValidationErrors []string
+
+func (e ValidationErrors) Error() string {
+	return "invalid config:\n  - " + strings.Join(e, "\n  - ")
+}
+
+func (e *ValidationErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, field+": "+fmt.Sprintf(format, args...))
+}
+
+// LoadConfig
+//
+//	@Description: 读取配置: 默认值 -> 配置文件 -> GATE_*环境变量, 最后校验
+//	@param path 配置文件路径
+//	@return *ServerConfig
+//	@return error
+func LoadConfig(path string) (*ServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	cfg := DefaultConfig()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, describeJSONError(data, err))
+	}
+	if err = ApplyEnv(cfg, os.Environ()); err != nil {
+		return nil, err
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// describeJSONError
+//
+//	@Description: 给json错误补充行列号
+//	@param data 文件内容
+//	@param err 错误
+//	@return error
+func describeJSONError(data []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("field %s expects %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	default:
+		return err
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	col := offset - int64(bytes.LastIndexByte(data[:offset], '\n'))
+	return fmt.Errorf("line %d column %d: %w", line, col, err)
+}
+
+// ApplyEnv
+//
+//	@Description: 用环境变量覆盖配置, 变量名为 GATE_ 加大写的字段路径, 如 GATE_MYSQLCONNECT_SRVDB_PASSWD;
+//	列表类型的值使用json, 不对应任何字段的变量告警后忽略
+//	@param cfg 配置
+//	@param environ 环境变量(KEY=VALUE)
+//	@return error
+func ApplyEnv(cfg *ServerConfig, environ []string) error {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if idx := strings.IndexByte(kv, '='); idx > 0 && strings.HasPrefix(kv, EnvPrefix+"_") {
+			env[kv[:idx]] = kv[idx+1:]
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	var errs ValidationErrors
+	applyEnvValue(reflect.ValueOf(cfg).Elem(), EnvPrefix, env, &errs)
+	// 未知的变量可能属于其他程序(如GATE_HOME), 只告警不报错
+	for key := range env {
+		configLog.Warnf("ignore unknown environment override: %s", key)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func applyEnvValue(v reflect.Value, name string, env map[string]string, errs *ValidationErrors) {
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			applyEnvValue(v.Field(i), name+"_"+strings.ToUpper(v.Type().Field(i).Name), env, errs)
+		}
+		return
+	}
+	raw, ok := env[name]
+	if !ok {
+		return
+	}
+	delete(env, name)
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs.add(name, "expects a boolean, got %q", raw)
+			return
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			errs.add(name, "expects an integer, got %q", raw)
+			return
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			errs.add(name, "expects an unsigned integer, got %q", raw)
+			return
+		}
+		v.SetUint(n)
+	default:
+		ptr := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(raw), ptr.Interface()); err != nil {
+			errs.add(name, "expects json: %v", err)
+			return
+		}
+		v.Set(ptr.Elem())
+	}
+}
+
+// Validate
+//
+//	@Description: 校验配置, 返回全部错误
+//	@receiver g
+//	@return error
+func (g *ServerConfig) Validate() error {
+	var errs ValidationErrors
+	if g.ServerId < 0 || g.ServerId > codec.MaxSessionServerId {
+		errs.add("ServerId", "must be between 0 and %d (embedded in session ids), got %d", codec.MaxSessionServerId, g.ServerId)
+	}
+	checkPort(&errs, "GateSrv.BindClientPort+ServerId", g.GateSrv.BindClientPort+g.ServerId, false)
+	checkPort(&errs, "GateSrv.BindTCPPort+ServerId", g.GateSrv.BindTCPPort+g.ServerId, g.GateSrv.BindTCPPort == 0)
+	checkPort(&errs, "GateSrv.AdminPort+ServerId", g.GateSrv.AdminPort+g.ServerId, g.GateSrv.AdminPort == 0)
+	checkAddr(&errs, "GateSrv.BindSrvAddr", g.GateSrv.BindSrvAddr)
+	if g.GateSrv.MaxSession < 0 || g.GateSrv.MaxSession > codec.MaxSessionSeq {
+		errs.add("GateSrv.MaxSession", "must be between 0 and %d (session id sequence), got %d", codec.MaxSessionSeq, g.GateSrv.MaxSession)
+	}
+	if g.GateSrv.RetryAfter < 0 {
+		errs.add("GateSrv.RetryAfter", "must not be negative, got %d", g.GateSrv.RetryAfter)
+	}
+	if g.GateSrv.Queue.MaxLength < 0 {
+		errs.add("GateSrv.Queue.MaxLength", "must not be negative, got %d", g.GateSrv.Queue.MaxLength)
+	}
+	if g.GateSrv.Queue.Interval < 0 {
+		errs.add("GateSrv.Queue.Interval", "must not be negative, got %d", g.GateSrv.Queue.Interval)
+	}
+	if g.GateSrv.UseSSL.Open {
+		if g.GateSrv.UseSSL.Cert == "" {
+			errs.add("GateSrv.UseSSL.Cert", "is required when UseSSL.Open is true")
+		}
+		if g.GateSrv.UseSSL.PKey == "" {
+			errs.add("GateSrv.UseSSL.PKey", "is required when UseSSL.Open is true")
+		}
+	}
+	if g.GateSrv.AdminPort > 0 && g.GateSrv.AdminPort == g.GateSrv.BindClientPort {
+		errs.add("GateSrv.AdminPort", "must differ from BindClientPort")
+	}
+	if g.GateSrv.BindTCPPort > 0 && (g.GateSrv.BindTCPPort == g.GateSrv.BindClientPort || g.GateSrv.BindTCPPort == g.GateSrv.AdminPort) {
+		errs.add("GateSrv.BindTCPPort", "must differ from BindClientPort and AdminPort")
+	}
+	checkAddr(&errs, "GameSrv.BindSrvAddr", g.GameSrv.BindSrvAddr)
+	checkAddr(&errs, "WorldSrv.BindSrvAddr", g.WorldSrv.BindSrvAddr)
+	checkAddr(&errs, "DBSrv.BindSrvAddr", g.DBSrv.BindSrvAddr)
+	checkAddr(&errs, "RedisConnect.BindSrvAddr", g.RedisConnect.BindSrvAddr)
+	dbs := map[string]MySQLDBConfig{
+		"SrvDB":   g.MySQLConnect.SrvDB,
+		"LoginDB": g.MySQLConnect.LoginDB,
+		"LogDB":   g.MySQLConnect.LogDB,
+		"WorldDB": g.MySQLConnect.WorldDB,
+	}
+	for _, name := range []string{"SrvDB", "LoginDB", "LogDB", "WorldDB"} {
+		db := dbs[name]
+		if db == (MySQLDBConfig{}) {
+			continue
+		}
+		field := "MySQLConnect." + name
+		if db.Ip == "" {
+			errs.add(field+".Ip", "is required")
+		}
+		checkPort(&errs, field+".Port", db.Port, false)
+		if db.DBName == "" {
+			errs.add(field+".DBName", "is required")
+		}
+	}
+	switch g.Discovery.Provider {
+	case "", "static":
+	case "file":
+		if g.Discovery.Path == "" {
+			errs.add("Discovery.Path", "is required for the file provider")
+		}
+	default:
+		errs.add("Discovery.Provider", "unknown provider %q, want static or file", g.Discovery.Provider)
+	}
+	if g.Discovery.Interval < 0 {
+		errs.add("Discovery.Interval", "must not be negative, got %d", g.Discovery.Interval)
+	}
+	if g.RateLimit.MsgPerSecond < 0 {
+		errs.add("RateLimit.MsgPerSecond", "must not be negative, got %d", g.RateLimit.MsgPerSecond)
+	}
+	if g.RateLimit.Burst < 0 {
+		errs.add("RateLimit.Burst", "must not be negative, got %d", g.RateLimit.Burst)
+	}
+	if g.Log.MaxSize < 0 || g.Log.MaxAge < 0 || g.Log.MaxBackups < 0 || g.Log.AsyncSize < 0 {
+		errs.add("Log", "MaxSize, MaxAge, MaxBackups and AsyncSize must not be negative")
+	}
+	switch g.Log.Encoder {
+	case "", "text", "json":
+	default:
+		errs.add("Log.Encoder", "must be one of text, json; got %q", g.Log.Encoder)
+	}
+	if g.Log.Level != "" {
+		if _, err := zlog.ParseLevel(g.Log.Level); err != nil {
+			errs.add("Log.Level", "must be one of debug, info, warn, error; got %q", g.Log.Level)
+		}
+	}
+	for module, level := range g.Log.Modules {
+		if _, err := zlog.ParseLevel(level); err != nil {
+			errs.add("Log.Modules."+module, "must be one of debug, info, warn, error; got %q", level)
+		}
+	}
+	sampling := g.Log.Sampling
+	if sampling.Interval < 0 || sampling.First < 0 || sampling.Thereafter < 0 || sampling.Summary < 0 {
+		errs.add("Log.Sampling", "Interval, First, Thereafter and Summary must not be negative")
+	}
+	switch sampling.By {
+	case "", "caller", "template":
+	default:
+		errs.add("Log.Sampling.By", "must be one of caller, template; got %q", sampling.By)
+	}
+	for i, sink := range g.Log.Sinks {
+		field := fmt.Sprintf("Log.Sinks[%d]", i)
+		switch sink.Type {
+		case "stdout", "stderr", "syslog":
+		case "file":
+			if sink.Path == "" {
+				errs.add(field+".Path", "is required for the file sink")
+			}
+		default:
+			errs.add(field+".Type", "must be one of file, stdout, stderr, syslog; got %q", sink.Type)
+		}
+		if sink.Level != "" {
+			if _, err := zlog.ParseLevel(sink.Level); err != nil {
+				errs.add(field+".Level", "must be one of debug, info, warn, error; got %q", sink.Level)
+			}
+		}
+		switch sink.Encoder {
+		case "", "text", "json":
+		default:
+			errs.add(field+".Encoder", "must be one of text, json; got %q", sink.Encoder)
+		}
+	}
+	for i, route := range g.Routes {
+		field := fmt.Sprintf("Routes[%d]", i)
+		if route.Service == "" {
+			errs.add(field+".Service", "is required")
+		}
+		if route.MsgIdMin > route.MsgIdMax {
+			errs.add(field, "MsgIdMin %d is greater than MsgIdMax %d", route.MsgIdMin, route.MsgIdMax)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkPort(errs *ValidationErrors, field string, port int, optional bool) {
+	if optional {
+		return
+	}
+	if port <= 0 || port > 65535 {
+		errs.add(field, "port must be in 1-65535, got %d", port)
+	}
+}
+
+func checkAddr(errs *ValidationErrors, field, addr string) {
+	if addr == "" {
+		return
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+		errs.add(field, "must be host:port, got %q", addr)
+	}
+}
@@ -0,0 +1,192 @@
+package utils_test
+
+import (
+	"github.com/liaoyudong2/GateServer/codec"
+	"github.com/liaoyudong2/GateServer/utils"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMain 测试日志不写文件, 需要检查日志的用例自行调用zlog.StartCapture
+func TestMain(m *testing.M) {
+	zlog.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// writeConfig 在临时目录写入配置文件, 返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "SrvCfg.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string // 为空时期望加载成功
+	}{
+		{name: "empty object uses defaults", content: `{}`},
+		{name: "override", content: `{"ServerId": 3, "GateSrv": {"MaxSession": 10}}`},
+		{name: "syntax error", content: "{\n  \"ServerId\": 1,\n}", err: "line 3 column"},
+		{name: "unknown field", content: `{"ServerIds": 1}`, err: `unknown field "ServerIds"`},
+		{name: "type mismatch", content: `{"ServerId": "1"}`, err: "field ServerId expects int, got string"},
+		{name: "validation", content: `{"ServerId": -1}`, err: "ServerId: must be between"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := utils.LoadConfig(writeConfig(t, tt.content))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.GateSrv.BindClientPort != utils.DefaultConfig().GateSrv.BindClientPort {
+				t.Fatalf("default BindClientPort lost: %d", cfg.GateSrv.BindClientPort)
+			}
+		})
+	}
+
+	if _, err := utils.LoadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "read config") {
+		t.Fatalf("missing file err = %v", err)
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	t.Setenv("GATE_GATESRV_MAXSESSION", "12")
+	t.Setenv("GATE_LOG_LEVEL", "bogus")
+	_, err := utils.LoadConfig(writeConfig(t, `{}`))
+	if err == nil || !strings.Contains(err.Error(), "Log.Level") {
+		t.Fatalf("env override not validated: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *utils.ServerConfig)
+		fields []string // 期望报错的字段, 为空时期望通过
+	}{
+		{name: "default", modify: func(cfg *utils.ServerConfig) {}},
+		{name: "server id", modify: func(cfg *utils.ServerConfig) { cfg.ServerId = 256 }, fields: []string{"ServerId"}},
+		{name: "max session", modify: func(cfg *utils.ServerConfig) { cfg.GateSrv.MaxSession = codec.MaxSessionSeq + 1 }, fields: []string{"GateSrv.MaxSession"}},
+		{name: "client port", modify: func(cfg *utils.ServerConfig) { cfg.GateSrv.BindClientPort = 70000 }, fields: []string{"GateSrv.BindClientPort+ServerId"}},
+		{name: "optional ports", modify: func(cfg *utils.ServerConfig) { cfg.GateSrv.BindTCPPort, cfg.GateSrv.AdminPort = 0, 0 }},
+		{name: "port clash", modify: func(cfg *utils.ServerConfig) {
+			cfg.GateSrv.AdminPort = cfg.GateSrv.BindClientPort
+			cfg.GateSrv.BindTCPPort = cfg.GateSrv.BindClientPort
+		}, fields: []string{"GateSrv.AdminPort", "GateSrv.BindTCPPort"}},
+		{name: "addr", modify: func(cfg *utils.ServerConfig) { cfg.GameSrv.BindSrvAddr = "localhost" }, fields: []string{"GameSrv.BindSrvAddr"}},
+		{name: "negative", modify: func(cfg *utils.ServerConfig) {
+			cfg.GateSrv.MaxSession = -1
+			cfg.RateLimit.Burst = -1
+			cfg.Log.MaxSize = -1
+		}, fields: []string{"GateSrv.MaxSession", "RateLimit.Burst", "Log"}},
+		{name: "ssl", modify: func(cfg *utils.ServerConfig) { cfg.GateSrv.UseSSL.Open = true }, fields: []string{"GateSrv.UseSSL.Cert", "GateSrv.UseSSL.PKey"}},
+		{name: "mysql", modify: func(cfg *utils.ServerConfig) { cfg.MySQLConnect.LogDB.User = "root" }, fields: []string{"MySQLConnect.LogDB.Ip", "MySQLConnect.LogDB.Port", "MySQLConnect.LogDB.DBName"}},
+		{name: "discovery", modify: func(cfg *utils.ServerConfig) { cfg.Discovery.Provider = "file" }, fields: []string{"Discovery.Path"}},
+		{name: "discovery provider", modify: func(cfg *utils.ServerConfig) { cfg.Discovery.Provider = "files" }, fields: []string{"Discovery.Provider"}},
+		{name: "log", modify: func(cfg *utils.ServerConfig) {
+			cfg.Log.Level = "trace"
+			cfg.Log.Encoder = "xml"
+			cfg.Log.Modules = map[string]string{"net": "loud"}
+			cfg.Log.Sampling.By = "line"
+		}, fields: []string{"Log.Encoder", "Log.Level", "Log.Modules.net", "Log.Sampling.By"}},
+		{name: "sinks", modify: func(cfg *utils.ServerConfig) {
+			cfg.Log.Sinks = []utils.LogSinkConfig{{Type: "file"}, {Type: "kafka", Level: "x", Encoder: "y"}}
+		}, fields: []string{"Log.Sinks[0].Path", "Log.Sinks[1].Type", "Log.Sinks[1].Level", "Log.Sinks[1].Encoder"}},
+		{name: "routes", modify: func(cfg *utils.ServerConfig) {
+			cfg.Routes = []utils.RouteConfig{{MsgIdMin: 10, MsgIdMax: 1}}
+		}, fields: []string{"Routes[0].Service", "Routes[0]: MsgIdMin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := utils.DefaultConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			errs, ok := err.(utils.ValidationErrors)
+			if !ok {
+				t.Fatalf("err = %v, want ValidationErrors", err)
+			}
+			if len(errs) != len(tt.fields) {
+				t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(tt.fields), err)
+			}
+			for i, field := range tt.fields {
+				if !strings.HasPrefix(errs[i], field) {
+					t.Errorf("error %d = %q, want field %s", i, errs[i], field)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   string
+		check func(cfg *utils.ServerConfig) interface{}
+		want  interface{}
+		err   string
+	}{
+		{name: "int", env: "GATE_GATESRV_MAXSESSION=12", check: func(cfg *utils.ServerConfig) interface{} { return cfg.GateSrv.MaxSession }, want: 12},
+		{name: "bool", env: "GATE_DEBUGMODE=true", check: func(cfg *utils.ServerConfig) interface{} { return cfg.DebugMode }, want: true},
+		{name: "string", env: "GATE_MYSQLCONNECT_SRVDB_PASSWD=secret=1", check: func(cfg *utils.ServerConfig) interface{} { return cfg.MySQLConnect.SrvDB.PassWd }, want: "secret=1"},
+		{name: "slice", env: `GATE_GATESRV_RECORDUSERS=["u1","u2"]`, check: func(cfg *utils.ServerConfig) interface{} { return cfg.GateSrv.RecordUsers }, want: []string{"u1", "u2"}},
+		{name: "map", env: `GATE_LOG_MODULES={"net":"debug"}`, check: func(cfg *utils.ServerConfig) interface{} { return cfg.Log.Modules }, want: map[string]string{"net": "debug"}},
+		{name: "struct slice", env: `GATE_ROUTES=[{"MsgIdMin":1,"MsgIdMax":9,"Service":"game"}]`, check: func(cfg *utils.ServerConfig) interface{} { return cfg.Routes }, want: []utils.RouteConfig{{MsgIdMin: 1, MsgIdMax: 9, Service: "game"}}},
+		{name: "unknown key ignored", env: "GATE_HOME=/opt/gate", check: func(cfg *utils.ServerConfig) interface{} { return cfg.GateSrv.MaxSession }, want: 4096},
+		{name: "bad int", env: "GATE_SERVERID=one", err: "GATE_SERVERID: expects an integer"},
+		{name: "int overflow", env: "GATE_ROUTES=[{\"MsgIdMax\":70000}]", err: "GATE_ROUTES: expects json"},
+		{name: "bad bool", env: "GATE_LOG_ASYNC=yes", err: "GATE_LOG_ASYNC: expects a boolean"},
+		{name: "bad slice", env: "GATE_GATESRV_RECORDUSERS=u1,u2", err: "GATE_GATESRV_RECORDUSERS: expects json"},
+		{name: "bad map", env: `GATE_LOG_MODULES=["net"]`, err: "GATE_LOG_MODULES: expects json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := utils.DefaultConfig()
+			err := utils.ApplyEnv(cfg, []string{tt.env, "PATH=/bin"})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.check(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvUnknownWarns(t *testing.T) {
+	capture, stop := zlog.StartCapture()
+	defer stop()
+
+	if err := utils.ApplyEnv(utils.DefaultConfig(), []string{"GATE_HOME=/opt/gate"}); err != nil {
+		t.Fatal(err)
+	}
+	if capture.Find(zlog.LogWarn, "GATE_HOME") == nil {
+		t.Fatalf("unknown override not reported, logs: %v", capture.Messages())
+	}
+}
@@ -0,0 +1,223 @@
+package zlog
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DefaultAsyncSize = 8192 // 默认缓冲行数
+	asyncBatchLines  = 1024 // 单批最多写入的行数, 写完一批后落地
+)
+
+// ErrLogDropped 异步缓冲已满, 日志被丢弃
+var ErrLogDropped = errors.New("zlog: async buffer full, line dropped")
+
+// errAsyncStopped 写协程已停止(正在切换写入模式), 由调用方同步写入
+var errAsyncStopped = errors.New("zlog: async writer stopped")
+
+// AsyncConfig
+// @Description: 异步写入配置
+type AsyncConfig struct {
+	Size int  // 缓冲行数, <=0时使用默认值
+	Drop bool // 缓冲满时丢弃(true)或阻塞等待(false)
+}
+
+// asyncWriter
+// @Description: 有界缓冲 + 单个写协程批量落盘
+type asyncWriter struct {
+	lock     sync.RWMutex   // 放入缓冲时持读锁, 停止时持写锁, 停止后不再放入
+	stopped  bool           // 是否已停止
+	lines    chan *Entry    // 有界缓冲
+	flush    chan chan bool // 刷新请求
+	exitChan chan bool      // 退出信号
+	done     chan bool      // 写协程已退出
+	drop     bool           // 缓冲满时是否丢弃
+	dropped  *atomic.Uint64 // 丢弃计数(属于日志核心, 切换模式不清零)
+	write    func(e *Entry) // 写入一行(不落地)
+	commit   func()         // 落地一批
+}
+
+func newAsyncWriter(cfg AsyncConfig, dropped *atomic.Uint64, write func(e *Entry), commit func()) *asyncWriter {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultAsyncSize
+	}
+	w := &asyncWriter{
+		lines:    make(chan *Entry, cfg.Size),
+		flush:    make(chan chan bool),
+		exitChan: make(chan bool),
+		done:     make(chan bool),
+		drop:     cfg.Drop,
+		dropped:  dropped,
+		write:    write,
+		commit:   commit,
+	}
+	go w.run()
+	return w
+}
+
+// push
+//
+//	@Description: 放入缓冲, 不持有日志核心的锁, 阻塞模式下缓冲满时只阻塞调用方
+//	@receiver w
+//	@param e 一行日志
+//	@return error 已停止时返回errAsyncStopped
+func (w *asyncWriter) push(e *Entry) error {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	if w.stopped {
+		return errAsyncStopped
+	}
+	if !w.drop {
+		w.lines <- e
+		return nil
+	}
+	select {
+	case w.lines <- e:
+		return nil
+	default:
+		w.dropped.Add(1)
+		return ErrLogDropped
+	}
+}
+
+// run
+//
+//	@Description: 写协程, 每次尽量取出多行合并写入
+//	@receiver w
+func (w *asyncWriter) run() {
+	defer close(w.done)
+
+	for {
+		select {
+		case e := <-w.lines:
+			w.write(e)
+			w.drain(-1, 1)
+		case reply := <-w.flush:
+			w.drain(len(w.lines), 0)
+			reply <- true
+		case <-w.exitChan:
+			w.drain(len(w.lines), 0)
+			return
+		}
+	}
+}
+
+// drain
+//
+//	@Description: 取出缓冲中的日志并写入, 每批写完后落地
+//	@receiver w
+//	@param count 需要取出的行数, <0 表示取出当前可立即取到的行
+//	@param pending 已写入但未落地的行数
+func (w *asyncWriter) drain(count int, pending int) {
+	for n := 0; count < 0 || n < count; n++ {
+		if pending >= asyncBatchLines {
+			w.commit()
+			pending = 0
+		}
+		if count >= 0 {
+			w.write(<-w.lines)
+			pending++
+			continue
+		}
+		select {
+		case e := <-w.lines:
+			w.write(e)
+			pending++
+		default:
+			count = 0
+		}
+	}
+	if pending > 0 {
+		w.commit()
+	}
+}
+
+// Flush
+//
+//	@Description: 等待调用前放入缓冲的日志全部写入
+//	@receiver w
+func (w *asyncWriter) Flush() {
+	reply := make(chan bool)
+	select {
+	case w.flush <- reply:
+		<-reply
+	case <-w.done:
+	}
+}
+
+// stop
+//
+//	@Description: 写完缓冲中的日志后退出
+//	@receiver w
+func (w *asyncWriter) stop() {
+	w.lock.Lock()
+	w.stopped = true
+	w.lock.Unlock()
+
+	close(w.exitChan)
+	<-w.done
+}
+
+// SetAsync
+//
+//	@Description: 开启异步写入, cfg为空时恢复同步写入(会先写完缓冲)
+//	@receiver log
+//	@param cfg 配置
+func (log *ZLoggerCore) SetAsync(cfg *AsyncConfig) {
+	log.mu.Lock()
+	old := log.async
+	log.async = nil
+	if cfg != nil {
+		log.async = newAsyncWriter(*cfg, &log.dropped, func(e *Entry) {
+			_ = log.dispatch(e, false)
+		}, log.flushOutputs)
+	}
+	log.mu.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+}
+
+// Flush
+//
+//	@Description: 等待已输出的日志全部写入, 同步模式下直接返回
+//	@receiver log
+func (log *ZLoggerCore) Flush() {
+	log.mu.Lock()
+	async := log.async
+	log.mu.Unlock()
+
+	if async != nil {
+		async.Flush()
+	}
+	log.flushOutputs()
+	if file := log.FileOutput(); file != nil {
+		_ = file.Sync()
+	}
+}
+
+// Close
+//
+//	@Description: 写完缓冲并关闭所有输出, 进程退出前调用
+//	@receiver log
+func (log *ZLoggerCore) Close() {
+	log.SetSampling(nil)
+	log.SetAsync(nil)
+
+	for _, sink := range *log.outputs.Load() {
+		_ = sink.Close()
+	}
+}
+
+// Dropped
+//
+//	@Description: 异步缓冲满时丢弃的行数
+//	@receiver log
+//	@return uint64
+func (log *ZLoggerCore) Dropped() uint64 {
+	return log.dropped.Load()
+}
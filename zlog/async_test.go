@@ -0,0 +1,175 @@
+package zlog_test
+
+import (
+	"errors"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateSink 打开闸门前写入阻塞的输出, 模拟写得很慢的磁盘
+type gateSink struct {
+	gate   chan bool
+	mu     sync.Mutex
+	lines  []string
+	closed bool
+}
+
+func newGateSink() *gateSink {
+	return &gateSink{gate: make(chan bool)}
+}
+
+func (s *gateSink) Enabled(level int) bool {
+	return true
+}
+
+func (s *gateSink) Write(e *zlog.Entry) error {
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lines = append(s.lines, e.Message)
+	return nil
+}
+
+func (s *gateSink) Flush() error {
+	return nil
+}
+
+func (s *gateSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+func (s *gateSink) open() {
+	close(s.gate)
+}
+
+func (s *gateSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.lines)
+}
+
+// newAsyncLog 创建只写到sink的异步日志
+func newAsyncLog(sink zlog.ISink, cfg zlog.AsyncConfig) *zlog.ZLoggerCore {
+	log := zlog.NewZLog(zlog.BitLevel)
+	log.SetOutput(io.Discard)
+	log.AddSink(sink)
+	log.SetAsync(&cfg)
+	return log
+}
+
+func TestAsyncDrop(t *testing.T) {
+	sink := newGateSink()
+	log := newAsyncLog(sink, zlog.AsyncConfig{Size: 4, Drop: true})
+
+	// 写协程阻塞在第一行, 缓冲满后的日志被丢弃并计数
+	const total = 20
+	dropped := 0
+	for i := 0; i < total; i++ {
+		if err := log.OutPut(zlog.LogInfo, "line"); errors.Is(err, zlog.ErrLogDropped) {
+			dropped++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropped < total-5 || uint64(dropped) != log.Dropped() {
+		t.Fatalf("dropped %d, counter %d, want at least %d", dropped, log.Dropped(), total-5)
+	}
+	sink.open()
+	log.Flush()
+	if n := sink.count(); n != total-dropped {
+		t.Fatalf("wrote %d lines, want %d", n, total-dropped)
+	}
+	log.Close()
+}
+
+func TestAsyncFlush(t *testing.T) {
+	capture := zlog.NewCapture(zlog.LogDebug)
+	log := newAsyncLog(capture, zlog.AsyncConfig{Size: 16})
+
+	// 阻塞模式不丢弃, Flush返回时调用前的日志全部写入
+	for i := 0; i < 100; i++ {
+		log.Infof("line %d", i)
+	}
+	log.Flush()
+	if n := len(capture.Entries()); n != 100 {
+		t.Fatalf("flushed %d lines, want 100", n)
+	}
+	if log.Dropped() != 0 {
+		t.Fatalf("blocking mode dropped %d lines", log.Dropped())
+	}
+	log.Close()
+}
+
+func TestAsyncCloseDrains(t *testing.T) {
+	sink := newGateSink()
+	log := newAsyncLog(sink, zlog.AsyncConfig{Size: 64})
+	for i := 0; i < 50; i++ {
+		log.Info("line")
+	}
+
+	// 关闭时写完缓冲中的日志再关闭输出
+	closed := make(chan bool)
+	go func() {
+		log.Close()
+		close(closed)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	sink.open()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close did not return")
+	}
+	if n := sink.count(); n != 50 || !sink.closed {
+		t.Fatalf("wrote %d lines, closed %v; want 50 lines and closed", n, sink.closed)
+	}
+}
+
+func TestAsyncBlockedPush(t *testing.T) {
+	sink := newGateSink()
+	log := newAsyncLog(sink, zlog.AsyncConfig{Size: 1})
+
+	// 缓冲满时阻塞的只是写日志的协程, 不占用日志核心的锁
+	logged := make(chan bool)
+	go func() {
+		for i := 0; i < 3; i++ {
+			log.Info("line")
+		}
+		close(logged)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan bool)
+	go func() {
+		log.AddSink(zlog.NewCapture(zlog.LogDebug))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddSink blocked by a full async buffer")
+	}
+
+	// 阻塞期间切换为同步写入, 缓冲和之后的日志都不丢失
+	switched := make(chan bool)
+	go func() {
+		log.SetAsync(nil)
+		close(switched)
+	}()
+	sink.open()
+	<-logged
+	<-switched
+	log.Info("sync")
+	if n := sink.count(); n != 4 {
+		t.Fatalf("wrote %d lines, want 4", n)
+	}
+	log.Close()
+}
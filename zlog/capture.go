@@ -0,0 +1,167 @@
+package zlog
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Capture
+// @Description: 测试用的日志捕获, 记录每条日志的级别、调用位置和附加字段
+type Capture struct {
+	sinkBase
+	mu      sync.Mutex // 保护记录
+	entries []Entry    // 已捕获的日志
+}
+
+// NewCapture
+//
+//	@Description: 创建日志捕获, 需通过AddSink或StartCapture接入
+//	@param level 最低级别
+//	@return *Capture
+func NewCapture(level int) *Capture {
+	c := &Capture{}
+	c.SetLevel(level)
+	return c
+}
+
+// StartCapture
+//
+//	@Description: 捕获日志并以io.Discard替代文件输出, 返回的stop恢复原输出
+//	@receiver log
+//	@return *Capture
+//	@return func()
+func (log *ZLoggerCore) StartCapture() (*Capture, func()) {
+	c := NewCapture(LogDebug)
+	log.mu.Lock()
+	writer := log.writer
+	log.mu.Unlock()
+	if writer == nil {
+		log.SetOutput(io.Discard)
+	}
+	log.AddSink(c)
+	return c, func() {
+		log.Flush()
+		log.RemoveSink(c)
+		if writer == nil {
+			log.SetOutput(nil)
+		}
+	}
+}
+
+func (c *Capture) Write(e *Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = append(c.entries, *e)
+	return nil
+}
+
+func (c *Capture) Flush() error {
+	return nil
+}
+
+func (c *Capture) Close() error {
+	return nil
+}
+
+// Entries
+//
+//	@Description: 已捕获的日志, 按输出顺序
+//	@receiver c
+//	@return []Entry
+func (c *Capture) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Entry(nil), c.entries...)
+}
+
+// Messages
+//
+//	@Description: 已捕获日志的内容(去掉结尾换行)
+//	@receiver c
+//	@return []string
+func (c *Capture) Messages() []string {
+	entries := c.Entries()
+	messages := make([]string, 0, len(entries))
+	for i := range entries {
+		messages = append(messages, strings.TrimRight(entries[i].Message, "\n"))
+	}
+	return messages
+}
+
+// Find
+//
+//	@Description: 查找指定级别且内容包含substr的第一条日志
+//	@receiver c
+//	@param level 日志级别
+//	@param substr 内容片段
+//	@return *Entry 未找到时为空
+func (c *Capture) Find(level int, substr string) *Entry {
+	for _, e := range c.Entries() {
+		if e.Level == level && strings.Contains(e.Message, substr) {
+			return &e
+		}
+	}
+	return nil
+}
+
+// Count
+//
+//	@Description: 指定级别的日志条数
+//	@receiver c
+//	@param level 日志级别
+//	@return int
+func (c *Capture) Count(level int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for i := range c.entries {
+		if c.entries[i].Level == level {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset
+//
+//	@Description: 清空已捕获的日志
+//	@receiver c
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+}
+
+// Caller
+//
+//	@Description: 调用位置(短文件名:行), 未开启文件名标记位时为空
+//	@receiver e
+//	@return string
+func (e *Entry) Caller() string {
+	if e.File == "" {
+		return ""
+	}
+	return shortFile(e.File) + ":" + strconv.Itoa(e.Line)
+}
+
+// Field
+//
+//	@Description: 附加字段的值, 同名字段取最后一个
+//	@receiver e
+//	@param key 字段名
+//	@return interface{}
+//	@return bool
+func (e *Entry) Field(key string) (interface{}, bool) {
+	for i := len(e.Fields) - 1; i >= 0; i-- {
+		if e.Fields[i].Key == key {
+			return e.Fields[i].Value, true
+		}
+	}
+	return nil, false
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -47,21 +48,22 @@ var levels = []string{
 	"[FATAL]",
 }
 
-type ZLoggerWriter struct {
-	path string    // 日志路径
-	date string    // 日期字符串
-	out  io.Writer // 日志输出的文件描述符
-}
-
 type ZLoggerCore struct {
-	console    *os.File      // 控制台模式
-	mu         sync.Mutex    //确保多协程读写文件，防止文件内容混乱，做到协程安全
-	flag       int           //日志标记位
-	writer     ZLoggerWriter // 日志输出
-	buf        bytes.Buffer  //输出的缓冲区
-	file       *os.File      //当前日志绑定的输出文件
-	debugClose bool          //是否打印调试debug信息
-	callDepth  int           //获取日志文件名和代码上述的runtime.Call 的函数调用层数
+	mu        sync.Mutex              //保护标记位和输出列表
+	flag      int                     //日志标记位
+	level     atomic.Int32            //最低输出级别, 低于该级别的日志不输出
+	modules   sync.Map                //模块名 -> *ZLogModule
+	callDepth int                     //获取日志文件名和代码上述的runtime.Call 的函数调用层数
+	encoder   int                     //默认输出的编码(EncoderText/EncoderJSON)
+	file      *FileSink               //默认文件输出, 为空时不写文件
+	console   *WriterSink             //控制台输出, 为空时不输出
+	writer    *WriterSink             //SetOutput设置的输出, 不为空时替代文件输出
+	sinks     []ISink                 //通过AddSink添加的输出
+	outputs   atomic.Pointer[[]ISink] //当前生效的全部输出
+	async     *asyncWriter            //异步写入, 为空时同步写入
+	dropped   atomic.Uint64           //异步缓冲满时丢弃的行数
+	sampler   atomic.Pointer[sampler] //日志采样, 为空时不采样
+	sampled   atomic.Uint64           //采样抑制的行数
 }
 
 // NewZLog
@@ -72,15 +74,11 @@ type ZLoggerCore struct {
 func NewZLog(flag int) *ZLoggerCore {
 	//默认 debug打开， calledDepth深度为2,ZLogger对象调用日志打印方法最多调用两层到达output函数
 	zlog := &ZLoggerCore{
-		writer: ZLoggerWriter{
-			date: time.Now().Format(time.DateOnly),
-			out:  os.Stdout,
-		},
-		flag:       flag,
-		file:       nil,
-		debugClose: false,
-		callDepth:  2,
+		flag:      flag,
+		file:      NewFileSink("", RotateConfig{}, LogDebug, EncoderText),
+		callDepth: 2,
 	}
+	zlog.rebuildOutputs()
 	//设置log对象 回收资源 析构方法(不设置也可以，go的Gc会自动回收，强迫症没办法)
 	runtime.SetFinalizer(zlog, CleanZLog)
 	return zlog
@@ -91,76 +89,12 @@ func NewZLog(flag int) *ZLoggerCore {
 //	@Description: 回收日志处理
 //	@param log
 func CleanZLog(log *ZLoggerCore) {
-	log.closeFile()
-}
-
-// formatHeader
-//
-//	@Description: 制作当条日志数据的 格式头信息
-//	@receiver log
-//	@param t 时间
-//	@param file 来源代码文件名
-//	@param line 来源代码文件行数
-//	@param level 日志等级
-func (log *ZLoggerCore) formatHeader(t time.Time, file string, line int, level int) {
-	var buf = &log.buf
-
-	//已经设置了时间相关的标识位,那么需要加时间信息在日志头部
-	if log.flag&(BitDate|BitTime|BitMicroSeconds) != 0 {
-		//日期位被标记
-		if log.flag&BitDate != 0 {
-			year, month, day := t.Date()
-			buf.WriteByte('[')
-			itoa(buf, year, 4)
-			buf.WriteByte('-') // "[2019-"
-			itoa(buf, int(month), 2)
-			buf.WriteByte('-') // "[2019-04-"
-			itoa(buf, day, 2)
-			buf.WriteByte(' ') // "[2019-04-11 "
-		}
-
-		//时钟位被标记
-		if log.flag&(BitTime|BitMicroSeconds) != 0 {
-			hour, min, sec := t.Clock()
-			itoa(buf, hour, 2)
-			buf.WriteByte(':') // "11:"
-			itoa(buf, min, 2)
-			buf.WriteByte(':') // "11:15:"
-			itoa(buf, sec, 2)  // "11:15:33"
-			//微秒被标记
-			if log.flag&BitMicroSeconds != 0 {
-				buf.WriteByte('.')
-				itoa(buf, t.Nanosecond()/1e3, 6) // "11:15:33.123123
-			}
-			buf.WriteByte(']')
-			buf.WriteByte(' ')
-		}
+	log.mu.Lock()
+	file := log.file
+	log.mu.Unlock()
 
-		// 日志级别位被标记
-		if log.flag&BitLevel != 0 {
-			buf.WriteString(levels[level])
-		}
-		buf.WriteByte(' ')
-
-		//日志当前代码调用文件名名称位被标记
-		if log.flag&(BitShortFile|BitLongFile) != 0 {
-			//短文件名称
-			if log.flag&BitShortFile != 0 {
-				short := file
-				for i := len(file) - 1; i > 0; i-- {
-					if file[i] == '/' {
-						//找到最后一个'/'之后的文件名称
-						short = file[i+1:]
-						break
-					}
-				}
-				file = short
-			}
-			buf.WriteString(file)
-			buf.WriteByte(':')
-			itoa(buf, line, -1) //行数
-			buf.WriteString(": ")
-		}
+	if file != nil {
+		_ = file.Close()
 	}
 }
 
@@ -172,96 +106,140 @@ func (log *ZLoggerCore) formatHeader(t time.Time, file string, line int, level i
 //	@param s 日志源内容(未加工)
 //	@return error
 func (log *ZLoggerCore) OutPut(level int, s string) error {
+	return log.output(log.callDepth+1, level, s, nil)
+}
 
-	now := time.Now() // 得到当前时间
-	var file string   //当前调用日志接口的文件名称
-	var line int      //当前代码行数
-	log.mu.Lock()
-	defer log.mu.Unlock()
-
-	if log.flag&(BitShortFile|BitLongFile) != 0 {
-		log.mu.Unlock()
+// output
+//
+//	@Description: 生成一条日志并分发到各个输出
+//	@receiver log
+//	@param callDepth 到日志调用方的调用层数
+//	@param level 日志等级
+//	@param s 日志源内容(未加工)
+//	@param fields 附加字段
+//	@return error
+func (log *ZLoggerCore) output(callDepth int, level int, s string, fields []Field) error {
+	e := &Entry{
+		Time:    time.Now(), // 得到当前时间
+		Level:   level,
+		Message: s,
+		Fields:  fields,
+		Flag:    log.Flags(),
+	}
+	if e.Flag&(BitShortFile|BitLongFile) != 0 {
 		var ok bool
 		//得到当前调用者的文件名称和执行到的代码行数
-		_, file, line, ok = runtime.Caller(log.callDepth)
+		_, e.File, e.Line, ok = runtime.Caller(callDepth)
 		if !ok {
-			file = "unknown-file"
-			line = 0
+			e.File = "unknown-file"
+			e.Line = 0
 		}
-		log.mu.Lock()
 	}
 
-	//清零buf
-	log.buf.Reset()
-	//写日志头
-	log.formatHeader(now, file, line, level)
-	//写日志内容
-	log.buf.WriteString(s)
-	//补充回车
-	if len(s) > 0 && s[len(s)-1] != '\n' {
-		log.buf.WriteByte('\n')
-	}
+	log.mu.Lock()
+	async := log.async
+	log.mu.Unlock()
 
-	//将填充好的buf 写到IO输出上
-	return log.flushBuffer()
+	//异步模式: 交给写协程, 写协程刚被停止时改为同步写入
+	if async != nil {
+		if err := async.push(e); err != errAsyncStopped {
+			return err
+		}
+	}
+	return log.dispatch(e, true)
 }
 
-// flushBuffer
+// dispatch
 //
-//	@Description: 写入文件
+//	@Description: 写入所有接受该级别的输出
 //	@receiver log
+//	@param e 日志
+//	@param flush 写入后是否立即落地
 //	@return error
-func (log *ZLoggerCore) flushBuffer() error {
-	log.openFile()
-	if log.writer.out != nil {
-		if log.console != nil {
-			_, _ = log.console.Write(log.buf.Bytes())
+func (log *ZLoggerCore) dispatch(e *Entry, flush bool) error {
+	var errs []error
+	for _, sink := range *log.outputs.Load() {
+		if !sink.Enabled(e.Level) {
+			continue
+		}
+		if err := sink.Write(e); err != nil {
+			errs = append(errs, err)
+		}
+		if flush {
+			_ = sink.Flush()
 		}
-		//将填充好的buf 写到IO输出上
-		_, err := log.writer.out.Write(log.buf.Bytes())
-		return err
 	}
-	return errors.New("writer out fd is nil")
+	return errors.Join(errs...)
 }
 
-// openFile
+// flushOutputs
 //
-//	@Description: 打开日志文件输出(自动判定日期进行拆分)
+//	@Description: 落地所有输出的缓存
 //	@receiver log
-func (log *ZLoggerCore) openFile() {
-	dateStr := time.Now().Format(time.DateOnly)
-	if log.file == nil || log.writer.date != dateStr {
-		log.closeFile()
-
-		var file *os.File
-
-		log.writer.date = dateStr
-		//创建日志文件夹
-		_ = mkdirLog(log.writer.path)
-
-		fullPath := log.writer.path + "/" + log.writer.date + ".log"
-		if log.checkFileExist(fullPath) {
-			//文件存在，打开
-			file, _ = os.OpenFile(fullPath, os.O_APPEND|os.O_RDWR, 0644)
-		} else {
-			//文件不存在，创建
-			file, _ = os.OpenFile(fullPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
-		}
-		log.file = file
-		log.writer.out = file
+func (log *ZLoggerCore) flushOutputs() {
+	for _, sink := range *log.outputs.Load() {
+		_ = sink.Flush()
 	}
 }
 
-// closeFile
+// rebuildOutputs
 //
-//	@Description: 关闭日志绑定的文件
+//	@Description: 输出变化后重建生效列表, 调用方持有mu(创建时除外)
 //	@receiver log
-func (log *ZLoggerCore) closeFile() {
-	if log.file != nil {
-		_ = log.file.Close()
-		log.file = nil
-		log.writer.out = os.Stderr
+func (log *ZLoggerCore) rebuildOutputs() {
+	outputs := make([]ISink, 0, len(log.sinks)+3)
+	if log.writer != nil {
+		outputs = append(outputs, log.writer)
+	} else if log.file != nil {
+		outputs = append(outputs, log.file)
 	}
+	if log.console != nil {
+		outputs = append(outputs, log.console)
+	}
+	outputs = append(outputs, log.sinks...)
+	log.outputs.Store(&outputs)
+}
+
+// AddSink
+//
+//	@Description: 添加输出, 每条日志按输出自身的级别和编码写入
+//	@receiver log
+//	@param sink 输出
+func (log *ZLoggerCore) AddSink(sink ISink) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.sinks = append(log.sinks, sink)
+	log.rebuildOutputs()
+}
+
+// RemoveSink
+//
+//	@Description: 移除通过AddSink添加的输出, 不会关闭该输出
+//	@receiver log
+//	@param sink 输出
+//	@return bool 是否存在
+func (log *ZLoggerCore) RemoveSink(sink ISink) bool {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	for i, s := range log.sinks {
+		if s == sink {
+			log.sinks = append(log.sinks[:i:i], log.sinks[i+1:]...)
+			log.rebuildOutputs()
+			return true
+		}
+	}
+	return false
+}
+
+// Sinks
+//
+//	@Description: 当前生效的全部输出(含默认文件和控制台输出)
+//	@receiver log
+//	@return []ISink
+func (log *ZLoggerCore) Sinks() []ISink {
+	return append([]ISink(nil), *log.outputs.Load()...)
 }
 
 // SetLogPath
@@ -273,74 +251,198 @@ func (log *ZLoggerCore) SetLogPath(path string) {
 	log.mu.Lock()
 	defer log.mu.Unlock()
 
-	log.writer.path = path
+	if log.file != nil {
+		log.file.SetPath(path)
+	}
+}
+
+// SetRotate
+//
+//	@Description: 设置日志拆分与保留策略
+//	@receiver log
+//	@param cfg 配置
+func (log *ZLoggerCore) SetRotate(cfg RotateConfig) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if log.file != nil {
+		log.file.SetRotate(cfg)
+	}
+}
+
+// SetFileOutput
+//
+//	@Description: 开启或关闭默认文件输出, 只使用其他输出时关闭
+//	@receiver log
+//	@param stat 是否开启
+func (log *ZLoggerCore) SetFileOutput(stat bool) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if stat == (log.file != nil) {
+		return
+	}
+	file := log.file
+	if stat {
+		log.file = NewFileSink("", RotateConfig{}, LogDebug, log.encoder)
+	} else {
+		log.file = nil
+	}
+	log.rebuildOutputs()
+	if file != nil {
+		_ = file.Close()
+	}
+}
+
+// FileOutput
+//
+//	@Description: 默认文件输出, 关闭时为空
+//	@receiver log
+//	@return *FileSink
+func (log *ZLoggerCore) FileOutput() *FileSink {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	return log.file
+}
+
+// SetEncoder
+//
+//	@Description: 设置默认文件和控制台输出的编码
+//	@receiver log
+//	@param encoder EncoderText/EncoderJSON
+func (log *ZLoggerCore) SetEncoder(encoder int) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.encoder = encoder
+	if log.file != nil {
+		log.file.SetEncoder(encoder)
+	}
+	if log.console != nil {
+		log.console.SetEncoder(encoder)
+	}
+	if log.writer != nil {
+		log.writer.SetEncoder(encoder)
+	}
+}
+
+// SetOutput
+//
+//	@Description: 输出到指定的io.Writer, 完全替代文件输出(不创建目录和文件); out为空时恢复文件输出
+//	控制台输出和AddSink添加的输出不受影响
+//	@receiver log
+//	@param out 输出目标
+func (log *ZLoggerCore) SetOutput(out io.Writer) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if out == nil {
+		log.writer = nil
+	} else {
+		log.writer = NewWriterSink(out, LogDebug, log.encoder)
+	}
+	log.rebuildOutputs()
+	if out != nil && log.file != nil {
+		// 文件输出保留路径等设置, 关闭已打开的文件, 恢复后重新打开
+		_ = log.file.Close()
+	}
 }
 
 func (log *ZLoggerCore) SetConsole(stat bool) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if stat == (log.console != nil) {
+		return
+	}
 	if stat {
-		log.console = os.Stdout
+		log.console = NewWriterSink(os.Stdout, LogDebug, log.encoder)
 	} else {
 		log.console = nil
 	}
+	log.rebuildOutputs()
 }
 
 func (log *ZLoggerCore) Debugf(format string, v ...interface{}) {
-	if log.debugClose == true {
+	if !log.Enabled(LogDebug) || !log.sample(log.callDepth, LogDebug, format) {
 		return
 	}
 	_ = log.OutPut(LogDebug, fmt.Sprintf(format, v...))
 }
 
 func (log *ZLoggerCore) Debug(v ...interface{}) {
-	if log.debugClose == true {
+	if !log.Enabled(LogDebug) || !log.sample(log.callDepth, LogDebug, "") {
 		return
 	}
 	_ = log.OutPut(LogDebug, fmt.Sprintln(v...))
 }
 
 func (log *ZLoggerCore) Infof(format string, v ...interface{}) {
+	if !log.Enabled(LogInfo) || !log.sample(log.callDepth, LogInfo, format) {
+		return
+	}
 	_ = log.OutPut(LogInfo, fmt.Sprintf(format, v...))
 }
 
 func (log *ZLoggerCore) Info(v ...interface{}) {
+	if !log.Enabled(LogInfo) || !log.sample(log.callDepth, LogInfo, "") {
+		return
+	}
 	_ = log.OutPut(LogInfo, fmt.Sprintln(v...))
 }
 
 func (log *ZLoggerCore) Warnf(format string, v ...interface{}) {
+	if !log.Enabled(LogWarn) || !log.sample(log.callDepth, LogWarn, format) {
+		return
+	}
 	_ = log.OutPut(LogWarn, fmt.Sprintf(format, v...))
 }
 
 func (log *ZLoggerCore) Warn(v ...interface{}) {
+	if !log.Enabled(LogWarn) || !log.sample(log.callDepth, LogWarn, "") {
+		return
+	}
 	_ = log.OutPut(LogWarn, fmt.Sprintln(v...))
 }
 
 func (log *ZLoggerCore) Errorf(format string, v ...interface{}) {
+	if !log.Enabled(LogError) || !log.sample(log.callDepth, LogError, format) {
+		return
+	}
 	_ = log.OutPut(LogError, fmt.Sprintf(format, v...))
 }
 
 func (log *ZLoggerCore) Error(v ...interface{}) {
+	if !log.Enabled(LogError) || !log.sample(log.callDepth, LogError, "") {
+		return
+	}
 	_ = log.OutPut(LogError, fmt.Sprintln(v...))
 }
 
 func (log *ZLoggerCore) Fatalf(format string, v ...interface{}) {
 	_ = log.OutPut(LogFatal, fmt.Sprintf(format, v...))
+	log.Flush()
 	os.Exit(1)
 }
 
 func (log *ZLoggerCore) Fatal(v ...interface{}) {
 	_ = log.OutPut(LogFatal, fmt.Sprintln(v...))
+	log.Flush()
 	os.Exit(1)
 }
 
 func (log *ZLoggerCore) Panicf(format string, v ...interface{}) {
 	s := fmt.Sprintf(format, v...)
 	_ = log.OutPut(LogPanic, s)
+	log.Flush()
 	panic(s)
 }
 
 func (log *ZLoggerCore) Panic(v ...interface{}) {
 	s := fmt.Sprintln(v...)
 	_ = log.OutPut(LogPanic, s)
+	log.Flush()
 	panic(s)
 }
 
@@ -372,20 +474,43 @@ func (log *ZLoggerCore) AddFlag(flag int) {
 	log.flag |= flag
 }
 
+// CloseDebug
+//
+//	@Description: 关闭调试日志, 级别提升到Info(已高于Info时不变)
+//	@receiver log
 func (log *ZLoggerCore) CloseDebug() {
-	log.debugClose = true
+	log.level.CompareAndSwap(LogDebug, LogInfo)
 }
 
+// OpenDebug
+//
+//	@Description: 开启调试日志, 级别降为Debug
+//	@receiver log
 func (log *ZLoggerCore) OpenDebug() {
-	log.debugClose = false
+	log.level.Store(LogDebug)
 }
 
-func (log *ZLoggerCore) checkFileExist(filename string) bool {
-	exist := true
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		exist = false
-	}
-	return exist
+// SetLevel
+//
+//	@Description: 设置最低输出级别, 可在运行中修改
+//	@receiver log
+//	@param level 日志级别(LogDebug...LogFatal)
+func (log *ZLoggerCore) SetLevel(level int) {
+	log.level.Store(int32(level))
+}
+
+func (log *ZLoggerCore) Level() int {
+	return int(log.level.Load())
+}
+
+// Enabled
+//
+//	@Description: 该级别的日志是否会输出
+//	@receiver log
+//	@param level 日志级别
+//	@return bool
+func (log *ZLoggerCore) Enabled(level int) bool {
+	return int32(level) >= log.level.Load()
 }
 
 func mkdirLog(dir string) (e error) {
@@ -0,0 +1,241 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日志输出编码
+const (
+	EncoderText = iota // 文本: [日期 时间] [级别] 文件:行: 内容 key=value
+	EncoderJSON        // 每行一个json对象
+)
+
+// Field
+// @Description: 日志附加字段
+type Field struct {
+	Key   string      // 字段名
+	Value interface{} // 字段值
+}
+
+// makeFields
+//
+//	@Description: 将 key, value, key, value... 转为字段, 落单的值使用 !BADKEY 作为字段名
+//	@param kv 键值对
+//	@return []Field
+func makeFields(kv []interface{}) []Field {
+	fields := make([]Field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 >= len(kv) {
+			fields = append(fields, Field{Key: "!BADKEY", Value: kv[i]})
+			break
+		}
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		fields = append(fields, Field{Key: key, Value: kv[i+1]})
+	}
+	return fields
+}
+
+// formatFields
+//
+//	@Description: 文本模式下以 key=value 输出字段
+//	@param buf 缓冲区
+//	@param fields 字段
+func formatFields(buf *bytes.Buffer, fields []Field) {
+	for _, field := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(field.Key)
+		buf.WriteByte('=')
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\n\r\"=") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+}
+
+// Entry
+// @Description: 一条日志, 由日志核心生成后分发到各个输出
+type Entry struct {
+	Time    time.Time // 时间
+	Level   int       // 日志等级
+	File    string    // 来源代码文件名(未开启文件名标记位时为空)
+	Line    int       // 来源代码文件行数
+	Message string    // 日志内容(未加工)
+	Fields  []Field   // 附加字段
+	Flag    int       // 生成时的头部标记位
+}
+
+// Encode
+//
+//	@Description: 按编码格式将日志写入缓冲区, 以换行结尾
+//	@param buf 缓冲区
+//	@param e 日志
+//	@param encoder EncoderText/EncoderJSON
+func Encode(buf *bytes.Buffer, e *Entry, encoder int) {
+	if encoder == EncoderJSON {
+		formatJSON(buf, e)
+		return
+	}
+	//写日志头
+	formatHeader(buf, e)
+	//写日志内容
+	buf.WriteString(e.Message)
+	//写附加字段
+	if len(e.Fields) > 0 {
+		if s := e.Message; len(s) > 0 && s[len(s)-1] == '\n' {
+			buf.Truncate(buf.Len() - 1)
+		}
+		formatFields(buf, e.Fields)
+	}
+	//补充回车
+	if b := buf.Bytes(); len(b) > 0 && b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+}
+
+// formatHeader
+//
+//	@Description: 制作当条日志数据的 格式头信息
+//	@param buf 缓冲区
+//	@param e 日志
+func formatHeader(buf *bytes.Buffer, e *Entry) {
+	flag, t, file := e.Flag, e.Time, e.File
+
+	//已经设置了时间相关的标识位,那么需要加时间信息在日志头部
+	if flag&(BitDate|BitTime|BitMicroSeconds) != 0 {
+		//日期位被标记
+		if flag&BitDate != 0 {
+			year, month, day := t.Date()
+			buf.WriteByte('[')
+			itoa(buf, year, 4)
+			buf.WriteByte('-') // "[2019-"
+			itoa(buf, int(month), 2)
+			buf.WriteByte('-') // "[2019-04-"
+			itoa(buf, day, 2)
+			buf.WriteByte(' ') // "[2019-04-11 "
+		}
+
+		//时钟位被标记
+		if flag&(BitTime|BitMicroSeconds) != 0 {
+			hour, min, sec := t.Clock()
+			itoa(buf, hour, 2)
+			buf.WriteByte(':') // "11:"
+			itoa(buf, min, 2)
+			buf.WriteByte(':') // "11:15:"
+			itoa(buf, sec, 2)  // "11:15:33"
+			//微秒被标记
+			if flag&BitMicroSeconds != 0 {
+				buf.WriteByte('.')
+				itoa(buf, t.Nanosecond()/1e3, 6) // "11:15:33.123123
+			}
+			buf.WriteByte(']')
+			buf.WriteByte(' ')
+		}
+
+		// 日志级别位被标记
+		if flag&BitLevel != 0 {
+			buf.WriteString(levels[e.Level])
+		}
+		buf.WriteByte(' ')
+
+		//日志当前代码调用文件名名称位被标记
+		if flag&(BitShortFile|BitLongFile) != 0 {
+			//短文件名称
+			if flag&BitShortFile != 0 {
+				file = shortFile(file)
+			}
+			buf.WriteString(file)
+			buf.WriteByte(':')
+			itoa(buf, e.Line, -1) //行数
+			buf.WriteString(": ")
+		}
+	}
+}
+
+// formatJSON
+//
+//	@Description: json模式, 头部标记位决定输出 time/level/caller 字段
+//	@param buf 缓冲区
+//	@param e 日志
+func formatJSON(buf *bytes.Buffer, e *Entry) {
+	flag, file := e.Flag, e.File
+	start := buf.Len()
+	buf.WriteByte('{')
+	if flag&(BitDate|BitTime|BitMicroSeconds) != 0 {
+		var layout []string
+		if flag&BitDate != 0 {
+			layout = append(layout, time.DateOnly)
+		}
+		if flag&BitMicroSeconds != 0 {
+			layout = append(layout, "15:04:05.000000")
+		} else if flag&BitTime != 0 {
+			layout = append(layout, time.TimeOnly)
+		}
+		writeJSONField(buf, start, "time", e.Time.Format(strings.Join(layout, " ")))
+	}
+	if flag&BitLevel != 0 {
+		writeJSONField(buf, start, "level", strings.Trim(levels[e.Level], "[]"))
+	}
+	if flag&(BitShortFile|BitLongFile) != 0 {
+		if flag&BitShortFile != 0 {
+			file = shortFile(file)
+		}
+		writeJSONField(buf, start, "caller", file+":"+strconv.Itoa(e.Line))
+	}
+	writeJSONField(buf, start, "msg", strings.TrimRight(e.Message, "\n"))
+	for _, field := range e.Fields {
+		writeJSONField(buf, start, field.Key, jsonValue(field.Value))
+	}
+	buf.WriteString("}\n")
+}
+
+func writeJSONField(buf *bytes.Buffer, start int, key string, value interface{}) {
+	if buf.Len() > start+1 {
+		buf.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(v)
+}
+
+// jsonValue
+//
+//	@Description: error/Stringer 等类型按字符串输出
+//	@param v 字段值
+//	@return interface{}
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return v
+}
+
+// shortFile
+//
+//	@Description: 最后一个'/'之后的文件名称
+//	@param file 完整文件名
+//	@return string
+func shortFile(file string) string {
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			return file[i+1:]
+		}
+	}
+	return file
+}
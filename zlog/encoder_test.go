@@ -0,0 +1,106 @@
+package zlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stringer 测试Stringer字段
+type stringer struct{}
+
+func (stringer) String() string {
+	return "stringer"
+}
+
+func TestEncode(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	fields := []zlog.Field{{Key: "session", Value: 7}, {Key: "err", Value: errors.New("io: closed")}, {Key: "empty", Value: ""}}
+	cases := []struct {
+		name    string
+		encoder int
+		flag    int
+		message string
+		fields  []zlog.Field
+		want    string
+	}{
+		{"text plain", zlog.EncoderText, 0, "hello\n", nil, "hello\n"},
+		{"text no newline", zlog.EncoderText, 0, "hello", nil, "hello\n"},
+		{"text header", zlog.EncoderText, zlog.BitDate | zlog.BitMicroSeconds | zlog.BitLevel | zlog.BitShortFile, "hello\n", nil,
+			"[2024-05-06 07:08:09.123456] [WARN] gate.go:42: hello\n"},
+		{"text long file", zlog.EncoderText, zlog.BitTime | zlog.BitLongFile, "hello", nil, "07:08:09]  /src/net/gate.go:42: hello\n"},
+		{"text fields", zlog.EncoderText, 0, "login\n", fields, `login session=7 err="io: closed" empty=""` + "\n"},
+		{"text quoted field", zlog.EncoderText, 0, "x", []zlog.Field{{Key: "q", Value: `a"b`}, {Key: "eq", Value: "k=v"}, {Key: "s", Value: stringer{}}},
+			`x q="a\"b" eq="k=v" s=stringer` + "\n"},
+		{"json plain", zlog.EncoderJSON, 0, "hello\n", nil, `{"msg":"hello"}` + "\n"},
+		{"json header", zlog.EncoderJSON, zlog.BitDate | zlog.BitTime | zlog.BitLevel | zlog.BitShortFile, "hello", nil,
+			`{"time":"2024-05-06 07:08:09","level":"WARN","caller":"gate.go:42","msg":"hello"}` + "\n"},
+		{"json micro", zlog.EncoderJSON, zlog.BitMicroSeconds | zlog.BitLongFile, "hello", nil,
+			`{"time":"07:08:09.123456","caller":"/src/net/gate.go:42","msg":"hello"}` + "\n"},
+		{"json fields", zlog.EncoderJSON, 0, "login\n", append(fields, zlog.Field{Key: "s", Value: stringer{}}),
+			`{"msg":"login","session":7,"err":"io: closed","empty":"","s":"stringer"}` + "\n"},
+		{"json escape", zlog.EncoderJSON, 0, "a \"quoted\"\nline\n", []zlog.Field{{Key: "k\"", Value: []int{1, 2}}},
+			`{"msg":"a \"quoted\"\nline","k\"":[1,2]}` + "\n"},
+		{"json unsupported value", zlog.EncoderJSON, 0, "x", []zlog.Field{{Key: "f", Value: func() {}}}, ""},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		zlog.Encode(&buf, &zlog.Entry{Time: at, Level: zlog.LogWarn, File: "/src/net/gate.go", Line: 42, Message: c.message, Fields: c.fields, Flag: c.flag}, c.encoder)
+		got := buf.String()
+		if c.encoder == zlog.EncoderJSON {
+			var v map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &v); err != nil || !strings.HasSuffix(got, "}\n") {
+				t.Errorf("%s: invalid json line %q: %v", c.name, got, err)
+				continue
+			}
+		}
+		if c.want != "" && got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	log := zlog.NewZLog(0)
+	log.SetOutput(io.Discard)
+	var out bytes.Buffer
+	log.AddSink(zlog.NewWriterSink(&out, zlog.LogDebug, zlog.EncoderText))
+
+	// 落单的值使用!BADKEY, 非字符串的key转为字符串
+	log.With("session", 1, 2, "x", "dangling").Info("odd")
+	if got, want := out.String(), "odd session=1 2=x !BADKEY=dangling\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// 追加字段不影响原来的日志对象, 兄弟对象之间互不影响
+	out.Reset()
+	base := log.With("a", 1)
+	left := base.With("b", 2)
+	right := base.With("c", 3)
+	base.Info("base")
+	left.Info("left")
+	right.Info("right")
+	if got, want := out.String(), "base a=1\nleft a=1 b=2\nright a=1 c=3\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if n := len(base.Fields()); n != 1 {
+		t.Fatalf("base has %d fields, want 1", n)
+	}
+
+	// 包级别的With写到默认日志
+	capture, stop := zlog.StartCapture()
+	defer stop()
+	zlog.With("user", "u1").Warnf("kicked %d", 1)
+	entry := capture.Find(zlog.LogWarn, "kicked 1")
+	if entry == nil {
+		t.Fatalf("not captured: %q", capture.Messages())
+	}
+	if user, _ := entry.Field("user"); user != "u1" {
+		t.Fatalf("field user = %v", user)
+	}
+}
@@ -0,0 +1,186 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileBufferSize 文件写入缓冲大小, 每批日志写完后Flush
+const fileBufferSize = 64 << 10
+
+// FileSink
+// @Description: 按日期和大小拆分的文件输出
+type FileSink struct {
+	sinkBase
+	mu     sync.Mutex    // 保护文件状态, 确保多协程写文件时内容不混乱
+	buf    bytes.Buffer  // 编码缓冲区
+	path   string        // 日志路径
+	date   string        // 日期字符串
+	index  int           // 当天的文件序号
+	size   int64         // 当前文件大小(含未落地的缓冲)
+	file   *os.File      // 当前日志绑定的输出文件
+	out    *bufio.Writer // 文件写缓冲
+	rotate RotateConfig  // 日志拆分与保留
+}
+
+// NewFileSink
+//
+//	@Description: 创建文件输出, 首次写入时打开文件
+//	@param path 日志目录, 为空时不写文件, 输出到标准错误
+//	@param rotate 拆分与保留策略
+//	@param level 最低级别
+//	@param encoder 编码
+//	@return *FileSink
+func NewFileSink(path string, rotate RotateConfig, level int, encoder int) *FileSink {
+	s := &FileSink{
+		path:   path,
+		date:   time.Now().Format(time.DateOnly),
+		rotate: rotate,
+	}
+	s.SetLevel(level)
+	s.SetEncoder(encoder)
+	return s
+}
+
+func (s *FileSink) Write(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	Encode(&s.buf, e, int(s.encoder.Load()))
+	s.openFile(s.buf.Len())
+	if s.out == nil {
+		_, err := os.Stderr.Write(s.buf.Bytes())
+		return err
+	}
+	n, err := s.out.Write(s.buf.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.out == nil {
+		return nil
+	}
+	return s.out.Flush()
+}
+
+// Sync
+//
+//	@Description: 落地缓冲并同步到磁盘
+//	@receiver s
+//	@return error
+func (s *FileSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	_ = s.out.Flush()
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeFile()
+	return nil
+}
+
+// SetPath
+//
+//	@Description: 设置日志路径, 路径变化时关闭当前文件, 下次写入在新路径打开
+//	@receiver s
+//	@param path 路径, 为空时输出到标准错误
+func (s *FileSink) SetPath(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == path {
+		return
+	}
+	s.path = path
+	s.closeFile()
+}
+
+// SetRotate
+//
+//	@Description: 设置日志拆分与保留策略
+//	@receiver s
+//	@param cfg 配置
+func (s *FileSink) SetRotate(cfg RotateConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotate = cfg
+}
+
+// openFile
+//
+//	@Description: 打开日志文件输出(自动判定日期和文件大小进行拆分)
+//	@receiver s
+//	@param pending 即将写入的字节数
+func (s *FileSink) openFile(pending int) {
+	if s.path == "" && s.file == nil {
+		return
+	}
+	dateStr := time.Now().Format(time.DateOnly)
+	oversize := s.rotate.MaxSize > 0 && s.size > 0 && s.size+int64(pending) > s.rotate.MaxSize
+	if s.file != nil && s.date == dateStr && !oversize {
+		return
+	}
+	rotated := ""
+	if s.file != nil {
+		rotated = s.file.Name()
+	}
+	if s.file == nil || s.date != dateStr {
+		s.date = dateStr
+		s.index = lastSegment(s.path, dateStr)
+	} else {
+		s.index++
+	}
+	s.closeFile()
+
+	fullPath, err := segmentPath(s.path, s.date, s.index)
+	if err != nil {
+		return
+	}
+	//创建日志文件夹
+	_ = mkdirLog(s.path)
+
+	file, err := os.OpenFile(fullPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	s.size = 0
+	if info, err := file.Stat(); err == nil {
+		s.size = info.Size()
+	}
+	s.file = file
+	s.out = bufio.NewWriterSize(file, fileBufferSize)
+
+	if rotated != "" {
+		go afterRotate(s.path, rotated, fullPath, s.rotate)
+	}
+}
+
+// closeFile
+//
+//	@Description: 落地缓冲并关闭日志绑定的文件
+//	@receiver s
+func (s *FileSink) closeFile() {
+	if s.file != nil {
+		_ = s.out.Flush()
+		_ = s.file.Close()
+		s.file = nil
+		s.out = nil
+	}
+}
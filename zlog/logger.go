@@ -0,0 +1,157 @@
+package zlog
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// ZLogger
+// @Description: 带附加字段的日志对象, 输出时字段追加在内容之后
+type ZLogger struct {
+	core   *ZLoggerCore // 日志核心
+	module *ZLogModule  // 所属模块, 为空时使用全局级别
+	fields []Field      // 附加字段
+}
+
+// loggerCallDepth ZLogger的输出方法直接调用output, 调用层数固定为2
+const loggerCallDepth = 2
+
+// With
+//
+//	@Description: 创建带附加字段的日志对象
+//	@receiver log
+//	@param kv 键值对: key, value, key, value...
+//	@return *ZLogger
+func (log *ZLoggerCore) With(kv ...interface{}) *ZLogger {
+	return &ZLogger{core: log, fields: makeFields(kv)}
+}
+
+// With
+//
+//	@Description: 在当前字段基础上追加字段
+//	@receiver l
+//	@param kv 键值对
+//	@return *ZLogger
+func (l *ZLogger) With(kv ...interface{}) *ZLogger {
+	fields := make([]Field, 0, len(l.fields)+(len(kv)+1)/2)
+	fields = append(fields, l.fields...)
+	fields = append(fields, makeFields(kv)...)
+	return &ZLogger{core: l.core, module: l.module, fields: fields}
+}
+
+// Enabled
+//
+//	@Description: 该级别的日志是否会输出, 模块设置了级别时以模块为准
+//	@receiver l
+//	@param level 日志级别
+//	@return bool
+func (l *ZLogger) Enabled(level int) bool {
+	if l.module != nil {
+		if moduleLevel := l.module.level.Load(); moduleLevel != LevelInherit {
+			return int32(level) >= moduleLevel
+		}
+	}
+	return l.core.Enabled(level)
+}
+
+// Fields
+//
+//	@Description: 当前附加字段
+//	@receiver l
+//	@return []Field
+func (l *ZLogger) Fields() []Field {
+	return l.fields
+}
+
+func (l *ZLogger) Debugf(format string, v ...interface{}) {
+	if !l.Enabled(LogDebug) || !l.core.sample(loggerCallDepth, LogDebug, format) {
+		return
+	}
+	_ = l.core.output(loggerCallDepth, LogDebug, fmt.Sprintf(format, v...), l.fields)
+}
+
+func (l *ZLogger) Debug(v ...interface{}) {
+	if !l.Enabled(LogDebug) || !l.core.sample(loggerCallDepth, LogDebug, "") {
+		return
+	}
+	_ = l.core.output(loggerCallDepth, LogDebug, fmt.Sprintln(v...), l.fields)
+}
+
+func (l *ZLogger) Infof(format string, v ...interface{}) {
+	if !l.Enabled(LogInfo) || !l.core.sample(loggerCallDepth, LogInfo, format) {
+		return
+	}
+	_ = l.core.output(loggerCallDepth, LogInfo, fmt.Sprintf(format, v...), l.fields)
+}
+
+func (l *ZLogger) Info(v ...interface{}) {
+	if !l.Enabled(LogInfo) || !l.core.sample(loggerCallDepth, LogInfo, "") {
+		return
+	}
+	_ = l.core.output(loggerCallDepth, LogInfo, fmt.Sprintln(v...), l.fields)
+}
+
+func (l *ZLogger) Warnf(format string, v ...interface{}) {
+	if !l.Enabled(LogWarn) || !l.core.sample(loggerCallDepth, LogWarn, format) {
+		return
+	}
+	_ = l.core.output(loggerCallDepth, LogWarn, fmt.Sprintf(format, v...), l.fields)
+}
+
+func (l *ZLogger) Warn(v ...interface{}) {
+	if !l.Enabled(LogWarn) || !l.core.sample(loggerCallDepth, LogWarn, "") {
+		return
+	}
+	_ = l.core.output(loggerCallDepth, LogWarn, fmt.Sprintln(v...), l.fields)
+}
+
+func (l *ZLogger) Errorf(format string, v ...interface{}) {
+	if !l.Enabled(LogError) || !l.core.sample(loggerCallDepth, LogError, format) {
+		return
+	}
+	_ = l.core.output(loggerCallDepth, LogError, fmt.Sprintf(format, v...), l.fields)
+}
+
+func (l *ZLogger) Error(v ...interface{}) {
+	if !l.Enabled(LogError) || !l.core.sample(loggerCallDepth, LogError, "") {
+		return
+	}
+	_ = l.core.output(loggerCallDepth, LogError, fmt.Sprintln(v...), l.fields)
+}
+
+func (l *ZLogger) Fatalf(format string, v ...interface{}) {
+	_ = l.core.output(loggerCallDepth, LogFatal, fmt.Sprintf(format, v...), l.fields)
+	l.core.Flush()
+	os.Exit(1)
+}
+
+func (l *ZLogger) Fatal(v ...interface{}) {
+	_ = l.core.output(loggerCallDepth, LogFatal, fmt.Sprintln(v...), l.fields)
+	l.core.Flush()
+	os.Exit(1)
+}
+
+func (l *ZLogger) Panicf(format string, v ...interface{}) {
+	s := fmt.Sprintf(format, v...)
+	_ = l.core.output(loggerCallDepth, LogPanic, s, l.fields)
+	l.core.Flush()
+	panic(s)
+}
+
+func (l *ZLogger) Panic(v ...interface{}) {
+	s := fmt.Sprintln(v...)
+	_ = l.core.output(loggerCallDepth, LogPanic, s, l.fields)
+	l.core.Flush()
+	panic(s)
+}
+
+func (l *ZLogger) Stack(v ...interface{}) {
+	s := fmt.Sprint(v...)
+	s += "\n"
+	buf := make([]byte, LogMaxBuf)
+	n := runtime.Stack(buf, true) //得到当前堆栈信息
+	s += string(buf[:n])
+	s += "\n"
+	_ = l.core.output(loggerCallDepth, LogError, s, l.fields)
+}
@@ -0,0 +1,102 @@
+package zlog
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// LevelInherit 模块未单独设置级别时沿用全局级别
+const LevelInherit = -1
+
+// ZLogModule
+// @Description: 模块日志级别, 可单独覆盖全局级别
+type ZLogModule struct {
+	name  string       // 模块名
+	level atomic.Int32 // 模块级别, LevelInherit为沿用全局
+}
+
+// Module
+//
+//	@Description: 获取模块日志对象, 输出时带 module 字段, 级别可用 SetModuleLevel 单独设置
+//	@receiver log
+//	@param name 模块名(net/session/codec/config...)
+//	@return *ZLogger
+func (log *ZLoggerCore) Module(name string) *ZLogger {
+	return &ZLogger{
+		core:   log,
+		module: log.module(name),
+		fields: []Field{{Key: "module", Value: name}},
+	}
+}
+
+func (log *ZLoggerCore) module(name string) *ZLogModule {
+	m := &ZLogModule{name: name}
+	m.level.Store(LevelInherit)
+	actual, _ := log.modules.LoadOrStore(name, m)
+	return actual.(*ZLogModule)
+}
+
+// SetModuleLevel
+//
+//	@Description: 设置模块级别, LevelInherit 恢复沿用全局级别
+//	@receiver log
+//	@param name 模块名
+//	@param level 日志级别
+func (log *ZLoggerCore) SetModuleLevel(name string, level int) {
+	log.module(name).level.Store(int32(level))
+}
+
+// ResetModuleLevels
+//
+//	@Description: 全部模块恢复沿用全局级别
+//	@receiver log
+func (log *ZLoggerCore) ResetModuleLevels() {
+	log.modules.Range(func(key, value interface{}) bool {
+		value.(*ZLogModule).level.Store(LevelInherit)
+		return true
+	})
+}
+
+// ModuleLevels
+//
+//	@Description: 已单独设置级别的模块
+//	@receiver log
+//	@return map[string]int
+func (log *ZLoggerCore) ModuleLevels() map[string]int {
+	levels := map[string]int{}
+	log.modules.Range(func(key, value interface{}) bool {
+		if level := value.(*ZLogModule).level.Load(); level != LevelInherit {
+			levels[key.(string)] = int(level)
+		}
+		return true
+	})
+	return levels
+}
+
+// ParseLevel
+//
+//	@Description: 解析级别名称(debug/info/warn/error/panic/fatal)
+//	@param name 级别名称
+//	@return int
+//	@return error
+func ParseLevel(name string) (int, error) {
+	for level, str := range levels {
+		if strings.EqualFold("["+name+"]", str) {
+			return level, nil
+		}
+	}
+	return LogDebug, fmt.Errorf("unknown log level %q", name)
+}
+
+// LevelName
+//
+//	@Description: 级别名称
+//	@param level 日志级别
+//	@return string
+func LevelName(level int) string {
+	if level < 0 || level >= len(levels) {
+		return "unknown"
+	}
+	return strings.ToLower(strings.Trim(levels[level], "[]"))
+}
@@ -0,0 +1,138 @@
+package zlog_test
+
+import (
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestLevel(t *testing.T) {
+	log := zlog.NewZLog(0)
+	log.SetOutput(io.Discard)
+	capture := zlog.NewCapture(zlog.LogDebug)
+	log.AddSink(capture)
+
+	// 低于全局级别的日志不输出
+	log.SetLevel(zlog.LogWarn)
+	log.Debug("debug")
+	log.Info("info")
+	log.Warn("warn")
+	log.Error("error")
+	if got := capture.Messages(); !reflect.DeepEqual(got, []string{"warn", "error"}) {
+		t.Fatalf("logged %q", got)
+	}
+	if log.Enabled(zlog.LogInfo) || !log.Enabled(zlog.LogWarn) || log.Level() != zlog.LogWarn {
+		t.Fatal("Enabled does not follow the level")
+	}
+
+	// CloseDebug只在Debug级别时提升到Info, 不降低已设置的级别
+	log.CloseDebug()
+	if log.Level() != zlog.LogWarn {
+		t.Fatalf("CloseDebug changed level to %d", log.Level())
+	}
+	log.OpenDebug()
+	log.CloseDebug()
+	if log.Level() != zlog.LogInfo {
+		t.Fatalf("CloseDebug set level %d, want info", log.Level())
+	}
+}
+
+func TestModuleLevel(t *testing.T) {
+	log := zlog.NewZLog(0)
+	log.SetOutput(io.Discard)
+	capture := zlog.NewCapture(zlog.LogDebug)
+	log.AddSink(capture)
+	net := log.Module("net")
+	session := log.Module("session").With("session", 7)
+
+	// 模块默认沿用全局级别, 运行中修改全局级别立即生效
+	log.SetLevel(zlog.LogInfo)
+	net.Debug("net debug")
+	net.Info("net info")
+	if got := capture.Messages(); !reflect.DeepEqual(got, []string{"net info"}) {
+		t.Fatalf("logged %q", got)
+	}
+	entry := capture.Find(zlog.LogInfo, "net info")
+	if module, _ := entry.Field("module"); module != "net" {
+		t.Fatalf("module field %v", module)
+	}
+
+	// 模块级别可高于或低于全局级别, 同名模块共用级别, With得到的日志对象沿用模块级别
+	capture.Reset()
+	log.SetModuleLevel("net", zlog.LogError)
+	log.SetModuleLevel("session", zlog.LogDebug)
+	net.Warn("net warn")
+	log.Module("net").Warn("net warn again")
+	session.Debug("session debug")
+	log.Debug("global debug")
+	if got := capture.Messages(); !reflect.DeepEqual(got, []string{"session debug"}) {
+		t.Fatalf("logged %q", got)
+	}
+	if levels := log.ModuleLevels(); !reflect.DeepEqual(levels, map[string]int{"net": zlog.LogError, "session": zlog.LogDebug}) {
+		t.Fatalf("module levels %v", levels)
+	}
+
+	// 恢复后重新沿用全局级别
+	capture.Reset()
+	log.SetModuleLevel("session", zlog.LevelInherit)
+	if levels := log.ModuleLevels(); !reflect.DeepEqual(levels, map[string]int{"net": zlog.LogError}) {
+		t.Fatalf("module levels after inherit %v", levels)
+	}
+	log.ResetModuleLevels()
+	net.Warn("net warn")
+	session.Debug("session debug")
+	if got := capture.Messages(); !reflect.DeepEqual(got, []string{"net warn"}) || len(log.ModuleLevels()) != 0 {
+		t.Fatalf("logged %q after reset, levels %v", got, log.ModuleLevels())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]int{"debug": zlog.LogDebug, "INFO": zlog.LogInfo, "Warn": zlog.LogWarn, "error": zlog.LogError, "panic": zlog.LogPanic, "fatal": zlog.LogFatal} {
+		level, err := zlog.ParseLevel(name)
+		if err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %d, %v; want %d", name, level, err, want)
+		}
+	}
+	for _, name := range []string{"", "warning", "[warn]"} {
+		if _, err := zlog.ParseLevel(name); err == nil {
+			t.Errorf("ParseLevel(%q) succeeded", name)
+		}
+	}
+	if zlog.LevelName(zlog.LogWarn) != "warn" || zlog.LevelName(-1) != "unknown" || zlog.LevelName(100) != "unknown" {
+		t.Error("unexpected level names")
+	}
+}
+
+func TestLevelConcurrent(t *testing.T) {
+	log := zlog.NewZLog(0)
+	log.SetOutput(io.Discard)
+	net := log.Module("net")
+
+	// 运行中修改级别与输出并发, 用 -race 检查
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				log.SetLevel((i + j) % zlog.LogPanic)
+				log.SetModuleLevel("net", (i+j)%zlog.LogPanic)
+				if j%50 == 0 {
+					log.ResetModuleLevels()
+					log.CloseDebug()
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				net.Info("net")
+				log.Debug("debug")
+				_ = log.ModuleLevels()
+			}
+		}()
+	}
+	wg.Wait()
+}
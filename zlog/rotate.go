@@ -0,0 +1,206 @@
+package zlog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RotateConfig
+// @Description: 日志拆分与保留配置, 零值表示不限制
+type RotateConfig struct {
+	MaxSize    int64         // 单个文件最大字节数, 超过后按序号拆分(2006-01-02.1.log)
+	MaxAge     time.Duration // 保留时长, 按文件修改时间
+	MaxBackups int           // 保留的历史文件数量(不含当前文件)
+	Compress   bool          // 后台gzip压缩已拆分的文件
+}
+
+// segmentPattern 日志文件名: 日期[.序号].log[.gz]
+var segmentPattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})(?:\.(\d+))?\.log(\.gz)?$`)
+
+// cleanLock 保证同一时间只有一个清理任务
+var cleanLock sync.Mutex
+
+// errEmptyLogDir 未设置日志目录, 不能拼出文件路径
+var errEmptyLogDir = errors.New("zlog: empty log dir")
+
+// segmentPath
+//
+//	@Description: 日志分段文件路径, 序号为0时沿用 日期.log
+//	@param dir 日志目录, 为空时返回错误, 避免写到根目录
+//	@param date 日期
+//	@param index 序号
+//	@return string
+//	@return error
+func segmentPath(dir, date string, index int) (string, error) {
+	if dir == "" {
+		return "", errEmptyLogDir
+	}
+	if index == 0 {
+		return filepath.Join(dir, date+".log"), nil
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.%d.log", date, index)), nil
+}
+
+// lastSegment
+//
+//	@Description: 查找当天已存在的最大序号, 重启后继续写入
+//	@param dir 日志目录
+//	@param date 日期
+//	@return int
+func lastSegment(dir, date string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	last := 0
+	for _, entry := range entries {
+		if seg, ok := parseSegment(entry.Name()); ok && seg.date == date && seg.index > last {
+			last = seg.index
+		}
+	}
+	return last
+}
+
+// afterRotate
+//
+//	@Description: 文件拆分后的后台任务: 压缩并清理过期文件
+//	@param dir 日志目录
+//	@param rotated 已拆分的文件
+//	@param current 当前写入的文件
+//	@param cfg 配置
+func afterRotate(dir, rotated, current string, cfg RotateConfig) {
+	cleanLock.Lock()
+	defer cleanLock.Unlock()
+
+	if cfg.Compress && rotated != "" {
+		// 文件可能已被之前的清理任务删除
+		if err := compressFile(rotated); err != nil && !os.IsNotExist(err) {
+			_, _ = fmt.Fprintf(os.Stderr, "zlog compress %s error: %v\n", rotated, err)
+		}
+	}
+	cleanSegments(dir, current, cfg)
+}
+
+// compressFile
+//
+//	@Description: gzip压缩文件, 成功后删除原文件
+//	@param path 文件路径
+//	@return error
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// segment
+// @Description: 一个日志分段文件
+type segment struct {
+	path    string    // 文件路径
+	date    string    // 日期
+	index   int       // 当天的序号
+	modTime time.Time // 修改时间
+}
+
+// parseSegment
+//
+//	@Description: 解析日志分段文件名
+//	@param name 文件名
+//	@return segment
+//	@return bool 是否为日志文件
+func parseSegment(name string) (segment, bool) {
+	match := segmentPattern.FindStringSubmatch(name)
+	if match == nil {
+		return segment{}, false
+	}
+	seg := segment{date: match[1]}
+	if match[2] != "" {
+		seg.index, _ = strconv.Atoi(match[2])
+	}
+	return seg, true
+}
+
+// newer
+//
+//	@Description: 是否比另一个分段更新, 按日期和序号比较, 不受修改时间精度影响
+//	@receiver s
+//	@param other 另一个分段
+//	@return bool
+func (s segment) newer(other segment) bool {
+	if s.date != other.date {
+		return s.date > other.date
+	}
+	return s.index > other.index
+}
+
+// cleanSegments
+//
+//	@Description: 按保留时长和数量删除历史日志
+//	@param dir 日志目录
+//	@param current 拆分后写入的文件, 它和之后拆分出的文件都不删除
+//	@param cfg 配置
+func cleanSegments(dir, current string, cfg RotateConfig) {
+	if cfg.MaxAge <= 0 && cfg.MaxBackups <= 0 {
+		return
+	}
+	cur, ok := parseSegment(filepath.Base(current))
+	if !ok {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var segments []segment
+	for _, entry := range entries {
+		seg, ok := parseSegment(entry.Name())
+		// 清理任务在后台执行, 执行时可能已经又拆分过
+		if !ok || !cur.newer(seg) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		seg.path = filepath.Join(dir, entry.Name())
+		seg.modTime = info.ModTime()
+		segments = append(segments, seg)
+	}
+	// 新的在前
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].newer(segments[j])
+	})
+	deadline := time.Now().Add(-cfg.MaxAge)
+	for i, seg := range segments {
+		if (cfg.MaxBackups > 0 && i >= cfg.MaxBackups) || (cfg.MaxAge > 0 && seg.modTime.Before(deadline)) {
+			_ = os.Remove(seg.path)
+		}
+	}
+}
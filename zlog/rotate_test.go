@@ -0,0 +1,160 @@
+package zlog_test
+
+import (
+	"compress/gzip"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rotateLine 每行日志的内容, 加上换行正好40字节
+var rotateLine = strings.Repeat("x", 39) + "\n"
+
+// writeLines 通过文件输出写入n行并落地
+func writeLines(t *testing.T, sink *zlog.FileSink, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := sink.Write(&zlog.Entry{Level: zlog.LogInfo, Message: rotateLine}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listLogs 目录下的日志文件名, 按名称排序
+func listLogs(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waitLogs 等待后台压缩和清理完成, 目录下的文件满足条件
+func waitLogs(t *testing.T, dir string, cond func(names []string) bool) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		names := listLogs(t, dir)
+		if cond(names) {
+			return names
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected log files: %v", names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Now().Format(time.DateOnly)
+	sink := zlog.NewFileSink(dir, zlog.RotateConfig{MaxSize: 100}, zlog.LogDebug, zlog.EncoderText)
+	defer sink.Close()
+
+	// 每个文件最多100字节, 即两行
+	writeLines(t, sink, 5)
+	want := []string{date + ".1.log", date + ".2.log", date + ".log"}
+	names := listLogs(t, dir)
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("log files %v, want %v", names, want)
+	}
+	for name, lines := range map[string]int{date + ".log": 2, date + ".1.log": 2, date + ".2.log": 1} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != lines*len(rotateLine) {
+			t.Errorf("%s has %d bytes, want %d lines", name, len(data), lines)
+		}
+	}
+
+	// 重启后从当天最大的序号继续
+	_ = sink.Close()
+	sink = zlog.NewFileSink(dir, zlog.RotateConfig{MaxSize: 100}, zlog.LogDebug, zlog.EncoderText)
+	writeLines(t, sink, 2)
+	if names = listLogs(t, dir); len(names) != 4 || names[2] != date+".3.log" {
+		t.Fatalf("log files after restart %v", names)
+	}
+}
+
+func TestRotateMaxBackups(t *testing.T) {
+	// 目录带末尾分隔符时当前文件也不能算作历史文件
+	dir := t.TempDir() + string(filepath.Separator)
+	date := time.Now().Format(time.DateOnly)
+	sink := zlog.NewFileSink(dir, zlog.RotateConfig{MaxSize: 100, MaxBackups: 1}, zlog.LogDebug, zlog.EncoderText)
+	defer sink.Close()
+
+	writeLines(t, sink, 10)
+	names := waitLogs(t, dir, func(names []string) bool { return len(names) == 2 })
+	if want := []string{date + ".3.log", date + ".4.log"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("log files %v, want %v", names, want)
+	}
+}
+
+func TestRotateMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-72 * time.Hour)
+	for _, name := range []string{"2020-01-01.log", "2020-01-02.1.log.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sink := zlog.NewFileSink(dir, zlog.RotateConfig{MaxSize: 100, MaxAge: 24 * time.Hour}, zlog.LogDebug, zlog.EncoderText)
+	defer sink.Close()
+
+	// 拆分后删除超过保留时长的日志, 不是日志的文件不动
+	writeLines(t, sink, 3)
+	waitLogs(t, dir, func(names []string) bool {
+		return len(names) == 3 && names[len(names)-1] == "notes.txt" && !strings.HasPrefix(names[0], "2020")
+	})
+}
+
+func TestRotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Now().Format(time.DateOnly)
+	sink := zlog.NewFileSink(dir, zlog.RotateConfig{MaxSize: 100, Compress: true}, zlog.LogDebug, zlog.EncoderText)
+	defer sink.Close()
+
+	// 拆分出的文件压缩后删除原文件, 当前文件不压缩
+	writeLines(t, sink, 3)
+	want := []string{date + ".1.log", date + ".log.gz"}
+	waitLogs(t, dir, func(names []string) bool { return strings.Join(names, ",") == strings.Join(want, ",") })
+
+	file, err := os.Open(filepath.Join(dir, date+".log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != rotateLine+rotateLine {
+		t.Fatalf("compressed content %q", data)
+	}
+}
@@ -0,0 +1,249 @@
+package zlog
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 采样分组方式
+const (
+	SampleByCaller   = iota // 按调用点(文件:行)
+	SampleByTemplate        // 按格式化模板, 非格式化方法(Info等)按调用点
+)
+
+const (
+	DefaultSampleInterval = time.Second      // 默认采样周期
+	DefaultSampleSummary  = 10 * time.Second // 默认抑制汇总间隔
+	sampleSummaryTop      = 10               // 每次汇总最多列出的分组数
+)
+
+// SamplingConfig
+// @Description: 日志采样配置, 每个分组每个周期先输出First条, 之后每Thereafter条输出1条
+type SamplingConfig struct {
+	Interval   time.Duration // 采样周期, <=0时使用默认值
+	First      int           // 每个周期先输出的条数
+	Thereafter int           // 之后每N条输出1条, 0为全部抑制
+	By         int           // 分组方式(SampleByCaller/SampleByTemplate)
+	Summary    time.Duration // 抑制汇总的输出间隔, <=0时使用默认值
+}
+
+// sampleKey 采样分组
+type sampleKey struct {
+	level    int     // 日志级别
+	pc       uintptr // 调用点
+	template string  // 格式化模板
+}
+
+// sampleCounter
+// @Description: 单个分组的计数
+type sampleCounter struct {
+	start      atomic.Int64  // 当前周期开始时间(纳秒)
+	count      atomic.Uint64 // 当前周期计数
+	suppressed atomic.Uint64 // 上次汇总后抑制的条数
+	last       atomic.Int64  // 最近一次出现的时间(纳秒)
+}
+
+// sampler
+// @Description: 日志采样, 后台协程定期输出抑制汇总并清理空闲分组
+type sampler struct {
+	cfg      SamplingConfig
+	counters sync.Map // sampleKey -> *sampleCounter
+	exitChan chan bool
+	done     chan bool
+}
+
+func newSampler(cfg SamplingConfig, summary func(counts []sampleCount)) *sampler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultSampleInterval
+	}
+	if cfg.Summary <= 0 {
+		cfg.Summary = DefaultSampleSummary
+	}
+	s := &sampler{
+		cfg:      cfg,
+		exitChan: make(chan bool),
+		done:     make(chan bool),
+	}
+	go s.run(summary)
+	return s
+}
+
+// allow
+//
+//	@Description: 该分组本次是否输出
+//	@receiver s
+//	@param key 分组
+//	@return bool
+func (s *sampler) allow(key sampleKey) bool {
+	value, ok := s.counters.Load(key)
+	if !ok {
+		value, _ = s.counters.LoadOrStore(key, &sampleCounter{})
+	}
+	c := value.(*sampleCounter)
+
+	now := time.Now().UnixNano()
+	c.last.Store(now)
+	if start := c.start.Load(); now-start >= int64(s.cfg.Interval) && c.start.CompareAndSwap(start, now) {
+		c.count.Store(0)
+	}
+	n := c.count.Add(1)
+	first := uint64(s.cfg.First)
+	if n <= first {
+		return true
+	}
+	if s.cfg.Thereafter > 0 && (n-first)%uint64(s.cfg.Thereafter) == 0 {
+		return true
+	}
+	c.suppressed.Add(1)
+	return false
+}
+
+// sampleCount 汇总中的一个分组
+type sampleCount struct {
+	key   sampleKey
+	count uint64
+}
+
+// run
+//
+//	@Description: 定期汇总抑制条数
+//	@receiver s
+//	@param summary 汇总输出
+func (s *sampler) run(summary func(counts []sampleCount)) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.Summary)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if counts := s.collect(); len(counts) > 0 {
+				summary(counts)
+			}
+		case <-s.exitChan:
+			if counts := s.collect(); len(counts) > 0 {
+				summary(counts)
+			}
+			return
+		}
+	}
+}
+
+// collect
+//
+//	@Description: 取出各分组的抑制条数(从多到少), 并清理一个汇总周期内未出现的分组
+//	@receiver s
+//	@return []sampleCount
+func (s *sampler) collect() []sampleCount {
+	var counts []sampleCount
+	idle := time.Now().Add(-s.cfg.Summary).UnixNano()
+	s.counters.Range(func(key, value interface{}) bool {
+		c := value.(*sampleCounter)
+		if n := c.suppressed.Swap(0); n > 0 {
+			counts = append(counts, sampleCount{key: key.(sampleKey), count: n})
+		} else if c.last.Load() < idle {
+			s.counters.Delete(key)
+		}
+		return true
+	})
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].count > counts[j].count
+	})
+	return counts
+}
+
+// stop
+//
+//	@Description: 输出最后一次汇总后退出
+//	@receiver s
+func (s *sampler) stop() {
+	close(s.exitChan)
+	<-s.done
+}
+
+// sample
+//
+//	@Description: 按采样配置判断本次是否输出, 未开启采样时总是输出
+//	@receiver log
+//	@param callDepth 到日志调用方的调用层数(同output)
+//	@param level 日志级别
+//	@param template 格式化模板, 非格式化方法为空
+//	@return bool
+func (log *ZLoggerCore) sample(callDepth int, level int, template string) bool {
+	s := log.sampler.Load()
+	if s == nil {
+		return true
+	}
+	key := sampleKey{level: level}
+	if s.cfg.By == SampleByTemplate && template != "" {
+		key.template = template
+	} else {
+		var pcs [1]uintptr
+		runtime.Callers(callDepth+1, pcs[:])
+		key.pc = pcs[0]
+	}
+	if s.allow(key) {
+		return true
+	}
+	log.sampled.Add(1)
+	return false
+}
+
+// summarize
+//
+//	@Description: 输出抑制汇总, 条数最多的分组逐条列出
+//	@receiver log
+//	@param counts 各分组抑制条数
+func (log *ZLoggerCore) summarize(counts []sampleCount) {
+	var total uint64
+	for _, c := range counts {
+		total += c.count
+	}
+	_ = log.output(1, LogWarn, "log sampling summary", []Field{
+		{Key: "total", Value: total},
+		{Key: "groups", Value: len(counts)},
+	})
+	if len(counts) > sampleSummaryTop {
+		counts = counts[:sampleSummaryTop]
+	}
+	for _, c := range counts {
+		group := c.key.template
+		if group == "" {
+			frame, _ := runtime.CallersFrames([]uintptr{c.key.pc}).Next()
+			group = shortFile(frame.File) + ":" + strconv.Itoa(frame.Line)
+		}
+		_ = log.output(1, LogWarn, "log sampling suppressed lines", []Field{
+			{Key: "group", Value: group},
+			{Key: "level", Value: LevelName(c.key.level)},
+			{Key: "count", Value: c.count},
+		})
+	}
+}
+
+// SetSampling
+//
+//	@Description: 开启日志采样, cfg为空或First<=0时关闭(关闭前输出最后一次汇总)
+//	@receiver log
+//	@param cfg 配置
+func (log *ZLoggerCore) SetSampling(cfg *SamplingConfig) {
+	var s *sampler
+	if cfg != nil && cfg.First > 0 {
+		s = newSampler(*cfg, log.summarize)
+	}
+	if old := log.sampler.Swap(s); old != nil {
+		old.stop()
+	}
+}
+
+// Suppressed
+//
+//	@Description: 采样抑制的累计行数
+//	@receiver log
+//	@return uint64
+func (log *ZLoggerCore) Suppressed() uint64 {
+	return log.sampled.Load()
+}
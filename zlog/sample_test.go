@@ -0,0 +1,132 @@
+package zlog_test
+
+import (
+	"fmt"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSampledLog 创建开启采样并捕获全部输出的日志
+func newSampledLog(cfg zlog.SamplingConfig) (*zlog.ZLoggerCore, *zlog.Capture) {
+	log := zlog.NewZLog(zlog.BitShortFile)
+	log.SetOutput(io.Discard)
+	capture := zlog.NewCapture(zlog.LogDebug)
+	log.AddSink(capture)
+	log.SetSampling(&cfg)
+	return log, capture
+}
+
+// countMessages 捕获到的某条消息的条数
+func countMessages(capture *zlog.Capture, msg string) int {
+	n := 0
+	for _, e := range capture.Entries() {
+		if strings.TrimRight(e.Message, "\n") == msg {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSamplingFirstThereafter(t *testing.T) {
+	log, capture := newSampledLog(zlog.SamplingConfig{Interval: time.Hour, First: 2, Thereafter: 3, Summary: time.Hour})
+	defer log.Close()
+
+	// 先输出2条, 之后每3条输出1条: 第1、2、5、8条
+	for i := 0; i < 10; i++ {
+		log.Info("hot")
+	}
+	if n := countMessages(capture, "hot"); n != 4 {
+		t.Fatalf("hot logged %d times, want 4", n)
+	}
+	// 不同调用点分别计数
+	log.Info("cold")
+	log.Info("cold")
+	if n := countMessages(capture, "cold"); n != 2 {
+		t.Fatalf("cold logged %d times, want 2", n)
+	}
+	if log.Suppressed() != 6 {
+		t.Fatalf("suppressed %d, want 6", log.Suppressed())
+	}
+}
+
+func TestSamplingThereafterZero(t *testing.T) {
+	log, capture := newSampledLog(zlog.SamplingConfig{Interval: 50 * time.Millisecond, First: 1, Summary: time.Hour})
+	defer log.Close()
+
+	// Thereafter为0时周期内只输出First条, 新周期重新计数
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 5; i++ {
+			log.Warn("burst")
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+	if n := countMessages(capture, "burst"); n != 2 {
+		t.Fatalf("burst logged %d times, want 2", n)
+	}
+}
+
+func TestSamplingByTemplate(t *testing.T) {
+	log, capture := newSampledLog(zlog.SamplingConfig{Interval: time.Hour, First: 1, By: zlog.SampleByTemplate, Summary: time.Hour})
+	defer log.Close()
+
+	// 按模板分组时不同调用点共用计数, 不同级别分别计数
+	log.Infof("user %d login", 1)
+	log.Infof("user %d login", 2)
+	log.Warnf("user %d login", 3)
+	var messages []string
+	for _, e := range capture.Entries() {
+		messages = append(messages, strings.TrimRight(e.Message, "\n"))
+	}
+	if strings.Join(messages, ",") != "user 1 login,user 3 login" {
+		t.Fatalf("logged %q", messages)
+	}
+}
+
+func TestSamplingSummary(t *testing.T) {
+	log, capture := newSampledLog(zlog.SamplingConfig{Interval: time.Hour, First: 1, Summary: time.Hour})
+	for i := 0; i < 5; i++ {
+		log.Error("repeated")
+	}
+	for i := 0; i < 2; i++ {
+		log.Infof("other %d", i)
+	}
+
+	// 关闭采样时输出最后一次汇总: 总数和按抑制条数排序的分组
+	log.SetSampling(nil)
+	summary := capture.Find(zlog.LogWarn, "log sampling summary")
+	if summary == nil {
+		t.Fatalf("no summary in %q", capture.Messages())
+	}
+	for key, want := range map[string]string{"total": "5", "groups": "2"} {
+		if value, _ := summary.Field(key); fmt.Sprint(value) != want {
+			t.Errorf("summary %s = %v, want %s", key, value, want)
+		}
+	}
+	var groups []string
+	for _, e := range capture.Entries() {
+		if e.Message != "log sampling suppressed lines" {
+			continue
+		}
+		group, _ := e.Field("group")
+		level, _ := e.Field("level")
+		count, _ := e.Field("count")
+		groups = append(groups, fmt.Sprintf("%v %v %v", group, level, count))
+	}
+	if len(groups) != 2 || !strings.HasPrefix(groups[0], "sample_test.go:") || !strings.HasSuffix(groups[0], " error 4") ||
+		!strings.HasSuffix(groups[1], " info 1") {
+		t.Fatalf("summary groups %q", groups)
+	}
+
+	// 关闭后不再抑制
+	capture.Reset()
+	for i := 0; i < 3; i++ {
+		log.Error("repeated")
+	}
+	if n := countMessages(capture, "repeated"); n != 3 {
+		t.Fatalf("logged %d after sampling off, want 3", n)
+	}
+	log.Close()
+}
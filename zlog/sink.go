@@ -0,0 +1,206 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ISink
+// @Description: 日志输出, 日志核心将每条日志分发给所有输出, 各输出按自己的级别和编码写入
+type ISink interface {
+	// Enabled 该级别的日志是否写入此输出
+	Enabled(level int) bool
+	// Write 写入一条日志, 可以先缓存, 由Flush落地
+	Write(e *Entry) error
+	// Flush 落地已缓存的日志
+	Flush() error
+	// Close 关闭输出
+	Close() error
+}
+
+// sinkBase
+// @Description: 输出公共的级别与编码设置, 可在运行中修改
+type sinkBase struct {
+	level   atomic.Int32 // 最低输出级别
+	encoder atomic.Int32 // 输出编码
+}
+
+func (b *sinkBase) Enabled(level int) bool {
+	return int32(level) >= b.level.Load()
+}
+
+// SetLevel
+//
+//	@Description: 设置此输出的最低级别
+//	@receiver b
+//	@param level 日志级别
+func (b *sinkBase) SetLevel(level int) {
+	b.level.Store(int32(level))
+}
+
+// SetEncoder
+//
+//	@Description: 设置此输出的编码
+//	@receiver b
+//	@param encoder EncoderText/EncoderJSON
+func (b *sinkBase) SetEncoder(encoder int) {
+	b.encoder.Store(int32(encoder))
+}
+
+// WriterSink
+// @Description: 输出到任意io.Writer, 如标准输出/标准错误
+type WriterSink struct {
+	sinkBase
+	mu  sync.Mutex   // 保护缓冲区和写入
+	buf bytes.Buffer // 编码缓冲区
+	out io.Writer    // 输出目标
+}
+
+// NewWriterSink
+//
+//	@Description: 创建io.Writer输出
+//	@param out 输出目标
+//	@param level 最低级别
+//	@param encoder 编码
+//	@return *WriterSink
+func NewWriterSink(out io.Writer, level int, encoder int) *WriterSink {
+	s := &WriterSink{out: out}
+	s.SetLevel(level)
+	s.SetEncoder(encoder)
+	return s
+}
+
+func (s *WriterSink) Write(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	Encode(&s.buf, e, int(s.encoder.Load()))
+	_, err := s.out.Write(s.buf.Bytes())
+	return err
+}
+
+func (s *WriterSink) Flush() error {
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// RingSink
+// @Description: 内存环形输出, 保留最近的N条日志, 用于测试和管理接口查看最近的错误
+type RingSink struct {
+	sinkBase
+	mu      sync.Mutex // 保护环形缓冲
+	entries []Entry    // 环形缓冲
+	next    int        // 下一个写入位置
+	full    bool       // 是否已写满一轮
+	total   uint64     // 累计写入条数
+}
+
+// DefaultRingSize 默认保留条数
+const DefaultRingSize = 256
+
+// NewRingSink
+//
+//	@Description: 创建内存环形输出
+//	@param size 保留条数, <=0时使用默认值
+//	@param level 最低级别
+//	@param encoder 编码(Lines使用)
+//	@return *RingSink
+func NewRingSink(size int, level int, encoder int) *RingSink {
+	if size <= 0 {
+		size = DefaultRingSize
+	}
+	s := &RingSink{entries: make([]Entry, size)}
+	s.SetLevel(level)
+	s.SetEncoder(encoder)
+	return s
+}
+
+func (s *RingSink) Write(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[s.next] = *e
+	s.next++
+	if s.next == len(s.entries) {
+		s.next = 0
+		s.full = true
+	}
+	s.total++
+	return nil
+}
+
+func (s *RingSink) Flush() error {
+	return nil
+}
+
+func (s *RingSink) Close() error {
+	return nil
+}
+
+// Entries
+//
+//	@Description: 保留的日志, 按时间从旧到新
+//	@receiver s
+//	@return []Entry
+func (s *RingSink) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.full {
+		return append([]Entry(nil), s.entries[:s.next]...)
+	}
+	entries := make([]Entry, 0, len(s.entries))
+	entries = append(entries, s.entries[s.next:]...)
+	return append(entries, s.entries[:s.next]...)
+}
+
+// Lines
+//
+//	@Description: 保留的日志按此输出的编码格式化, 不含结尾换行
+//	@receiver s
+//	@return []string
+func (s *RingSink) Lines() []string {
+	entries := s.Entries()
+	encoder := int(s.encoder.Load())
+	lines := make([]string, 0, len(entries))
+	var buf bytes.Buffer
+	for i := range entries {
+		buf.Reset()
+		Encode(&buf, &entries[i], encoder)
+		lines = append(lines, strings.TrimRight(buf.String(), "\n"))
+	}
+	return lines
+}
+
+// Total
+//
+//	@Description: 累计写入条数(包含已被覆盖的)
+//	@receiver s
+//	@return uint64
+func (s *RingSink) Total() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.total
+}
+
+// Reset
+//
+//	@Description: 清空保留的日志
+//	@receiver s
+func (s *RingSink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = make([]Entry, len(s.entries))
+	s.next = 0
+	s.full = false
+	s.total = 0
+}
@@ -0,0 +1,103 @@
+package zlog_test
+
+import (
+	"bytes"
+	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSinkLevels(t *testing.T) {
+	log := zlog.NewZLog(0)
+	log.SetOutput(io.Discard)
+	var out bytes.Buffer
+	writer := zlog.NewWriterSink(&out, zlog.LogWarn, zlog.EncoderText)
+	log.AddSink(writer)
+	ring := zlog.NewRingSink(8, zlog.LogError, zlog.EncoderText)
+	log.AddSink(ring)
+	capture := zlog.NewCapture(zlog.LogDebug)
+	log.AddSink(capture)
+
+	// 每个输出只写入不低于自身级别的日志
+	log.Debug("debug line")
+	log.Info("info line")
+	log.Warn("warn line")
+	log.Error("error line")
+	if got, want := out.String(), "warn line\nerror line\n"; got != want {
+		t.Errorf("writer sink got %q, want %q", got, want)
+	}
+	if got := ring.Lines(); len(got) != 1 || got[0] != "error line" {
+		t.Errorf("ring sink got %q", got)
+	}
+	if n := len(capture.Entries()); n != 4 {
+		t.Errorf("capture got %d entries, want 4", n)
+	}
+
+	// 输出级别可在运行中修改, 全局级别先于输出级别过滤
+	out.Reset()
+	writer.SetLevel(zlog.LogDebug)
+	log.SetLevel(zlog.LogInfo)
+	log.Debug("debug again")
+	log.Info("info again")
+	if got, want := out.String(), "info again\n"; got != want {
+		t.Errorf("writer sink got %q, want %q", got, want)
+	}
+
+	// 输出各自编码
+	out.Reset()
+	writer.SetEncoder(zlog.EncoderJSON)
+	log.Error("mixed")
+	if got := out.String(); got != `{"msg":"mixed"}`+"\n" {
+		t.Errorf("json writer sink got %q", got)
+	}
+	if got := ring.Lines(); got[len(got)-1] != "mixed" {
+		t.Errorf("text ring sink got %q", got)
+	}
+
+	// 移除后不再写入
+	out.Reset()
+	if !log.RemoveSink(writer) || log.RemoveSink(writer) {
+		t.Fatal("RemoveSink should succeed exactly once")
+	}
+	log.Error("removed")
+	if out.Len() != 0 {
+		t.Errorf("removed sink got %q", out.String())
+	}
+}
+
+func TestRingSink(t *testing.T) {
+	log := zlog.NewZLog(0)
+	log.SetOutput(io.Discard)
+	ring := zlog.NewRingSink(3, zlog.LogDebug, zlog.EncoderText)
+	log.AddSink(ring)
+
+	for _, msg := range []string{"a", "b"} {
+		log.Info(msg)
+	}
+	if got := ring.Lines(); strings.Join(got, ",") != "a,b" {
+		t.Fatalf("ring before wrap %q", got)
+	}
+
+	// 写满后覆盖最旧的, 按时间从旧到新返回
+	for _, msg := range []string{"c", "d", "e"} {
+		log.Info(msg)
+	}
+	entries := ring.Entries()
+	var messages []string
+	for _, e := range entries {
+		messages = append(messages, strings.TrimRight(e.Message, "\n"))
+	}
+	if strings.Join(messages, ",") != "c,d,e" || ring.Total() != 5 {
+		t.Fatalf("ring after wrap %v, total %d", messages, ring.Total())
+	}
+
+	ring.Reset()
+	if len(ring.Entries()) != 0 || ring.Total() != 0 {
+		t.Fatal("ring not reset")
+	}
+	log.With("k", 1).Warn("after reset")
+	if got := ring.Lines(); len(got) != 1 || got[0] != "after reset k=1" {
+		t.Fatalf("ring after reset %q", got)
+	}
+}
@@ -0,0 +1,141 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// syslog设施
+const (
+	FacilityUser   = 1  // 用户程序
+	FacilityDaemon = 3  // 系统守护进程
+	FacilityLocal0 = 16 // 本地自定义0, local1~local7 依次加1
+)
+
+// syslogPaths 未指定地址时依次尝试的本地socket
+var syslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSeverity 日志级别对应的syslog严重程度
+var syslogSeverity = []int{
+	LogDebug: 7, // debug
+	LogInfo:  6, // info
+	LogWarn:  4, // warning
+	LogError: 3, // err
+	LogPanic: 2, // crit
+	LogFatal: 2, // crit
+}
+
+// SyslogSink
+// @Description: 通过本地unix socket输出到syslog(RFC3164格式), 写入失败时重连一次
+type SyslogSink struct {
+	sinkBase
+	mu       sync.Mutex   // 保护连接和缓冲区
+	buf      bytes.Buffer // 编码缓冲区
+	addr     string       // socket地址, 为空时自动查找
+	tag      string       // 程序标识
+	facility int          // 设施
+	conn     net.Conn     // 当前连接
+}
+
+// NewSyslogSink
+//
+//	@Description: 创建syslog输出并建立连接
+//	@param addr unix socket路径, 为空时依次尝试 /dev/log 等常见路径
+//	@param tag 程序标识, 为空时使用进程名
+//	@param facility 设施
+//	@param level 最低级别
+//	@param encoder 编码
+//	@return *SyslogSink
+//	@return error
+func NewSyslogSink(addr string, tag string, facility int, level int, encoder int) (*SyslogSink, error) {
+	if tag == "" {
+		tag = shortFile(os.Args[0])
+	}
+	s := &SyslogSink{addr: addr, tag: tag, facility: facility}
+	s.SetLevel(level)
+	s.SetEncoder(encoder)
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect
+//
+//	@Description: 连接syslog, 数据报和流两种socket都尝试
+//	@receiver s
+//	@return error
+func (s *SyslogSink) connect() error {
+	paths := syslogPaths
+	if s.addr != "" {
+		paths = []string{s.addr}
+	}
+	var errs []error
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				s.conn = conn
+				return nil
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *SyslogSink) Write(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	s.buf.WriteByte('<')
+	s.buf.WriteString(strconv.Itoa(s.facility*8 + syslogSeverity[e.Level]))
+	s.buf.WriteByte('>')
+	s.buf.WriteString(e.Time.Format(time.Stamp))
+	s.buf.WriteByte(' ')
+	s.buf.WriteString(s.tag)
+	s.buf.WriteByte('[')
+	s.buf.WriteString(strconv.Itoa(os.Getpid()))
+	s.buf.WriteString("]: ")
+	// 时间和级别已包含在syslog头部中
+	entry := *e
+	entry.Flag &^= BitDate | BitTime | BitMicroSeconds | BitLevel
+	Encode(&s.buf, &entry, int(s.encoder.Load()))
+	data := bytes.TrimRight(s.buf.Bytes(), "\n")
+
+	var err error
+	if s.conn != nil {
+		if _, err = s.conn.Write(data); err == nil {
+			return nil
+		}
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	if err = s.connect(); err != nil {
+		return err
+	}
+	_, err = s.conn.Write(data)
+	return err
+}
+
+func (s *SyslogSink) Flush() error {
+	return nil
+}
+
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
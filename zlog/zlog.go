@@ -1,5 +1,7 @@
 package zlog
 
+import "io"
+
 var Ins = NewZLog(BitDefault)
 
 func Flags() int {
@@ -18,10 +20,117 @@ func SetLogPath(path string) {
 	Ins.SetLogPath(path)
 }
 
+func SetRotate(cfg RotateConfig) {
+	Ins.SetRotate(cfg)
+}
+
+func SetEncoder(encoder int) {
+	Ins.SetEncoder(encoder)
+}
+
+// With
+//
+//	@Description: 创建带附加字段的日志对象, 如 zlog.With("session", id).Info(...)
+//	@param kv 键值对: key, value, key, value...
+//	@return *ZLogger
+func With(kv ...interface{}) *ZLogger {
+	return Ins.With(kv...)
+}
+
+func SetAsync(cfg *AsyncConfig) {
+	Ins.SetAsync(cfg)
+}
+
+func Flush() {
+	Ins.Flush()
+}
+
+func Close() {
+	Ins.Close()
+}
+
+func Dropped() uint64 {
+	return Ins.Dropped()
+}
+
+// AddSink
+//
+//	@Description: 添加输出, 如 zlog.AddSink(zlog.NewRingSink(256, zlog.LogError, zlog.EncoderText))
+//	@param sink 输出
+func AddSink(sink ISink) {
+	Ins.AddSink(sink)
+}
+
+func RemoveSink(sink ISink) bool {
+	return Ins.RemoveSink(sink)
+}
+
+func Sinks() []ISink {
+	return Ins.Sinks()
+}
+
+func SetFileOutput(stat bool) {
+	Ins.SetFileOutput(stat)
+}
+
+// SetSampling
+//
+//	@Description: 开启日志采样, 如 zlog.SetSampling(&zlog.SamplingConfig{First: 100, Thereafter: 100})
+//	@param cfg 配置, 为空时关闭
+func SetSampling(cfg *SamplingConfig) {
+	Ins.SetSampling(cfg)
+}
+
+func Suppressed() uint64 {
+	return Ins.Suppressed()
+}
+
+// SetOutput
+//
+//	@Description: 输出到指定的io.Writer, 替代文件输出, 为空时恢复
+//	@param out 输出目标
+func SetOutput(out io.Writer) {
+	Ins.SetOutput(out)
+}
+
+// StartCapture
+//
+//	@Description: 测试中捕获日志, 如 capture, stop := zlog.StartCapture(); defer stop()
+//	@return *Capture
+//	@return func() 恢复原输出
+func StartCapture() (*Capture, func()) {
+	return Ins.StartCapture()
+}
+
 func SetLogConsole() {
 	Ins.SetConsole(true)
 }
 
+func SetLevel(level int) {
+	Ins.SetLevel(level)
+}
+
+func Level() int {
+	return Ins.Level()
+}
+
+// Module
+//
+//	@Description: 获取模块日志对象, 如 zlog.Module("net").Info(...)
+//	@param name 模块名
+//	@return *ZLogger
+func Module(name string) *ZLogger {
+	return Ins.Module(name)
+}
+
+func SetModuleLevel(name string, level int) {
+	Ins.SetModuleLevel(name, level)
+}
+
+func ResetModuleLevels() {
+	Ins.ResetModuleLevels()
+}
+
 func CloseDebug() {
 	Ins.CloseDebug()
 }
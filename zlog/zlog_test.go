@@ -1,11 +1,22 @@
 package zlog_test
 
 import (
+	"bytes"
+	"errors"
 	"github.com/liaoyudong2/GateServer/zlog"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestStdZLog(t *testing.T) {
+	capture, stop := zlog.StartCapture()
+	defer stop()
+	defer zlog.ResetFlags(zlog.BitDefault)
+	defer zlog.OpenDebug()
 
 	//测试 默认debug输出
 	zlog.Debug("zinx debug content1")
@@ -21,8 +32,6 @@ func TestStdZLog(t *testing.T) {
 	zlog.AddFlag(zlog.BitShortFile | zlog.BitTime)
 	zlog.Stack(" Zinx Stack! ")
 
-	//设置日志写入文件
-	zlog.SetLogPath("./log/GateSrv")
 	zlog.Debug("===> zinx debug content ~~666")
 	zlog.Debug("===> zinx debug content ~~888")
 	zlog.Error("===> zinx Error!!!! ~~~555~~~")
@@ -32,7 +41,137 @@ func TestStdZLog(t *testing.T) {
 	zlog.Debug("===> 我不应该出现~！")
 	zlog.Debug("===> 我不应该出现~！")
 	zlog.Error("===> zinx Error  after debug close !!!!")
+
+	messages := capture.Messages()
+	want := []string{
+		"zinx debug content1",
+		"zinx debug content2",
+		" zinx debug a = 10",
+		"zinx info content",
+		"",
+		"===> zinx debug content ~~666",
+		"===> zinx debug content ~~888",
+		"===> zinx Error!!!! ~~~555~~~",
+		"===> zinx Error  after debug close !!!!",
+	}
+	if len(messages) != len(want) {
+		t.Fatalf("captured %d lines, want %d: %q", len(messages), len(want), messages)
+	}
+	for i, message := range messages {
+		if i == 4 {
+			if !strings.HasPrefix(message, " Zinx Stack! \ngoroutine ") {
+				t.Errorf("line %d: stack trace missing: %q", i, message)
+			}
+			continue
+		}
+		if message != want[i] {
+			t.Errorf("line %d: got %q, want %q", i, message, want[i])
+		}
+	}
+	if capture.Find(zlog.LogDebug, "我不应该出现") != nil {
+		t.Error("debug line written after CloseDebug")
+	}
+	if n := capture.Count(zlog.LogError); n != 3 {
+		t.Errorf("got %d error lines, want 3", n)
+	}
+	entry := capture.Find(zlog.LogInfo, "zinx info content")
+	if entry == nil || entry.Caller() == "" || !strings.HasSuffix(entry.File, "zlog_test.go") {
+		t.Errorf("caller should point to the test file, got %+v", entry)
+	}
 }
 
 func TestZLogger(t *testing.T) {
+	var out bytes.Buffer
+	log := zlog.NewZLog(zlog.BitLevel | zlog.BitShortFile | zlog.BitTime)
+	log.SetOutput(&out)
+	capture := zlog.NewCapture(zlog.LogDebug)
+	log.AddSink(capture)
+
+	logger := log.With("user", "u1").With("err", errors.New("boom"))
+	logger.Infof("login failed, retry %d", 3)
+	logger.Debug("debug line")
+
+	entries := capture.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("captured %d entries, want 2", len(entries))
+	}
+	if entries[0].Level != zlog.LogInfo || entries[0].Message != "login failed, retry 3" {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+	if value, ok := entries[0].Field("user"); !ok || value != "u1" {
+		t.Errorf("field user = %v, want u1", value)
+	}
+	if caller := entries[0].Caller(); !strings.HasPrefix(caller, "zlog_test.go:") {
+		t.Errorf("caller = %q, want zlog_test.go:<line>", caller)
+	}
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d lines, want 2: %q", len(lines), out.String())
+	}
+	if !strings.Contains(lines[0], "[INFO] zlog_test.go:") || !strings.HasSuffix(lines[0], "login failed, retry 3 user=u1 err=boom") {
+		t.Errorf("unexpected text line: %q", lines[0])
+	}
+
+	//模块级别高于调用级别时不输出
+	log.SetModuleLevel("net", zlog.LogWarn)
+	log.Module("net").Info("filtered")
+	log.Module("net").Warn("kept")
+	if capture.Find(zlog.LogInfo, "filtered") != nil || capture.Find(zlog.LogWarn, "kept") == nil {
+		t.Errorf("module level not applied: %q", capture.Messages())
+	}
+
+	//json编码
+	out.Reset()
+	log.SetEncoder(zlog.EncoderJSON)
+	logger.Warn("json line")
+	if got := out.String(); !strings.Contains(got, `"level":"WARN"`) || !strings.Contains(got, `"msg":"json line","user":"u1","err":"boom"}`) {
+		t.Errorf("unexpected json line: %q", got)
+	}
+}
+
+func TestFileSinkWithoutPath(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	// 没有设置目录时输出到标准错误, 不在根目录创建文件
+	sink := zlog.NewFileSink("", zlog.RotateConfig{}, zlog.LogDebug, zlog.EncoderText)
+	if err = sink.Write(&zlog.Entry{Level: zlog.LogInfo, Message: "no log path\n"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = sink.Close()
+	_ = w.Close()
+	out, _ := io.ReadAll(r)
+	if !strings.Contains(string(out), "no log path") {
+		t.Fatalf("stderr got %q", out)
+	}
+}
+
+func TestFileSinkSetPath(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	sink := zlog.NewFileSink(first, zlog.RotateConfig{}, zlog.LogDebug, zlog.EncoderText)
+	defer sink.Close()
+
+	// 修改路径后立即写到新目录, 不等到下次拆分
+	for _, step := range []struct{ dir, msg string }{{first, "before\n"}, {second, "after\n"}} {
+		sink.SetPath(step.dir)
+		if err := sink.Write(&zlog.Entry{Level: zlog.LogInfo, Message: step.msg}); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(step.dir, time.Now().Format(time.DateOnly)+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), step.msg) {
+			t.Fatalf("%s got %q, want %q", step.dir, data, step.msg)
+		}
+	}
 }